@@ -17,31 +17,147 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // MonitorSpec defines the desired state of Monitor
 type MonitorSpec struct {
-	Model  Model             `json:"model"`
-	Period metav1.Duration   `json:"period"`
-	Labels map[string]string `json:"labels,omitempty"`
+	Model  Model           `json:"model"`
+	Period metav1.Duration `json:"period"`
+	// Timeout bounds a gather, a gather still running after it is cancelled. Defaults to the period
+	Timeout *metav1.Duration  `json:"timeout,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+
+	// RelabelConfigs relabel the target labels of the monitor, its labels and identity labels,
+	// before they are added to the samples. Labels starting with "__" are removed afterwards
+	RelabelConfigs []RelabelConfig `json:"relabelConfigs,omitempty"`
+	// MetricRelabelConfigs relabel every sample, with the metric name as __name__
+	MetricRelabelConfigs []RelabelConfig `json:"metricRelabelConfigs,omitempty"`
+
+	// MetricsInclude and MetricsExclude are glob patterns of the metric names to keep and drop,
+	// they match the names gathered by the model, before relabeling
+	MetricsInclude []string `json:"metricsInclude,omitempty"`
+	MetricsExclude []string `json:"metricsExclude,omitempty"`
+	// ValueMappings turn the string values of the matching metrics into numbers,
+	// e.g. the Elasticsearch cluster_health_status green/yellow/red
+	ValueMappings []ValueMapping `json:"valueMappings,omitempty"`
+	// SeriesLimit is the max number of series written per gather, the newest series are dropped
+	// over it. 0 takes the --monitor-series-limit of the controller
+	// +kubebuilder:validation:Minimum=0
+	SeriesLimit int `json:"seriesLimit,omitempty"`
+	// TargetSelector discovers the targets of the model in the cluster, one handler is started per
+	// discovered target instead of gathering the address set in Model.Config
+	TargetSelector *TargetSelector `json:"targetSelector,omitempty"`
+}
+
+// TargetSelector selects Pods, Services, Endpoints or EndpointSlices and sets the address of each of them in the model config
+type TargetSelector struct {
+	// +kubebuilder:validation:Enum=pod;service;endpoints;endpointslice
+	// +kubebuilder:default=endpoints
+	Role string `json:"role,omitempty"`
+	// Namespaces to discover the targets in, the namespace of the monitor when empty. The namespaces other
+	// than the one of the monitor must be allowed by the --target-namespaces flag of the operator
+	Namespaces []string             `json:"namespaces,omitempty"`
+	Selector   metav1.LabelSelector `json:"selector"`
+	// Port is the name or number of the container, service, endpoints or endpointslice port
+	Port string `json:"port"`
+	// ConfigKey is the model config key set to the target address, e.g. address, servers or urls
+	ConfigKey string `json:"configKey"`
+	// Format is the Go template of the ConfigKey value, with .Host, .Port and .Address (host:port),
+	// e.g. "http://{{ .Address }}/metrics". Defaults to "{{ .Address }}"
+	Format string `json:"format,omitempty"`
+	// PortKey, when set, is the model config key set to the target port, for the models taking the host and port apart
+	PortKey string `json:"portKey,omitempty"`
+	// Timeout bounds the gather of each target, the targets are gathered concurrently. Defaults to the monitor timeout
+	Timeout *metav1.Duration `json:"timeout,omitempty"`
+}
+
+// ValueMapping maps the values of the metrics matching one of the Metrics glob patterns,
+// the values not in Mappings are kept, a string value without mapping is dropped before the series limit
+type ValueMapping struct {
+	// +kubebuilder:validation:MinItems=1
+	Metrics []string `json:"metrics"`
+	// Mappings maps a value to the number written instead, e.g. "yellow": "1"
+	Mappings map[string]string `json:"mappings"`
+}
+
+// RelabelConfig is a Prometheus relabel_config, unset fields take the Prometheus defaults
+type RelabelConfig struct {
+	SourceLabels []string `json:"sourceLabels,omitempty"`
+	Separator    *string  `json:"separator,omitempty"`
+	Regex        *string  `json:"regex,omitempty"`
+	Modulus      uint64   `json:"modulus,omitempty"`
+	TargetLabel  string   `json:"targetLabel,omitempty"`
+	Replacement  *string  `json:"replacement,omitempty"`
+	// +kubebuilder:validation:Enum=replace;keep;drop;keepequal;dropequal;hashmod;labelmap;labeldrop;labelkeep;lowercase;uppercase
+	// +kubebuilder:default=replace
+	Action string `json:"action,omitempty"`
 }
 
 type Model struct {
 	Name   string            `json:"name"`
-	Config map[string]string `json:"config"`
+	Config map[string]string `json:"config,omitempty"`
+	// ConfigFrom sources config keys from Secrets or ConfigMaps in the monitor namespace,
+	// a key set here overrides the same key in Config
+	ConfigFrom []ConfigFrom `json:"configFrom,omitempty"`
 }
 
+type ConfigFrom struct {
+	Key       string      `json:"key"`
+	ValueFrom ValueSource `json:"valueFrom"`
+}
+
+// ValueSource selects a key of a Secret or ConfigMap, exactly one of the refs must be set
+type ValueSource struct {
+	SecretKeyRef    *corev1.SecretKeySelector    `json:"secretKeyRef,omitempty"`
+	ConfigMapKeyRef *corev1.ConfigMapKeySelector `json:"configMapKeyRef,omitempty"`
+}
+
+// Monitor condition types
+const (
+	// MonitorReady is false once gathers keep failing or the handler cannot be initialised
+	MonitorReady = "Ready"
+	// MonitorGathering is true while the worker of the monitor is running
+	MonitorGathering = "Gathering"
+	// MonitorDegraded is true when the last gather failed
+	MonitorDegraded = "Degraded"
+	// MonitorCardinalityLimited is true when the last gather dropped series over the series limit
+	MonitorCardinalityLimited = "CardinalityLimited"
+)
+
 // MonitorStatus defines the observed state of Monitor
 type MonitorStatus struct {
+	// LastPush is the time samples were last forwarded to the writers
 	LastPush metav1.Time `json:"lastPush,omitempty"`
+	// ObservedGeneration is the generation of the spec the running worker was started with
+	ObservedGeneration int64 `json:"observedGeneration,omitempty"`
+	// Shard is the operator replica gathering the monitor when sharding is enabled
+	Shard string `json:"shard,omitempty"`
+
+	LastSuccessfulGather *metav1.Time     `json:"lastSuccessfulGather,omitempty"`
+	LastGatherDuration   *metav1.Duration `json:"lastGatherDuration,omitempty"`
+	SamplesLastGather    int              `json:"samplesLastGather,omitempty"`
+	ConsecutiveFailures  int              `json:"consecutiveFailures,omitempty"`
+	LastError            string           `json:"lastError,omitempty"`
+	// LimitedSeries is the number of series the last gather dropped over the series limit
+	LimitedSeries int `json:"limitedSeries,omitempty"`
+
+	// +listType=map
+	// +listMapKey=type
+	Conditions []metav1.Condition `json:"conditions,omitempty"`
 }
 
 // +genclient
 //+kubebuilder:object:root=true
 //+kubebuilder:subresource:status
 //+kubebuilder:printcolumn:name="Model",type="string",JSONPath=".spec.model.name",description="The monitor model"
+//+kubebuilder:printcolumn:name="Ready",type="string",JSONPath=".status.conditions[?(@.type==\"Ready\")].status",description="Whether the monitor gathers successfully"
+//+kubebuilder:printcolumn:name="Samples",type="integer",JSONPath=".status.samplesLastGather",description="The samples of the last gather"
+//+kubebuilder:printcolumn:name="Failures",type="integer",JSONPath=".status.consecutiveFailures",description="The consecutive failed gathers"
 //+kubebuilder:printcolumn:name="lastPush",type="string",JSONPath=".status.lastPush",description="The monitor lastPush"
+//+kubebuilder:printcolumn:name="Shard",type="string",JSONPath=".status.shard",description="The operator replica gathering the monitor",priority=1
+//+kubebuilder:printcolumn:name="LastError",type="string",JSONPath=".status.lastError",description="The error of the last failed gather",priority=1
 
 // Monitor is the Schema for the monitors API
 type Monitor struct {
@@ -17,19 +17,131 @@ limitations under the License.
 package v1
 
 import (
+	corev1 "k8s.io/api/core/v1"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // PrometheusPushSpec defines the desired state of PrometheusPush
 type PrometheusPushSpec struct {
-	Url           string   `json:"url"`
+	// Type is the protocol the series are pushed with
+	//+kubebuilder:validation:Enum=remote_write;influx;otlp;kafka
+	//+kubebuilder:default=remote_write
+	Type PushType `json:"type,omitempty"`
+	// Influx configures the pushes of type influx
+	Influx *InfluxConfig `json:"influx,omitempty"`
+	// OTLP configures the pushes of type otlp
+	OTLP *OTLPConfig `json:"otlp,omitempty"`
+	// Kafka configures the pushes of type kafka
+	Kafka *KafkaConfig `json:"kafka,omitempty"`
+
+	// Url is the endpoint of the HTTP types, required by all types but kafka
+	Url           string   `json:"url,omitempty"`
 	BasicAuthUser string   `json:"basic_auth_user,omitempty"`
 	BasicAuthPass string   `json:"basic_auth_pass,omitempty"`
 	Headers       []string `json:"headers,omitempty"`
+	// BasicAuthPassFrom sources the basic auth password, it overrides BasicAuthPass
+	BasicAuthPassFrom *ValueSource `json:"basic_auth_pass_from,omitempty"`
+	// BearerTokenFrom sources a token sent as "Authorization: Bearer <token>"
+	BearerTokenFrom *ValueSource `json:"bearer_token_from,omitempty"`
+	TLSConfig       *TLSConfig   `json:"tls_config,omitempty"`
 
 	Timeout             int64 `json:"timeout"`
 	DialTimeout         int64 `json:"dial_timeout"`
 	MaxIdleConnsPerHost int   `json:"max_idle_conns_per_host"`
+	// MaxRetries bounds the retries of a push failed with a network error, 5xx or 429,
+	// 0 uses the default and a negative value disables retries
+	MaxRetries int `json:"max_retries,omitempty"`
+	// Batch is the max series of a push, 0 uses the --writer-batch flag
+	Batch int `json:"batch,omitempty"`
+	// Concurrency is the number of pushes sent in parallel, 0 sends one at a time
+	Concurrency int `json:"concurrency,omitempty"`
+
+	// MonitorSelector and MonitorNamespaces restrict the Monitors whose samples are pushed,
+	// all Monitors are pushed when both are empty. kubemonitor self metrics are always pushed
+	MonitorSelector   *metav1.LabelSelector `json:"monitor_selector,omitempty"`
+	MonitorNamespaces []string              `json:"monitor_namespaces,omitempty"`
+}
+
+// PushType is the protocol of a PrometheusPush.
+type PushType string
+
+const (
+	// PushRemoteWrite pushes with the Prometheus remote write protocol
+	PushRemoteWrite PushType = "remote_write"
+	// PushInflux pushes with the InfluxDB line protocol, to InfluxDB or VictoriaMetrics
+	PushInflux PushType = "influx"
+	// PushOTLP pushes with OTLP/HTTP in protobuf, to an OpenTelemetry collector
+	PushOTLP PushType = "otlp"
+	// PushKafka produces the samples to a Kafka topic
+	PushKafka PushType = "kafka"
+)
+
+// InfluxConfig configures the pushes with the InfluxDB line protocol. Url is the write endpoint,
+// /api/v2/write when Bucket is set and /write otherwise are appended to a url without path.
+type InfluxConfig struct {
+	// Database and RetentionPolicy select where InfluxDB 1.x writes
+	Database        string `json:"database,omitempty"`
+	RetentionPolicy string `json:"retention_policy,omitempty"`
+	// Bucket and Org select where InfluxDB 2.x writes
+	Bucket string `json:"bucket,omitempty"`
+	Org    string `json:"org,omitempty"`
+	// TokenFrom sources a token sent as "Authorization: Token <token>"
+	TokenFrom *ValueSource `json:"token_from,omitempty"`
+	// Measurement is the measurement of every point, the metric names become its fields.
+	// When empty the metric name is the measurement and the field is "value"
+	Measurement string `json:"measurement,omitempty"`
+	// Gzip compresses the body of the pushes
+	Gzip bool `json:"gzip,omitempty"`
+}
+
+// OTLPConfig configures the pushes with OTLP/HTTP. Url is the metrics endpoint,
+// /v1/metrics is appended to a url without path.
+type OTLPConfig struct {
+	// ResourceLabels are the labels moved to the resource attributes,
+	// monitor_namespace and monitor_name when empty
+	ResourceLabels []string `json:"resource_labels,omitempty"`
+	// Gzip compresses the body of the pushes
+	Gzip bool `json:"gzip,omitempty"`
+}
+
+// KafkaConfig configures the pushes to Kafka. TLSConfig configures the TLS connection to the brokers.
+type KafkaConfig struct {
+	//+kubebuilder:validation:MinItems=1
+	Brokers []string `json:"brokers"`
+	Topic   string   `json:"topic"`
+	// PartitionKey keys the messages by the metric name or by the value of PartitionLabel
+	//+kubebuilder:validation:Enum=metric;label
+	//+kubebuilder:default=metric
+	PartitionKey   string `json:"partition_key,omitempty"`
+	PartitionLabel string `json:"partition_label,omitempty"`
+	// Format is json for a message per sample, or protobuf for a message per prompb.TimeSeries
+	//+kubebuilder:validation:Enum=json;protobuf
+	//+kubebuilder:default=json
+	Format string `json:"format,omitempty"`
+	//+kubebuilder:validation:Enum=none;gzip;snappy;lz4;zstd
+	Compression string `json:"compression,omitempty"`
+	// TLS connects to the brokers with TLS, implied by tls_config
+	TLS  bool       `json:"tls,omitempty"`
+	SASL *KafkaSASL `json:"sasl,omitempty"`
+}
+
+// KafkaSASL configures the SASL authentication to the brokers.
+type KafkaSASL struct {
+	//+kubebuilder:validation:Enum=plain;scram-sha-256;scram-sha-512
+	Mechanism    string       `json:"mechanism"`
+	Username     string       `json:"username"`
+	PasswordFrom *ValueSource `json:"password_from,omitempty"`
+}
+
+// TLSConfig configures the TLS connection to the remote write endpoint
+type TLSConfig struct {
+	// CA is the PEM encoded CA bundle used to verify the server certificate
+	CA *ValueSource `json:"ca,omitempty"`
+	// Cert and KeySecret are the PEM encoded client certificate and key used for mTLS
+	Cert               *ValueSource              `json:"cert,omitempty"`
+	KeySecret          *corev1.SecretKeySelector `json:"key_secret,omitempty"`
+	ServerName         string                    `json:"server_name,omitempty"`
+	InsecureSkipVerify bool                      `json:"insecure_skip_verify,omitempty"`
 }
 
 // PrometheusPushStatus defines the observed state of PrometheusPush
@@ -17,15 +17,23 @@ limitations under the License.
 package main
 
 import (
+	"context"
 	"flag"
 	"github.com/noovertime7/kubemonitor/pkg/metrics"
 	monitorRuntime "github.com/noovertime7/kubemonitor/runtime"
 
 	"github.com/noovertime7/kubemonitor/internal/writer"
 	"github.com/noovertime7/kubemonitor/pkg/input"
+	"github.com/noovertime7/kubemonitor/pkg/process"
 	"github.com/noovertime7/kubemonitor/pkg/worker"
 
+	"errors"
+	"fmt"
+	"net/http"
 	"os"
+	"strconv"
+	"strings"
+	"time"
 
 	nativeZap "go.uber.org/zap"
 	"go.uber.org/zap/zapcore"
@@ -38,15 +46,19 @@ import (
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/healthz"
 	"sigs.k8s.io/controller-runtime/pkg/log/zap"
+	"sigs.k8s.io/controller-runtime/pkg/manager"
 	metricsserver "sigs.k8s.io/controller-runtime/pkg/metrics/server"
 
 	kubemonitoriov1 "github.com/noovertime7/kubemonitor/api/v1"
 	"github.com/noovertime7/kubemonitor/internal/controller"
+	"github.com/noovertime7/kubemonitor/internal/exporter"
+	"github.com/noovertime7/kubemonitor/internal/shard"
 
 	_ "github.com/noovertime7/kubemonitor/internal/handlers/clickhouse"
 	_ "github.com/noovertime7/kubemonitor/internal/handlers/elasticsearch"
 	_ "github.com/noovertime7/kubemonitor/internal/handlers/mysql"
 	_ "github.com/noovertime7/kubemonitor/internal/handlers/postgresql"
+	_ "github.com/noovertime7/kubemonitor/internal/handlers/prometheus"
 	_ "github.com/noovertime7/kubemonitor/internal/handlers/redis"
 )
 
@@ -70,6 +82,19 @@ func main() {
 		metricsAddr          string
 		maxWriterQueueSize   int
 		writerBatch          int
+		writerWALDir         string
+		writerWALMaxSize     int64
+		monitorSeriesLimit   int
+		globalSeriesLimit    int
+		scheduleJitter       float64
+		maxGathers           int
+		maxGathersPerModel   string
+		targetNamespaces     string
+		sharding             bool
+		shardID              string
+		shardNamespace       string
+		pullAddr             string
+		pullStaleAfter       time.Duration
 	)
 
 	flag.StringVar(&metricsAddr, "metrics-bind-address", ":8080", "The address the metric endpoint binds to.")
@@ -78,8 +103,21 @@ func main() {
 		"Enable leader election for controller manager. "+
 			"Enabling this will ensure there is only one active controller manager.")
 	flag.StringVar(&logLevel, "log-level", "info", "log level")
-	flag.IntVar(&maxWriterQueueSize, "max-writer-queue-size", 1000000, "max-writer-queue-size")
+	flag.IntVar(&maxWriterQueueSize, "max-writer-queue-size", 1000000, "max-writer-queue-size of every PrometheusPush")
 	flag.IntVar(&writerBatch, "writer-batch", 1000, "writer-batch")
+	flag.StringVar(&writerWALDir, "writer-wal-dir", "", "The directory of the writer write-ahead queues, one per PrometheusPush. Series are queued in memory when empty.")
+	flag.Int64Var(&writerWALMaxSize, "writer-wal-max-size", 1<<30, "The max size in bytes of the write-ahead queue of every PrometheusPush.")
+	flag.Float64Var(&scheduleJitter, "schedule-jitter", 0, "Spreads the first gather of every Monitor over this fraction of its period, between 0 and 1, e.g. 0.1 delays it by up to a tenth of the period. 0 gathers every Monitor as soon as it is started.")
+	flag.IntVar(&maxGathers, "max-concurrent-gathers", 0, "The max number of gathers running at once, 0 is unlimited.")
+	flag.StringVar(&maxGathersPerModel, "max-concurrent-gathers-per-model", "", "The max number of gathers running at once per model, e.g. mysql=4,clickhouse=2.")
+	flag.BoolVar(&sharding, "sharding", false, "Spread the Monitors over every replica instead of gathering them all on the leader, it excludes --leader-elect.")
+	flag.StringVar(&shardID, "shard-id", os.Getenv("POD_NAME"), "The shard name of the replica, unique among the replicas. Defaults to $POD_NAME, or the hostname.")
+	flag.StringVar(&shardNamespace, "shard-namespace", os.Getenv("POD_NAMESPACE"), "The namespace of the shard Leases. Defaults to $POD_NAMESPACE.")
+	flag.StringVar(&pullAddr, "pull-bind-address", "", "The address the /metrics endpoint exposing the last gathered samples of every Monitor binds to, alongside the PrometheusPushes. Empty disables it.")
+	flag.DurationVar(&pullStaleAfter, "pull-stale-after", 5*time.Minute, "The time the samples of a Monitor stay on the pull endpoint without a new gather, 0 keeps them until the Monitor is stopped.")
+	flag.IntVar(&monitorSeriesLimit, "monitor-series-limit", 0, "The max number of series written per gather of the Monitors not setting seriesLimit, 0 is unlimited.")
+	flag.StringVar(&targetNamespaces, "target-namespaces", "", "The namespaces a Monitor may discover targets in besides its own, separated by commas, * for any. Empty restricts the discovery to the namespace of the Monitor.")
+	flag.IntVar(&globalSeriesLimit, "global-series-limit", 0, "The max number of series written by the last gathers of all the Monitors together, the series of a Monitor growing past it are dropped. 0 is unlimited.")
 
 	opts := zap.Options{
 		Development: true,
@@ -99,6 +137,11 @@ func main() {
 
 	ctrl.SetLogger(logger)
 
+	if sharding && enableLeaderElection {
+		setupLog.Error(fmt.Errorf("--sharding and --leader-elect are exclusive"), "invalid flags")
+		os.Exit(1)
+	}
+
 	mgr, err := ctrl.NewManager(ctrl.GetConfigOrDie(), ctrl.Options{
 		Scheme:                 scheme,
 		Metrics:                metricsserver.Options{BindAddress: metricsAddr},
@@ -122,18 +165,58 @@ func main() {
 		os.Exit(1)
 	}
 
-	writersMgr := writer.NewWriter(maxWriterQueueSize, writerBatch, logger)
-	wker := worker.NewWorker()
+	writerQueues := writer.MemoryQueues(maxWriterQueueSize)
+	if writerWALDir != "" {
+		writerQueues = writer.WALQueues(writerWALDir, writerWALMaxSize, logger)
+	}
+	var writersMgr writer.WritersManager = writer.NewWriterWithQueues(writerQueues, writerBatch, logger)
+	if pullAddr != "" {
+		exp := exporter.New(pullStaleAfter)
+		writersMgr = exporter.Tee(writersMgr, exp)
+		if err := mgr.Add(pullServer(pullAddr, exp)); err != nil {
+			setupLog.Error(err, "unable to add the pull endpoint")
+			os.Exit(1)
+		}
+	}
+	perModel, err := parseModelLimits(maxGathersPerModel)
+	if err != nil {
+		setupLog.Error(err, "invalid --max-concurrent-gathers-per-model")
+		os.Exit(1)
+	}
+	wker := worker.NewScheduler(worker.Options{
+		Jitter:                scheduleJitter,
+		MaxConcurrent:         maxGathers,
+		MaxConcurrentPerModel: perModel,
+	})
 
 	// 启动kubeMetrics
-	metrics.NewKubeMonitor(writersMgr, logger).Run(monitorRuntime.SystemContext.Done())
+	metrics.NewKubeMonitor(writersMgr, wker, logger).Run(monitorRuntime.SystemContext.Done())
 
 	if err = controller.NewPrometheusPushReconciler(mgr.GetClient(), mgr.GetScheme(), writersMgr).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "PrometheusPush")
 		os.Exit(1)
 	}
 
-	if err = controller.NewMonitorReconciler(mgr.GetClient(), mgr.GetScheme(), writersMgr, wker, input.Factory).SetupWithManager(mgr); err != nil {
+	var sharder *shard.Sharder
+	if sharding {
+		if shardID == "" {
+			if shardID, err = os.Hostname(); err != nil {
+				setupLog.Error(err, "unable to get the shard id")
+				os.Exit(1)
+			}
+		}
+		if shardNamespace == "" {
+			setupLog.Error(fmt.Errorf("--shard-namespace is empty"), "invalid flags")
+			os.Exit(1)
+		}
+		sharder = shard.New(mgr.GetClient(), mgr.GetAPIReader(), shard.Options{ID: shardID, Namespace: shardNamespace}, logger)
+		if err := mgr.Add(sharder); err != nil {
+			setupLog.Error(err, "unable to add the sharder")
+			os.Exit(1)
+		}
+	}
+
+	if err = controller.NewMonitorReconciler(mgr.GetClient(), mgr.GetScheme(), writersMgr, wker, input.Factory, monitorSeriesLimit, process.NewSeriesBudget(globalSeriesLimit), parseList(targetNamespaces), sharder).SetupWithManager(mgr); err != nil {
 		setupLog.Error(err, "unable to create controller", "controller", "Monitor")
 		os.Exit(1)
 	}
@@ -155,6 +238,69 @@ func main() {
 	}
 
 	wker.StopAll()
+	if err := writersMgr.Close(); err != nil {
+		setupLog.Error(err, "close writers error")
+	}
+}
+
+// pullRunnable runs on every replica, the replicas not gathering serve no samples.
+type pullRunnable manager.RunnableFunc
+
+func (f pullRunnable) Start(ctx context.Context) error { return f(ctx) }
+
+func (f pullRunnable) NeedLeaderElection() bool { return false }
+
+// pullServer serves the samples of exp on /metrics of addr until the manager stops.
+func pullServer(addr string, exp *exporter.Exporter) manager.Runnable {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", exp)
+	server := &http.Server{Addr: addr, Handler: mux, ReadHeaderTimeout: 10 * time.Second}
+
+	return pullRunnable(func(ctx context.Context) error {
+		go func() {
+			<-ctx.Done()
+			shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+			defer cancel()
+			_ = server.Shutdown(shutdownCtx)
+		}()
+		setupLog.Info("serving the pull endpoint", "address", addr)
+		if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			return err
+		}
+		return nil
+	})
+}
+
+// parseModelLimits parses model=limit pairs separated by commas.
+func parseModelLimits(value string) (map[string]int, error) {
+	limits := map[string]int{}
+	for _, pair := range strings.Split(value, ",") {
+		pair = strings.TrimSpace(pair)
+		if pair == "" {
+			continue
+		}
+		model, limit, ok := strings.Cut(pair, "=")
+		if !ok {
+			return nil, fmt.Errorf("%q is not model=limit", pair)
+		}
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			return nil, fmt.Errorf("%q: %w", pair, err)
+		}
+		limits[strings.TrimSpace(model)] = n
+	}
+	return limits, nil
+}
+
+// parseList parses values separated by commas, ignoring the empty ones.
+func parseList(value string) []string {
+	var values []string
+	for _, v := range strings.Split(value, ",") {
+		if v = strings.TrimSpace(v); v != "" {
+			values = append(values, v)
+		}
+	}
+	return values
 }
 
 func SetLevel(level string) zapcore.LevelEnabler {
@@ -0,0 +1,195 @@
+package controller
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"sort"
+
+	corev1 "k8s.io/api/core/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	"k8s.io/apimachinery/pkg/types"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kubemonitoriov1 "github.com/noovertime7/kubemonitor/api/v1"
+	"github.com/noovertime7/kubemonitor/pkg/input"
+)
+
+const (
+	// monitorSecretsIndex and monitorConfigMapsIndex index monitors by the objects referenced in configFrom
+	monitorSecretsIndex    = ".spec.model.configFrom.secretKeyRef"
+	monitorConfigMapsIndex = ".spec.model.configFrom.configMapKeyRef"
+
+	// pushSecretsIndex and pushConfigMapsIndex index PrometheusPushes by the objects they reference
+	pushSecretsIndex    = ".spec.secretRefs"
+	pushConfigMapsIndex = ".spec.configMapRefs"
+)
+
+// resolveConfig merges model.Config with the values referenced by model.ConfigFrom.
+func resolveConfig(ctx context.Context, c client.Reader, namespace string, model kubemonitoriov1.Model) (input.ConfigMap, error) {
+	config := make(input.ConfigMap, len(model.Config)+len(model.ConfigFrom))
+	for k, v := range model.Config {
+		config[k] = v
+	}
+	for _, from := range model.ConfigFrom {
+		value, ok, err := resolveValue(ctx, c, namespace, from.ValueFrom)
+		if err != nil {
+			return nil, fmt.Errorf("config key %s: %w", from.Key, err)
+		}
+		if ok {
+			config[from.Key] = value
+		}
+	}
+	return config, nil
+}
+
+// resolveValue returns the value selected by source, ok is false when an optional ref is missing.
+func resolveValue(ctx context.Context, c client.Reader, namespace string, source kubemonitoriov1.ValueSource) (string, bool, error) {
+	switch {
+	case source.SecretKeyRef != nil && source.ConfigMapKeyRef != nil:
+		return "", false, fmt.Errorf("only one of secretKeyRef and configMapKeyRef may be set")
+	case source.SecretKeyRef != nil:
+		ref := source.SecretKeyRef
+		secret := &corev1.Secret{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, secret); err != nil {
+			if apierrors.IsNotFound(err) && isOptional(ref.Optional) {
+				return "", false, nil
+			}
+			return "", false, err
+		}
+		value, ok := secret.Data[ref.Key]
+		if !ok {
+			if isOptional(ref.Optional) {
+				return "", false, nil
+			}
+			return "", false, fmt.Errorf("key %s not found in secret %s/%s", ref.Key, namespace, ref.Name)
+		}
+		return string(value), true, nil
+	case source.ConfigMapKeyRef != nil:
+		ref := source.ConfigMapKeyRef
+		cm := &corev1.ConfigMap{}
+		if err := c.Get(ctx, types.NamespacedName{Namespace: namespace, Name: ref.Name}, cm); err != nil {
+			if apierrors.IsNotFound(err) && isOptional(ref.Optional) {
+				return "", false, nil
+			}
+			return "", false, err
+		}
+		value, ok := cm.Data[ref.Key]
+		if !ok {
+			if isOptional(ref.Optional) {
+				return "", false, nil
+			}
+			return "", false, fmt.Errorf("key %s not found in configmap %s/%s", ref.Key, namespace, ref.Name)
+		}
+		return value, true, nil
+	default:
+		return "", false, fmt.Errorf("one of secretKeyRef and configMapKeyRef must be set")
+	}
+}
+
+// resolveOptionalValue is resolveValue for an optional source, a nil or missing optional source resolves to "".
+func resolveOptionalValue(ctx context.Context, c client.Reader, namespace string, source *kubemonitoriov1.ValueSource) (string, error) {
+	if source == nil {
+		return "", nil
+	}
+	value, _, err := resolveValue(ctx, c, namespace, *source)
+	return value, err
+}
+
+func isOptional(optional *bool) bool {
+	return optional != nil && *optional
+}
+
+// configHash returns a stable digest of config, used to detect rotated credentials.
+func configHash(config input.ConfigMap) string {
+	keys := make([]string, 0, len(config))
+	for k := range config {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	h := sha256.New()
+	for _, k := range keys {
+		fmt.Fprintf(h, "%s=%s\x00", k, config[k])
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// referencedSecrets returns the names of the Secrets referenced by the monitor.
+func referencedSecrets(obj client.Object) []string {
+	monitor, ok := obj.(*kubemonitoriov1.Monitor)
+	if !ok {
+		return nil
+	}
+	var names []string
+	for _, from := range monitor.Spec.Model.ConfigFrom {
+		if ref := from.ValueFrom.SecretKeyRef; ref != nil {
+			names = append(names, ref.Name)
+		}
+	}
+	return names
+}
+
+// referencedConfigMaps returns the names of the ConfigMaps referenced by the monitor.
+func referencedConfigMaps(obj client.Object) []string {
+	monitor, ok := obj.(*kubemonitoriov1.Monitor)
+	if !ok {
+		return nil
+	}
+	var names []string
+	for _, from := range monitor.Spec.Model.ConfigFrom {
+		if ref := from.ValueFrom.ConfigMapKeyRef; ref != nil {
+			names = append(names, ref.Name)
+		}
+	}
+	return names
+}
+
+// pushValueSources returns every value source referenced by the PrometheusPush.
+func pushValueSources(push *kubemonitoriov1.PrometheusPush) []*kubemonitoriov1.ValueSource {
+	sources := []*kubemonitoriov1.ValueSource{push.Spec.BasicAuthPassFrom, push.Spec.BearerTokenFrom}
+	if tlsConfig := push.Spec.TLSConfig; tlsConfig != nil {
+		sources = append(sources, tlsConfig.CA, tlsConfig.Cert)
+		if tlsConfig.KeySecret != nil {
+			sources = append(sources, &kubemonitoriov1.ValueSource{SecretKeyRef: tlsConfig.KeySecret})
+		}
+	}
+	if influx := push.Spec.Influx; influx != nil {
+		sources = append(sources, influx.TokenFrom)
+	}
+	if kafka := push.Spec.Kafka; kafka != nil && kafka.SASL != nil {
+		sources = append(sources, kafka.SASL.PasswordFrom)
+	}
+	return sources
+}
+
+// pushReferencedSecrets returns the names of the Secrets referenced by the PrometheusPush.
+func pushReferencedSecrets(obj client.Object) []string {
+	push, ok := obj.(*kubemonitoriov1.PrometheusPush)
+	if !ok {
+		return nil
+	}
+	var names []string
+	for _, source := range pushValueSources(push) {
+		if source != nil && source.SecretKeyRef != nil {
+			names = append(names, source.SecretKeyRef.Name)
+		}
+	}
+	return names
+}
+
+// pushReferencedConfigMaps returns the names of the ConfigMaps referenced by the PrometheusPush.
+func pushReferencedConfigMaps(obj client.Object) []string {
+	push, ok := obj.(*kubemonitoriov1.PrometheusPush)
+	if !ok {
+		return nil
+	}
+	var names []string
+	for _, source := range pushValueSources(push) {
+		if source != nil && source.ConfigMapKeyRef != nil {
+			names = append(names, source.ConfigMapKeyRef.Name)
+		}
+	}
+	return names
+}
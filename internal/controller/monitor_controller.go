@@ -20,16 +20,29 @@ import (
 	"context"
 	"fmt"
 	"github.com/go-logr/logr"
+	"github.com/noovertime7/kubemonitor/internal/labels"
+	"github.com/noovertime7/kubemonitor/internal/shard"
 	"github.com/noovertime7/kubemonitor/internal/writer"
+	"github.com/noovertime7/kubemonitor/pkg/filter"
 	"github.com/noovertime7/kubemonitor/pkg/input"
 	"github.com/noovertime7/kubemonitor/pkg/process"
 	"github.com/noovertime7/kubemonitor/pkg/types"
 	"github.com/noovertime7/kubemonitor/pkg/worker"
+	"strconv"
+	"sync"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/builder"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/predicate"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
+	"sigs.k8s.io/controller-runtime/pkg/source"
 
 	kubemonitoriov1 "github.com/noovertime7/kubemonitor/api/v1"
 )
@@ -38,7 +51,17 @@ import (
 type monitorReconciler struct {
 	worker  worker.Worker
 	wm      writer.WritersManager
-	factory *input.SharedHandlerFactory
+	factory *input.Registry
+	// seriesLimit is the series limit of the monitors not setting one, 0 is unlimited
+	seriesLimit int
+	// seriesBudget, when set, caps the series of all the monitors together
+	seriesBudget *process.SeriesBudget
+	// targetNamespaces are the namespaces the monitors may discover targets in besides their own, "*" for any
+	targetNamespaces []string
+	// sharder, when set, restricts the monitors gathered to those assigned to this replica
+	sharder *shard.Sharder
+	// monitors holds the *runningMonitor of every started monitor
+	monitors sync.Map
 	client.Client
 	Scheme *runtime.Scheme
 }
@@ -46,16 +69,22 @@ type monitorReconciler struct {
 //+kubebuilder:rbac:groups=kubemonitor.io.kubemonitor.io,resources=monitors,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=kubemonitor.io.kubemonitor.io,resources=monitors/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=kubemonitor.io.kubemonitor.io,resources=monitors/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=secrets;configmaps,verbs=get;list;watch
+//+kubebuilder:rbac:groups="",resources=pods;services;endpoints,verbs=get;list;watch
+//+kubebuilder:rbac:groups=discovery.k8s.io,resources=endpointslices,verbs=get;list;watch
+//+kubebuilder:rbac:groups=coordination.k8s.io,resources=leases,verbs=get;list;watch;create;update;delete
 
 func (r *monitorReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx)
+	key := req.NamespacedName.String()
 
 	original := &kubemonitoriov1.Monitor{}
 	err := r.Client.Get(ctx, req.NamespacedName, original)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			logger.Info("monitor not found")
-			r.worker.Stop(req.Name)
+			r.stopMonitor(key)
+			process.ForgetDroppedSeries(key)
 			r.worker.Range()
 			return ctrl.Result{}, nil
 		}
@@ -63,39 +92,86 @@ func (r *monitorReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 		return ctrl.Result{}, err
 	}
 
-	if ok := r.worker.Exist(req.Name); ok {
-		logger.Info("monitor already start, skip...")
+	if r.sharder != nil && !r.sharder.Owns(original) {
+		if r.worker.Exist(key) || r.running(key) != nil {
+			logger.Info("monitor assigned to another shard, stop...")
+			r.stopMonitor(key)
+			process.ForgetDroppedSeries(key)
+			r.worker.Range()
+		}
 		return ctrl.Result{}, nil
 	}
+	if r.sharder != nil && !r.worker.Exist(key) && !r.sharder.Released(original) {
+		logger.Info("monitor still gathered by its previous shard, wait...")
+		return ctrl.Result{RequeueAfter: r.sharder.RenewInterval()}, nil
+	}
 
 	monitor := original.DeepCopy()
-	monitorWorker := NewMonitorWorker(r.Client, monitor, r.worker)
-
 	model := monitor.Spec.Model
 	logger = logger.WithValues("model", model.Name)
 
-	if err := r.factory.InitConfig(model.Name, model.Config); err != nil {
+	config, err := resolveConfig(ctx, r.Client, monitor.Namespace, model)
+	if err != nil {
+		logger.Error(err, "resolve handler config error")
+		return ctrl.Result{}, err
+	}
+	hash := configHash(config)
+
+	if ok := r.worker.Exist(key); ok {
+		running := r.running(key)
+		switch {
+		case running != nil && running.generation == monitor.Generation && running.configHash == hash:
+			// labels are not part of the generation, keep routing in sync without a restart
+			running.setSource(monitorSource(monitor))
+			logger.Info("monitor already start, skip...")
+			return ctrl.Result{}, nil
+		case running != nil && running.generation == monitor.Generation:
+			logger.Info("monitor config changed, restart...")
+		default:
+			logger.Info("monitor spec changed, restart...", "generation", monitor.Generation)
+		}
+		r.stopMonitor(key)
+	}
+
+	monitorWorker := NewMonitorWorker(r.Client, monitor, r.worker, r.shardID())
+
+	processor, err := newProcessor(monitor, r.seriesLimit, r.seriesBudget)
+	if err != nil {
+		logger.Error(err, "init processor error")
+		if statusErr := monitorWorker.UpdateInitFailedStatus(ctx, err); statusErr != nil {
+			logger.Error(statusErr, "update status error")
+		}
+		return ctrl.Result{}, err
+	}
+
+	handler, err := r.newGatherer(monitor, config)
+	if err != nil {
 		logger.Error(err, "init handler config error")
+		if statusErr := monitorWorker.UpdateInitFailedStatus(ctx, err); statusErr != nil {
+			logger.Error(statusErr, "update status error")
+		}
 		return ctrl.Result{}, err
 	}
 	logger.Info("init handler config success")
 
-	monitorWorker.AddWorkerTask(monitor.Name)
+	monitorWorker.AddWorkerTask(key)
+	running := &runningMonitor{handler: handler, processor: processor, generation: monitor.Generation, configHash: hash, source: monitorSource(monitor)}
+	r.monitors.Store(key, running)
 
-	err = monitorWorker.RunAfterPatchStatus(ctx, monitor.Name, monitor.Spec.Period.Duration, func() error {
-		err := r.factory.Gather(model.Name)
-		if err != nil {
-			return err
+	err = monitorWorker.RunAfterPatchStatus(ctx, key, monitor.Spec.Period.Duration, gatherTimeout(monitor), func(ctx context.Context) gatherResult {
+		start := time.Now()
+		list, err := handler.Gather(ctx)
+		samples := r.forward(logger, running.getSource(), processor.Process(list))
+		return gatherResult{
+			duration:      time.Since(start),
+			samples:       samples,
+			limitedSeries: processor.LimitedSeries(),
+			seriesLimit:   processor.SeriesLimit(),
+			err:           err,
 		}
-		//r.factory.PopBackAll("mysql")
-		list, err := r.factory.List(model.Name)
-		if err != nil {
-			return err
-		}
-		r.forward(logger, process.Process(list, monitor.Spec.Labels))
-		return nil
 	})
 	if err != nil {
+		r.stopMonitor(key)
 		logger.Error(err, "start  monitor error")
 		return ctrl.Result{}, err
 	}
@@ -103,30 +179,200 @@ func (r *monitorReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ct
 	return ctrl.Result{}, nil
 }
 
-func (r *monitorReconciler) forward(logger logr.Logger, slist *types.SampleList) {
+// gatherTimeout bounds a gather of monitor, its spec.timeout or else its period.
+func gatherTimeout(monitor *kubemonitoriov1.Monitor) time.Duration {
+	if monitor.Spec.Timeout != nil && monitor.Spec.Timeout.Duration > 0 {
+		return monitor.Spec.Timeout.Duration
+	}
+	return monitor.Spec.Period.Duration
+}
+
+// newProcessor builds the processor of the samples gathered by monitor,
+// seriesLimit applies when the monitor does not set its own and budget caps all the monitors.
+func newProcessor(monitor *kubemonitoriov1.Monitor, seriesLimit int, budget *process.SeriesBudget) (*process.Processor, error) {
+	relabelCfgs, err := relabelConfigs(monitor.Spec.RelabelConfigs)
+	if err != nil {
+		return nil, fmt.Errorf("relabelConfigs: %w", err)
+	}
+	metricRelabelCfgs, err := relabelConfigs(monitor.Spec.MetricRelabelConfigs)
+	if err != nil {
+		return nil, fmt.Errorf("metricRelabelConfigs: %w", err)
+	}
+
+	opts := process.Options{
+		AdditionalLabels:     labels.MonitorLabels(monitor.Namespace, monitor.Name, monitor.Spec.Labels),
+		RelabelConfigs:       relabelCfgs,
+		MetricRelabelConfigs: metricRelabelCfgs,
+		SeriesLimit:          seriesLimit,
+		SeriesBudget:         budget,
+		Name:                 client.ObjectKeyFromObject(monitor).String(),
+	}
+	if monitor.Spec.SeriesLimit > 0 {
+		opts.SeriesLimit = monitor.Spec.SeriesLimit
+	}
+	if len(monitor.Spec.MetricsInclude) > 0 || len(monitor.Spec.MetricsExclude) > 0 {
+		opts.MetricsFilter, err = filter.NewIncludeExcludeFilter(monitor.Spec.MetricsInclude, monitor.Spec.MetricsExclude)
+		if err != nil {
+			return nil, fmt.Errorf("metricsInclude/metricsExclude: %w", err)
+		}
+	}
+	for i, mapping := range monitor.Spec.ValueMappings {
+		valueMapping, err := newValueMapping(mapping)
+		if err != nil {
+			return nil, fmt.Errorf("valueMappings %d: %w", i, err)
+		}
+		opts.ValueMappings = append(opts.ValueMappings, valueMapping)
+	}
+
+	return process.NewProcessor(opts), nil
+}
+
+func newValueMapping(mapping kubemonitoriov1.ValueMapping) (process.ValueMapping, error) {
+	metrics, err := filter.Compile(mapping.Metrics)
+	if err != nil {
+		return process.ValueMapping{}, err
+	}
+	if metrics == nil {
+		return process.ValueMapping{}, fmt.Errorf("metrics is empty")
+	}
+
+	mappings := make(map[string]float64, len(mapping.Mappings))
+	for k, v := range mapping.Mappings {
+		f, err := strconv.ParseFloat(v, 64)
+		if err != nil {
+			return process.ValueMapping{}, fmt.Errorf("mapping %q: %w", k, err)
+		}
+		mappings[k] = f
+	}
+	return process.ValueMapping{Metrics: metrics, Mappings: mappings}, nil
+}
+
+// forward writes the samples to the writers and returns how many were written.
+func (r *monitorReconciler) forward(logger logr.Logger, source writer.Source, slist *types.SampleList) int {
 	if slist == nil {
 		logger.Error(fmt.Errorf("data nil"), "")
-		return
+		return 0
 	}
 	arr := slist.PopBackAll()
-	r.wm.WriteSamples(arr)
+	r.wm.WriteSamples(source, arr)
 	logger.Info("write samples success", "len", len(arr))
 	//printTestMetrics(arr)
+	return len(arr)
+}
+
+// runningMonitor is a started monitor and the spec generation and resolved config it was started with.
+type runningMonitor struct {
+	handler    gatherer
+	processor  *process.Processor
+	generation int64
+	configHash string
+
+	// source routes the samples to the PrometheusPushes selecting the monitor
+	lock   sync.Mutex
+	source writer.Source
+}
+
+func (m *runningMonitor) getSource() writer.Source {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	return m.source
+}
+
+func (m *runningMonitor) setSource(source writer.Source) {
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	m.source = source
 }
 
-func NewMonitorReconciler(client client.Client, Scheme *runtime.Scheme, wm writer.WritersManager, worker worker.Worker, factory *input.SharedHandlerFactory) *monitorReconciler {
+func monitorSource(monitor *kubemonitoriov1.Monitor) writer.Source {
+	return writer.Source{Namespace: monitor.Namespace, Name: monitor.Name, Labels: monitor.Labels}
+}
+
+func (r *monitorReconciler) running(key string) *runningMonitor {
+	running, ok := r.monitors.Load(key)
+	if !ok {
+		return nil
+	}
+	return running.(*runningMonitor)
+}
+
+// newGatherer starts the handler of the model, or the discovery of the targets when the monitor selects them.
+func (r *monitorReconciler) newGatherer(monitor *kubemonitoriov1.Monitor, config input.ConfigMap) (gatherer, error) {
+	if monitor.Spec.TargetSelector != nil {
+		return newTargetGatherer(r.Client, r.factory, monitor, config, r.targetNamespaces)
+	}
+	handler, err := r.factory.New(monitor.Spec.Model.Name, config)
+	if err != nil {
+		return nil, err
+	}
+	return handler, nil
+}
+
+// stopMonitor stops the worker of a monitor and releases its handler.
+func (r *monitorReconciler) stopMonitor(key string) {
+	r.worker.Stop(key)
+	if running, ok := r.monitors.LoadAndDelete(key); ok {
+		running.(*runningMonitor).handler.Drop()
+		running.(*runningMonitor).processor.Release()
+		r.wm.Forget(running.(*runningMonitor).getSource())
+	}
+}
+
+// shardID returns the shard of the replica, empty when not sharding.
+func (r *monitorReconciler) shardID() string {
+	if r.sharder == nil {
+		return ""
+	}
+	return r.sharder.ID()
+}
+
+func NewMonitorReconciler(client client.Client, Scheme *runtime.Scheme, wm writer.WritersManager, worker worker.Worker, factory *input.Registry, seriesLimit int, seriesBudget *process.SeriesBudget, targetNamespaces []string, sharder *shard.Sharder) *monitorReconciler {
 	return &monitorReconciler{
-		worker:  worker,
-		Client:  client,
-		Scheme:  Scheme,
-		wm:      wm,
-		factory: factory,
+		worker:           worker,
+		Client:           client,
+		Scheme:           Scheme,
+		wm:               wm,
+		factory:          factory,
+		seriesLimit:      seriesLimit,
+		seriesBudget:     seriesBudget,
+		targetNamespaces: targetNamespaces,
+		sharder:          sharder,
+	}
+}
+
+// monitorsReferencing returns a map func enqueuing the monitors whose configFrom references the object.
+func (r *monitorReconciler) monitorsReferencing(index string) handler.MapFunc {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		monitors := &kubemonitoriov1.MonitorList{}
+		if err := r.List(ctx, monitors, client.InNamespace(obj.GetNamespace()), client.MatchingFields{index: obj.GetName()}); err != nil {
+			log.FromContext(ctx).Error(err, "list monitors referencing object error", "object", client.ObjectKeyFromObject(obj))
+			return nil
+		}
+		requests := make([]reconcile.Request, 0, len(monitors.Items))
+		for _, monitor := range monitors.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&monitor)})
+		}
+		return requests
 	}
 }
 
 // SetupWithManager sets up the controller with the Manager.
 func (r *monitorReconciler) SetupWithManager(mgr ctrl.Manager) error {
-	return ctrl.NewControllerManagedBy(mgr).
-		For(&kubemonitoriov1.Monitor{}).
-		Complete(r)
+	ctx := context.Background()
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &kubemonitoriov1.Monitor{}, monitorSecretsIndex, referencedSecrets); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &kubemonitoriov1.Monitor{}, monitorConfigMapsIndex, referencedConfigMaps); err != nil {
+		return err
+	}
+
+	b := ctrl.NewControllerManagedBy(mgr).
+		For(&kubemonitoriov1.Monitor{}, builder.WithPredicates(predicate.Or(predicate.GenerationChangedPredicate{}, predicate.LabelChangedPredicate{}, predicate.AnnotationChangedPredicate{}))).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.monitorsReferencing(monitorSecretsIndex))).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.monitorsReferencing(monitorConfigMapsIndex)))
+	if r.sharder != nil {
+		// the monitors move between the replicas when the shards change
+		b = b.WatchesRawSource(&source.Channel{Source: r.sharder.Events()}, &handler.EnqueueRequestForObject{})
+	}
+	return b.Complete(r)
 }
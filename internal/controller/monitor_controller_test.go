@@ -0,0 +1,259 @@
+package controller
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	. "github.com/onsi/ginkgo/v2"
+	. "github.com/onsi/gomega"
+	"github.com/prometheus/prometheus/prompb"
+	corev1 "k8s.io/api/core/v1"
+	"k8s.io/apimachinery/pkg/api/meta"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/types"
+	"k8s.io/client-go/kubernetes/scheme"
+	ctrl "sigs.k8s.io/controller-runtime"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kubemonitoriov1 "github.com/noovertime7/kubemonitor/api/v1"
+	"github.com/noovertime7/kubemonitor/internal/labels"
+	"github.com/noovertime7/kubemonitor/internal/writer"
+	"github.com/noovertime7/kubemonitor/pkg/input"
+	monitortypes "github.com/noovertime7/kubemonitor/pkg/types"
+	"github.com/noovertime7/kubemonitor/pkg/worker"
+)
+
+const fakeModel = "fake"
+
+// fakeHandler pushes a single sample per gather.
+type fakeHandler struct {
+	onInit func(config input.ConfigMap)
+}
+
+func (f *fakeHandler) Name() string { return fakeModel }
+func (f *fakeHandler) Drop()        {}
+
+func (f *fakeHandler) Init(config input.ConfigMap) error {
+	f.onInit(config)
+	return nil
+}
+
+func (f *fakeHandler) Gather(ctx context.Context, slist *monitortypes.SampleList) error {
+	slist.PushSample(fakeModel, "up", 1)
+	return nil
+}
+
+// fakeWritersManager records the samples written by the reconcilers.
+type fakeWritersManager struct {
+	lock    sync.Mutex
+	samples []*monitortypes.Sample
+}
+
+func (f *fakeWritersManager) Register(name string, opt writer.WriterOption) error { return nil }
+func (f *fakeWritersManager) DeRegister(name string) error                        { return nil }
+func (f *fakeWritersManager) QueueMetrics() *writer.Snapshot                      { return &writer.Snapshot{} }
+func (f *fakeWritersManager) WriteTimeSeries(timeSeries []prompb.TimeSeries)      {}
+func (f *fakeWritersManager) DestinationMetrics() map[string]writer.Snapshot      { return nil }
+func (f *fakeWritersManager) Close() error                                        { return nil }
+func (f *fakeWritersManager) Forget(source writer.Source)                         {}
+
+func (f *fakeWritersManager) WriteSamples(source writer.Source, samples []*monitortypes.Sample) {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+	f.samples = append(f.samples, samples...)
+}
+
+// namespacesOf returns the monitor namespaces seen on samples of monitors named name.
+func (f *fakeWritersManager) namespacesOf(name string) []string {
+	f.lock.Lock()
+	defer f.lock.Unlock()
+
+	seen := map[string]bool{}
+	var namespaces []string
+	for _, s := range f.samples {
+		ns := s.Labels[labels.MonitorNamespace]
+		if s.Labels[labels.MonitorName] != name || seen[ns] {
+			continue
+		}
+		seen[ns] = true
+		namespaces = append(namespaces, ns)
+	}
+	return namespaces
+}
+
+var _ = Describe("Monitor controller", func() {
+	const monitorName = "mysql"
+
+	var (
+		ctx        context.Context
+		wm         *fakeWritersManager
+		wker       worker.Worker
+		reconciler *monitorReconciler
+		// lastConfig is the config the last handler was initialised with
+		lastConfig input.ConfigMap
+	)
+
+	newMonitor := func(namespace string) *kubemonitoriov1.Monitor {
+		return &kubemonitoriov1.Monitor{
+			ObjectMeta: metav1.ObjectMeta{Name: monitorName, Namespace: namespace},
+			Spec: kubemonitoriov1.MonitorSpec{
+				Model:  kubemonitoriov1.Model{Name: fakeModel, Config: map[string]string{}},
+				Period: metav1.Duration{Duration: time.Hour},
+			},
+		}
+	}
+
+	reconcile := func(namespace string) {
+		_, err := reconciler.Reconcile(ctx, ctrl.Request{NamespacedName: types.NamespacedName{Namespace: namespace, Name: monitorName}})
+		Expect(err).NotTo(HaveOccurred())
+	}
+
+	BeforeEach(func() {
+		ctx = context.Background()
+		wm = &fakeWritersManager{}
+		wker = worker.NewWorker()
+
+		registry := input.NewRegistry()
+		registry.Register(fakeModel, func() input.HandlerFactory {
+			return &fakeHandler{onInit: func(config input.ConfigMap) {
+				lastConfig = config
+			}}
+		})
+		reconciler = NewMonitorReconciler(k8sClient, scheme.Scheme, wm, wker, registry, 0, nil, nil, nil)
+	})
+
+	AfterEach(func() {
+		wker.StopAll()
+	})
+
+	Context("with same-named monitors in different namespaces", func() {
+		namespaces := []string{"team-a", "team-b"}
+
+		BeforeEach(func() {
+			for _, ns := range namespaces {
+				err := k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: ns}})
+				Expect(client.IgnoreAlreadyExists(err)).NotTo(HaveOccurred())
+				Expect(k8sClient.Create(ctx, newMonitor(ns))).To(Succeed())
+			}
+		})
+
+		AfterEach(func() {
+			for _, ns := range namespaces {
+				err := k8sClient.Delete(ctx, newMonitor(ns))
+				Expect(client.IgnoreNotFound(err)).NotTo(HaveOccurred())
+			}
+		})
+
+		It("runs one worker per monitor and labels samples with the monitor namespace", func() {
+			for _, ns := range namespaces {
+				reconcile(ns)
+			}
+
+			Expect(wker.Exist("team-a/mysql")).To(BeTrue())
+			Expect(wker.Exist("team-b/mysql")).To(BeTrue())
+			Eventually(func() []string {
+				return wm.namespacesOf(monitorName)
+			}).Should(ConsistOf(namespaces))
+		})
+
+		It("reports the result of the last gather in the status", func() {
+			reconcile("team-a")
+
+			Eventually(func(g Gomega) {
+				monitor := &kubemonitoriov1.Monitor{}
+				g.Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: "team-a", Name: monitorName}, monitor)).To(Succeed())
+				g.Expect(monitor.Status.SamplesLastGather).To(Equal(1))
+				g.Expect(monitor.Status.LastSuccessfulGather).NotTo(BeNil())
+				g.Expect(meta.IsStatusConditionTrue(monitor.Status.Conditions, kubemonitoriov1.MonitorReady)).To(BeTrue())
+				g.Expect(meta.IsStatusConditionFalse(monitor.Status.Conditions, kubemonitoriov1.MonitorDegraded)).To(BeTrue())
+			}).Should(Succeed())
+		})
+
+		It("restarts the worker of an edited monitor only", func() {
+			for _, ns := range namespaces {
+				reconcile(ns)
+			}
+			other := reconciler.running("team-b/mysql")
+			Expect(other).NotTo(BeNil())
+
+			monitor := &kubemonitoriov1.Monitor{}
+			Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: "team-a", Name: monitorName}, monitor)).To(Succeed())
+			monitor.Spec.Period = metav1.Duration{Duration: 2 * time.Hour}
+			monitor.Spec.Model.Config = map[string]string{"host": "db:3306"}
+			Expect(k8sClient.Update(ctx, monitor)).To(Succeed())
+
+			lastConfig = nil
+			reconcile("team-a")
+
+			Expect(lastConfig).To(Equal(input.ConfigMap{"host": "db:3306"}))
+			Expect(wker.Exist("team-a/mysql")).To(BeTrue())
+			Expect(reconciler.running("team-a/mysql").generation).To(Equal(monitor.Generation))
+			Expect(reconciler.running("team-b/mysql")).To(BeIdenticalTo(other))
+			Eventually(func(g Gomega) {
+				updated := &kubemonitoriov1.Monitor{}
+				g.Expect(k8sClient.Get(ctx, types.NamespacedName{Namespace: "team-a", Name: monitorName}, updated)).To(Succeed())
+				g.Expect(updated.Status.ObservedGeneration).To(Equal(monitor.Generation))
+			}).Should(Succeed())
+		})
+
+		It("keeps the other monitor running when one is deleted", func() {
+			for _, ns := range namespaces {
+				reconcile(ns)
+			}
+
+			Expect(k8sClient.Delete(ctx, newMonitor("team-a"))).To(Succeed())
+			reconcile("team-a")
+
+			Expect(wker.Exist("team-a/mysql")).To(BeFalse())
+			Expect(wker.Exist("team-b/mysql")).To(BeTrue())
+		})
+	})
+
+	Context("with config sourced from a secret", func() {
+		const namespace = "team-c"
+
+		secret := func(password string) *corev1.Secret {
+			return &corev1.Secret{
+				ObjectMeta: metav1.ObjectMeta{Name: "mysql-credentials", Namespace: namespace},
+				Data:       map[string][]byte{"password": []byte(password)},
+			}
+		}
+
+		BeforeEach(func() {
+			err := k8sClient.Create(ctx, &corev1.Namespace{ObjectMeta: metav1.ObjectMeta{Name: namespace}})
+			Expect(client.IgnoreAlreadyExists(err)).NotTo(HaveOccurred())
+			Expect(k8sClient.Create(ctx, secret("old"))).To(Succeed())
+
+			monitor := newMonitor(namespace)
+			monitor.Spec.Model.Config = map[string]string{"username": "root", "password": "plain"}
+			monitor.Spec.Model.ConfigFrom = []kubemonitoriov1.ConfigFrom{{
+				Key: "password",
+				ValueFrom: kubemonitoriov1.ValueSource{SecretKeyRef: &corev1.SecretKeySelector{
+					LocalObjectReference: corev1.LocalObjectReference{Name: "mysql-credentials"},
+					Key:                  "password",
+				}},
+			}}
+			Expect(k8sClient.Create(ctx, monitor)).To(Succeed())
+		})
+
+		AfterEach(func() {
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, newMonitor(namespace)))).To(Succeed())
+			Expect(client.IgnoreNotFound(k8sClient.Delete(ctx, secret("")))).To(Succeed())
+		})
+
+		It("initialises the handler with the secret value and restarts it on rotation", func() {
+			reconcile(namespace)
+			Expect(lastConfig).To(Equal(input.ConfigMap{"username": "root", "password": "old"}))
+
+			lastConfig = nil
+			reconcile(namespace)
+			Expect(lastConfig).To(BeNil())
+
+			Expect(k8sClient.Update(ctx, secret("new"))).To(Succeed())
+			reconcile(namespace)
+			Expect(lastConfig).To(Equal(input.ConfigMap{"username": "root", "password": "new"}))
+			Expect(wker.Exist(namespace + "/mysql")).To(BeTrue())
+		})
+	})
+})
@@ -2,9 +2,11 @@ package controller
 
 import (
 	"context"
+	"fmt"
 	kubemonitoriov1 "github.com/noovertime7/kubemonitor/api/v1"
 	"github.com/noovertime7/kubemonitor/pkg/worker"
 	"github.com/sirupsen/logrus"
+	"k8s.io/apimachinery/pkg/api/meta"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/client-go/util/retry"
 	"sigs.k8s.io/controller-runtime/pkg/client"
@@ -15,29 +17,56 @@ type monitorWorker struct {
 	client  client.Client
 	monitor *kubemonitoriov1.Monitor
 	worker  worker.Worker
+	// shard is the shard of the replica gathering the monitor, recorded in the status
+	shard string
 }
 
-func NewMonitorWorker(c client.Client, m *kubemonitoriov1.Monitor, w worker.Worker) *monitorWorker {
+func NewMonitorWorker(c client.Client, m *kubemonitoriov1.Monitor, w worker.Worker, shard string) *monitorWorker {
 	return &monitorWorker{
 		client:  c,
 		monitor: m,
 		worker:  w,
+		shard:   shard,
 	}
 }
 
-func (m *monitorWorker) RunAfterPatchStatus(ctx context.Context, name string, period time.Duration, f func() error) error {
-	if err := m.worker.Run(name, period, func() {
-		err := f()
-		if err != nil {
+// readyFailureThreshold is the number of consecutive failed gathers after which a monitor is no longer Ready
+const readyFailureThreshold = 3
+
+// maxStatusErrorLength bounds the error messages written to the status
+const maxStatusErrorLength = 1024
+
+// gatherResult is the outcome of a single gather of a monitor.
+type gatherResult struct {
+	duration time.Duration
+	samples  int
+	// limitedSeries is the number of series dropped over seriesLimit
+	limitedSeries int
+	seriesLimit   int
+	err           error
+}
+
+// RunAfterPatchStatus runs f every period and records its result in the status, f gets a ctx
+// cancelled after timeout or once the monitor is stopped.
+func (m *monitorWorker) RunAfterPatchStatus(ctx context.Context, name string, period, timeout time.Duration, f func(ctx context.Context) gatherResult) error {
+	if err := m.worker.Run(name, m.monitor.Spec.Model.Name, period, func(workerCtx context.Context) {
+		gatherCtx, cancel := context.WithTimeout(workerCtx, timeout)
+		result := f(gatherCtx)
+		cancel()
+		if workerCtx.Err() != nil {
+			// the monitor was stopped during the gather, its status belongs to the next worker
+			return
+		}
+		if result.err != nil {
 			logrus.WithFields(map[string]interface{}{
-				"name": m.monitor.Name,
-			}).Errorf("work error: %v", err)
+				"name": name,
+			}).Errorf("work error: %v", result.err)
 		}
 
-		err = m.UpdateStatus(ctx, time.Now())
+		err := m.UpdateStatus(ctx, time.Now(), result)
 		if err != nil {
 			logrus.WithFields(map[string]interface{}{
-				"name": m.monitor.Name,
+				"name": name,
 			}).Errorf("update status error: %v", err)
 		}
 	}); err != nil {
@@ -46,17 +75,123 @@ func (m *monitorWorker) RunAfterPatchStatus(ctx context.Context, name string, pe
 	return nil
 }
 
-func (m *monitorWorker) UpdateStatus(ctx context.Context, pushTime time.Time) error {
+// UpdateStatus records the result of a gather finished at now.
+func (m *monitorWorker) UpdateStatus(ctx context.Context, now time.Time, result gatherResult) error {
+	return m.updateStatus(ctx, func(status *kubemonitoriov1.MonitorStatus) {
+		status.ObservedGeneration = m.monitor.Generation
+		status.Shard = m.shard
+		status.LastGatherDuration = &metav1.Duration{Duration: result.duration}
+		status.SamplesLastGather = result.samples
+		if result.samples > 0 {
+			status.LastPush = metav1.Time{Time: now}
+		}
+
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               kubemonitoriov1.MonitorGathering,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: m.monitor.Generation,
+			Reason:             "WorkerRunning",
+			Message:            "the monitor worker is running",
+		})
+
+		status.LimitedSeries = result.limitedSeries
+		if result.limitedSeries > 0 {
+			meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+				Type:               kubemonitoriov1.MonitorCardinalityLimited,
+				Status:             metav1.ConditionTrue,
+				ObservedGeneration: m.monitor.Generation,
+				Reason:             "SeriesLimitExceeded",
+				Message:            fmt.Sprintf("%d series dropped over the limit of %d series", result.limitedSeries, result.seriesLimit),
+			})
+		} else {
+			meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+				Type:               kubemonitoriov1.MonitorCardinalityLimited,
+				Status:             metav1.ConditionFalse,
+				ObservedGeneration: m.monitor.Generation,
+				Reason:             "WithinSeriesLimit",
+				Message:            "the last gather was within the series limit",
+			})
+		}
+
+		if result.err == nil {
+			status.LastSuccessfulGather = &metav1.Time{Time: now}
+			status.ConsecutiveFailures = 0
+			status.LastError = ""
+			meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+				Type:               kubemonitoriov1.MonitorReady,
+				Status:             metav1.ConditionTrue,
+				ObservedGeneration: m.monitor.Generation,
+				Reason:             "GatherSucceeded",
+				Message:            "the last gather succeeded",
+			})
+			meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+				Type:               kubemonitoriov1.MonitorDegraded,
+				Status:             metav1.ConditionFalse,
+				ObservedGeneration: m.monitor.Generation,
+				Reason:             "GatherSucceeded",
+				Message:            "the last gather succeeded",
+			})
+			return
+		}
+
+		status.ConsecutiveFailures++
+		status.LastError = statusError(result.err)
+		meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+			Type:               kubemonitoriov1.MonitorDegraded,
+			Status:             metav1.ConditionTrue,
+			ObservedGeneration: m.monitor.Generation,
+			Reason:             "GatherFailed",
+			Message:            status.LastError,
+		})
+		if status.ConsecutiveFailures >= readyFailureThreshold || status.LastSuccessfulGather == nil {
+			meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+				Type:               kubemonitoriov1.MonitorReady,
+				Status:             metav1.ConditionFalse,
+				ObservedGeneration: m.monitor.Generation,
+				Reason:             "GatherFailed",
+				Message:            fmt.Sprintf("%d consecutive gathers failed: %s", status.ConsecutiveFailures, status.LastError),
+			})
+		}
+	})
+}
+
+// UpdateInitFailedStatus records that the handler of the monitor could not be started.
+func (m *monitorWorker) UpdateInitFailedStatus(ctx context.Context, initErr error) error {
+	return m.updateStatus(ctx, func(status *kubemonitoriov1.MonitorStatus) {
+		status.ObservedGeneration = m.monitor.Generation
+		status.Shard = m.shard
+		status.LastError = statusError(initErr)
+		for _, conditionType := range []string{kubemonitoriov1.MonitorReady, kubemonitoriov1.MonitorGathering} {
+			meta.SetStatusCondition(&status.Conditions, metav1.Condition{
+				Type:               conditionType,
+				Status:             metav1.ConditionFalse,
+				ObservedGeneration: m.monitor.Generation,
+				Reason:             "InitFailed",
+				Message:            status.LastError,
+			})
+		}
+	})
+}
+
+func (m *monitorWorker) updateStatus(ctx context.Context, mutate func(status *kubemonitoriov1.MonitorStatus)) error {
 	monitor := &kubemonitoriov1.Monitor{}
 	return retry.RetryOnConflict(retry.DefaultBackoff, func() error {
 		if err := m.client.Get(ctx, client.ObjectKeyFromObject(m.monitor), monitor); err != nil {
 			return err
 		}
-		monitor.Status = kubemonitoriov1.MonitorStatus{LastPush: metav1.Time{Time: pushTime}}
+		mutate(&monitor.Status)
 		return m.client.Status().Update(ctx, monitor)
 	})
 }
 
+func statusError(err error) string {
+	msg := err.Error()
+	if len(msg) > maxStatusErrorLength {
+		msg = msg[:maxStatusErrorLength] + "..."
+	}
+	return msg
+}
+
 func (m *monitorWorker) AddWorkerTask(name string) {
 	m.worker.AddWorkerTask(name)
 }
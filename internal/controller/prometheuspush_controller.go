@@ -18,13 +18,18 @@ package controller
 
 import (
 	"context"
+	"fmt"
 	"github.com/noovertime7/kubemonitor/internal/writer"
 
+	corev1 "k8s.io/api/core/v1"
 	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/runtime"
 	ctrl "sigs.k8s.io/controller-runtime"
 	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/handler"
 	"sigs.k8s.io/controller-runtime/pkg/log"
+	"sigs.k8s.io/controller-runtime/pkg/reconcile"
 
 	kubemonitoriov1 "github.com/noovertime7/kubemonitor/api/v1"
 )
@@ -47,16 +52,18 @@ func NewPrometheusPushReconciler(client client.Client, Scheme *runtime.Scheme, w
 //+kubebuilder:rbac:groups=kubemonitor.io.kubemonitor.io,resources=prometheuspushes,verbs=get;list;watch;create;update;patch;delete
 //+kubebuilder:rbac:groups=kubemonitor.io.kubemonitor.io,resources=prometheuspushes/status,verbs=get;update;patch
 //+kubebuilder:rbac:groups=kubemonitor.io.kubemonitor.io,resources=prometheuspushes/finalizers,verbs=update
+//+kubebuilder:rbac:groups="",resources=secrets;configmaps,verbs=get;list;watch
 
 func (r *prometheusPushReconciler) Reconcile(ctx context.Context, req ctrl.Request) (ctrl.Result, error) {
 	logger := log.FromContext(ctx).WithValues("controller", PrometheusPush)
+	key := req.NamespacedName.String()
 
 	original := &kubemonitoriov1.PrometheusPush{}
 	err := r.Client.Get(ctx, req.NamespacedName, original)
 	if err != nil {
 		if apierrors.IsNotFound(err) {
 			logger.Info("PrometheusPush not found")
-			if err = r.wm.DeRegister(req.Name); err != nil {
+			if err = r.wm.DeRegister(key); err != nil {
 				logger.Error(err, "DeRegister error,will retry...")
 				return ctrl.Result{}, err
 			}
@@ -66,27 +73,144 @@ func (r *prometheusPushReconciler) Reconcile(ctx context.Context, req ctrl.Reque
 		return ctrl.Result{}, err
 	}
 
-	err = r.wm.Register(req.Name, writer.WriterOption{
-		Url:                 original.Spec.Url,
-		BasicAuthUser:       original.Spec.BasicAuthUser,
-		BasicAuthPass:       original.Spec.BasicAuthPass,
-		Headers:             original.Spec.Headers,
-		Timeout:             original.Spec.Timeout,
-		DialTimeout:         original.Spec.DialTimeout,
-		MaxIdleConnsPerHost: original.Spec.MaxIdleConnsPerHost,
-	})
+	opt, err := r.writerOption(ctx, original)
+	if err != nil {
+		logger.Error(err, "resolve writer option error")
+		return ctrl.Result{}, err
+	}
+
+	err = r.wm.Register(key, opt)
 	if err != nil {
 		logger.Error(err, "register error")
 		return ctrl.Result{}, err
 	}
-	logger.Info("register writer success", "name", req.Name)
+	logger.Info("register writer success", "name", key)
 
 	return ctrl.Result{}, nil
 }
 
+// writerOption builds the writer option of push, resolving the values sourced from Secrets and ConfigMaps.
+func (r *prometheusPushReconciler) writerOption(ctx context.Context, push *kubemonitoriov1.PrometheusPush) (writer.WriterOption, error) {
+	spec := push.Spec
+	opt := writer.WriterOption{
+		Type:                string(spec.Type),
+		Url:                 spec.Url,
+		BasicAuthUser:       spec.BasicAuthUser,
+		BasicAuthPass:       spec.BasicAuthPass,
+		Headers:             spec.Headers,
+		Timeout:             spec.Timeout,
+		DialTimeout:         spec.DialTimeout,
+		MaxIdleConnsPerHost: spec.MaxIdleConnsPerHost,
+		MaxRetries:          spec.MaxRetries,
+		Batch:               spec.Batch,
+		Concurrency:         spec.Concurrency,
+		MonitorNamespaces:   spec.MonitorNamespaces,
+	}
+
+	if spec.MonitorSelector != nil {
+		selector, err := metav1.LabelSelectorAsSelector(spec.MonitorSelector)
+		if err != nil {
+			return opt, fmt.Errorf("monitor_selector: %w", err)
+		}
+		opt.MonitorSelector = selector
+	}
+
+	var err error
+	if spec.BasicAuthPassFrom != nil {
+		if opt.BasicAuthPass, err = resolveOptionalValue(ctx, r.Client, push.Namespace, spec.BasicAuthPassFrom); err != nil {
+			return opt, fmt.Errorf("basic_auth_pass_from: %w", err)
+		}
+	}
+	if opt.BearerToken, err = resolveOptionalValue(ctx, r.Client, push.Namespace, spec.BearerTokenFrom); err != nil {
+		return opt, fmt.Errorf("bearer_token_from: %w", err)
+	}
+
+	if otlp := spec.OTLP; otlp != nil {
+		opt.OTLP = writer.OTLPOption{ResourceLabels: otlp.ResourceLabels, Gzip: otlp.Gzip}
+	}
+
+	if kafka := spec.Kafka; kafka != nil {
+		opt.Kafka = writer.KafkaOption{
+			Brokers:        kafka.Brokers,
+			Topic:          kafka.Topic,
+			PartitionKey:   kafka.PartitionKey,
+			PartitionLabel: kafka.PartitionLabel,
+			Format:         kafka.Format,
+			Compression:    kafka.Compression,
+			TLS:            kafka.TLS,
+		}
+		if saslConfig := kafka.SASL; saslConfig != nil {
+			opt.Kafka.SASLMechanism = saslConfig.Mechanism
+			opt.Kafka.SASLUsername = saslConfig.Username
+			if opt.Kafka.SASLPassword, err = resolveOptionalValue(ctx, r.Client, push.Namespace, saslConfig.PasswordFrom); err != nil {
+				return opt, fmt.Errorf("kafka.sasl.password_from: %w", err)
+			}
+		}
+	}
+
+	if influx := spec.Influx; influx != nil {
+		opt.Influx = writer.InfluxOption{
+			Database:        influx.Database,
+			RetentionPolicy: influx.RetentionPolicy,
+			Bucket:          influx.Bucket,
+			Org:             influx.Org,
+			Measurement:     influx.Measurement,
+			Gzip:            influx.Gzip,
+		}
+		if opt.Influx.Token, err = resolveOptionalValue(ctx, r.Client, push.Namespace, influx.TokenFrom); err != nil {
+			return opt, fmt.Errorf("influx.token_from: %w", err)
+		}
+	}
+
+	if tlsConfig := spec.TLSConfig; tlsConfig != nil {
+		opt.TLSServerName = tlsConfig.ServerName
+		opt.TLSInsecureSkipVerify = tlsConfig.InsecureSkipVerify
+		if opt.TLSCA, err = resolveOptionalValue(ctx, r.Client, push.Namespace, tlsConfig.CA); err != nil {
+			return opt, fmt.Errorf("tls_config.ca: %w", err)
+		}
+		if opt.TLSCert, err = resolveOptionalValue(ctx, r.Client, push.Namespace, tlsConfig.Cert); err != nil {
+			return opt, fmt.Errorf("tls_config.cert: %w", err)
+		}
+		if tlsConfig.KeySecret != nil {
+			key := &kubemonitoriov1.ValueSource{SecretKeyRef: tlsConfig.KeySecret}
+			if opt.TLSKey, err = resolveOptionalValue(ctx, r.Client, push.Namespace, key); err != nil {
+				return opt, fmt.Errorf("tls_config.key_secret: %w", err)
+			}
+		}
+	}
+
+	return opt, nil
+}
+
+// pushesReferencing returns a map func enqueuing the PrometheusPushes referencing the object.
+func (r *prometheusPushReconciler) pushesReferencing(index string) handler.MapFunc {
+	return func(ctx context.Context, obj client.Object) []reconcile.Request {
+		pushes := &kubemonitoriov1.PrometheusPushList{}
+		if err := r.List(ctx, pushes, client.InNamespace(obj.GetNamespace()), client.MatchingFields{index: obj.GetName()}); err != nil {
+			log.FromContext(ctx).Error(err, "list PrometheusPush referencing object error", "object", client.ObjectKeyFromObject(obj))
+			return nil
+		}
+		requests := make([]reconcile.Request, 0, len(pushes.Items))
+		for _, push := range pushes.Items {
+			requests = append(requests, reconcile.Request{NamespacedName: client.ObjectKeyFromObject(&push)})
+		}
+		return requests
+	}
+}
+
 // SetupWithManager sets up the controller with the Manager.
 func (r *prometheusPushReconciler) SetupWithManager(mgr ctrl.Manager) error {
+	ctx := context.Background()
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &kubemonitoriov1.PrometheusPush{}, pushSecretsIndex, pushReferencedSecrets); err != nil {
+		return err
+	}
+	if err := mgr.GetFieldIndexer().IndexField(ctx, &kubemonitoriov1.PrometheusPush{}, pushConfigMapsIndex, pushReferencedConfigMaps); err != nil {
+		return err
+	}
+
 	return ctrl.NewControllerManagedBy(mgr).
 		For(&kubemonitoriov1.PrometheusPush{}).
+		Watches(&corev1.Secret{}, handler.EnqueueRequestsFromMapFunc(r.pushesReferencing(pushSecretsIndex))).
+		Watches(&corev1.ConfigMap{}, handler.EnqueueRequestsFromMapFunc(r.pushesReferencing(pushConfigMapsIndex))).
 		Complete(r)
 }
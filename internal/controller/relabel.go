@@ -0,0 +1,56 @@
+package controller
+
+import (
+	"fmt"
+
+	"github.com/prometheus/prometheus/model/relabel"
+	"gopkg.in/yaml.v2"
+
+	kubemonitoriov1 "github.com/noovertime7/kubemonitor/api/v1"
+)
+
+// relabelConfigs converts the relabel configs of a monitor, going through the Prometheus
+// yaml unmarshalling so that defaults and validation match Prometheus.
+func relabelConfigs(cfgs []kubemonitoriov1.RelabelConfig) ([]*relabel.Config, error) {
+	if len(cfgs) == 0 {
+		return nil, nil
+	}
+
+	out := make([]*relabel.Config, 0, len(cfgs))
+	for i, cfg := range cfgs {
+		raw := map[string]interface{}{}
+		if len(cfg.SourceLabels) > 0 {
+			raw["source_labels"] = cfg.SourceLabels
+		}
+		if cfg.Separator != nil {
+			raw["separator"] = *cfg.Separator
+		}
+		if cfg.Regex != nil {
+			raw["regex"] = *cfg.Regex
+		}
+		if cfg.Modulus != 0 {
+			raw["modulus"] = cfg.Modulus
+		}
+		if cfg.TargetLabel != "" {
+			raw["target_label"] = cfg.TargetLabel
+		}
+		if cfg.Replacement != nil {
+			raw["replacement"] = *cfg.Replacement
+		}
+		raw["action"] = string(relabel.Replace)
+		if cfg.Action != "" {
+			raw["action"] = cfg.Action
+		}
+
+		data, err := yaml.Marshal(raw)
+		if err != nil {
+			return nil, err
+		}
+		c := &relabel.Config{}
+		if err := yaml.UnmarshalStrict(data, c); err != nil {
+			return nil, fmt.Errorf("relabel config %d: %w", i, err)
+		}
+		out = append(out, c)
+	}
+	return out, nil
+}
@@ -18,6 +18,7 @@ package controller
 
 import (
 	"fmt"
+	"os"
 	"path/filepath"
 	"runtime"
 	"testing"
@@ -66,6 +67,16 @@ var _ = BeforeSuite(func() {
 			fmt.Sprintf("1.28.0-%s-%s", runtime.GOOS, runtime.GOARCH)),
 	}
 
+	if os.Getenv("KUBEBUILDER_ASSETS") == "" {
+		if _, err := os.Stat(testEnv.BinaryAssetsDirectory); err != nil {
+			// the specs must not pass without running, skipping them is an explicit choice
+			if os.Getenv("SKIP_ENVTEST") != "" {
+				Skip("envtest binaries not found and SKIP_ENVTEST is set")
+			}
+			Fail("envtest binaries not found, run `make test` to install them or set SKIP_ENVTEST to skip the controller specs")
+		}
+	}
+
 	var err error
 	// cfg is defined in this file globally.
 	cfg, err = testEnv.Start()
@@ -84,6 +95,9 @@ var _ = BeforeSuite(func() {
 })
 
 var _ = AfterSuite(func() {
+	if cfg == nil {
+		return
+	}
 	By("tearing down the test environment")
 	err := testEnv.Stop()
 	Expect(err).NotTo(HaveOccurred())
@@ -0,0 +1,426 @@
+package controller
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"text/template"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+
+	kubemonitoriov1 "github.com/noovertime7/kubemonitor/api/v1"
+	"github.com/noovertime7/kubemonitor/pkg/input"
+	"github.com/noovertime7/kubemonitor/pkg/types"
+)
+
+// Target selector roles
+const (
+	targetRolePod           = "pod"
+	targetRoleService       = "service"
+	targetRoleEndpoints     = "endpoints"
+	targetRoleEndpointSlice = "endpointslice"
+)
+
+// maxTargetGathers bounds the targets of a monitor gathered at once.
+const maxTargetGathers = 16
+
+// Labels attached to the samples of a discovered target
+const (
+	targetLabelNamespace = "namespace"
+	targetLabelPod       = "pod"
+	targetLabelService   = "service"
+)
+
+// gatherer gathers the samples of a monitor, a single handler or one handler per discovered target.
+type gatherer interface {
+	Gather(ctx context.Context) (*types.SampleList, error)
+	Drop()
+}
+
+// target is a discovered endpoint of a monitor.
+type target struct {
+	host   string
+	port   string
+	labels map[string]string
+}
+
+func (t target) address() string {
+	return net.JoinHostPort(t.host, t.port)
+}
+
+// key identifies the target, its handler is kept while the key is discovered.
+func (t target) key() string {
+	keys := make([]string, 0, len(t.labels))
+	for k := range t.labels {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	var b strings.Builder
+	b.WriteString(t.address())
+	for _, k := range keys {
+		b.WriteString("," + k + "=" + t.labels[k])
+	}
+	return b.String()
+}
+
+// discoverTargets lists the targets selected by selector, namespace is the monitor namespace.
+func discoverTargets(ctx context.Context, c client.Reader, namespace string, selector *kubemonitoriov1.TargetSelector) ([]target, error) {
+	labelSelector, err := metav1.LabelSelectorAsSelector(&selector.Selector)
+	if err != nil {
+		return nil, err
+	}
+	namespaces := selector.Namespaces
+	if len(namespaces) == 0 {
+		namespaces = []string{namespace}
+	}
+
+	var targets []target
+	for _, ns := range namespaces {
+		opts := []client.ListOption{client.InNamespace(ns), client.MatchingLabelsSelector{Selector: labelSelector}}
+		switch selector.Role {
+		case targetRolePod:
+			pods := &corev1.PodList{}
+			if err := c.List(ctx, pods, opts...); err != nil {
+				return nil, err
+			}
+			targets = append(targets, podTargets(pods.Items, selector.Port)...)
+		case targetRoleService:
+			services := &corev1.ServiceList{}
+			if err := c.List(ctx, services, opts...); err != nil {
+				return nil, err
+			}
+			targets = append(targets, serviceTargets(services.Items, selector.Port)...)
+		case targetRoleEndpoints, "":
+			endpoints := &corev1.EndpointsList{}
+			if err := c.List(ctx, endpoints, opts...); err != nil {
+				return nil, err
+			}
+			targets = append(targets, endpointsTargets(endpoints.Items, selector.Port)...)
+		case targetRoleEndpointSlice:
+			slices := &discoveryv1.EndpointSliceList{}
+			if err := c.List(ctx, slices, opts...); err != nil {
+				return nil, err
+			}
+			targets = append(targets, endpointSliceTargets(slices.Items, selector.Port)...)
+		default:
+			return nil, fmt.Errorf("unknown target role %s", selector.Role)
+		}
+	}
+	return targets, nil
+}
+
+func podTargets(pods []corev1.Pod, port string) []target {
+	var targets []target
+	for _, pod := range pods {
+		if pod.Status.Phase != corev1.PodRunning || pod.Status.PodIP == "" || pod.DeletionTimestamp != nil {
+			continue
+		}
+		for _, container := range pod.Spec.Containers {
+			for _, containerPort := range container.Ports {
+				if !portMatches(port, containerPort.Name, containerPort.ContainerPort) {
+					continue
+				}
+				targets = append(targets, target{
+					host: pod.Status.PodIP,
+					port: strconv.Itoa(int(containerPort.ContainerPort)),
+					labels: map[string]string{
+						targetLabelNamespace: pod.Namespace,
+						targetLabelPod:       pod.Name,
+					},
+				})
+			}
+		}
+	}
+	return targets
+}
+
+func serviceTargets(services []corev1.Service, port string) []target {
+	var targets []target
+	for _, service := range services {
+		for _, servicePort := range service.Spec.Ports {
+			if !portMatches(port, servicePort.Name, servicePort.Port) {
+				continue
+			}
+			targets = append(targets, target{
+				host: service.Name + "." + service.Namespace + ".svc",
+				port: strconv.Itoa(int(servicePort.Port)),
+				labels: map[string]string{
+					targetLabelNamespace: service.Namespace,
+					targetLabelService:   service.Name,
+				},
+			})
+		}
+	}
+	return targets
+}
+
+// endpointsTargets returns the ready addresses of the endpoints.
+func endpointsTargets(endpoints []corev1.Endpoints, port string) []target {
+	var targets []target
+	for _, ep := range endpoints {
+		for _, subset := range ep.Subsets {
+			for _, endpointPort := range subset.Ports {
+				if !portMatches(port, endpointPort.Name, endpointPort.Port) {
+					continue
+				}
+				for _, address := range subset.Addresses {
+					labels := map[string]string{
+						targetLabelNamespace: ep.Namespace,
+						targetLabelService:   ep.Name,
+					}
+					if address.TargetRef != nil && address.TargetRef.Kind == "Pod" {
+						labels[targetLabelPod] = address.TargetRef.Name
+					}
+					targets = append(targets, target{
+						host:   address.IP,
+						port:   strconv.Itoa(int(endpointPort.Port)),
+						labels: labels,
+					})
+				}
+			}
+		}
+	}
+	return targets
+}
+
+// endpointSliceTargets returns the ready endpoints of the slices, the service is the one owning the slice.
+func endpointSliceTargets(slices []discoveryv1.EndpointSlice, port string) []target {
+	var targets []target
+	for _, slice := range slices {
+		for _, slicePort := range slice.Ports {
+			if slicePort.Port == nil {
+				continue
+			}
+			var name string
+			if slicePort.Name != nil {
+				name = *slicePort.Name
+			}
+			if !portMatches(port, name, *slicePort.Port) {
+				continue
+			}
+			for _, endpoint := range slice.Endpoints {
+				if endpoint.Conditions.Ready != nil && !*endpoint.Conditions.Ready {
+					continue
+				}
+				labels := map[string]string{targetLabelNamespace: slice.Namespace}
+				if service := slice.Labels[discoveryv1.LabelServiceName]; service != "" {
+					labels[targetLabelService] = service
+				}
+				if endpoint.TargetRef != nil && endpoint.TargetRef.Kind == "Pod" {
+					labels[targetLabelPod] = endpoint.TargetRef.Name
+				}
+				for _, address := range endpoint.Addresses {
+					targets = append(targets, target{
+						host:   address,
+						port:   strconv.Itoa(int(*slicePort.Port)),
+						labels: labels,
+					})
+				}
+			}
+		}
+	}
+	return targets
+}
+
+// namespacesAllowed returns an error naming the first of namespaces that is neither the monitor
+// namespace nor allowed, allowed "*" allows any.
+func namespacesAllowed(namespace string, namespaces, allowed []string) error {
+	for _, ns := range namespaces {
+		if ns == namespace {
+			continue
+		}
+		ok := false
+		for _, a := range allowed {
+			if a == "*" || a == ns {
+				ok = true
+				break
+			}
+		}
+		if !ok {
+			return fmt.Errorf("namespace %s is not allowed, the operator --target-namespaces does not include it", ns)
+		}
+	}
+	return nil
+}
+
+// portMatches reports whether the port named name with number matches the selector port, a name or a number.
+func portMatches(port, name string, number int32) bool {
+	if port == name {
+		return true
+	}
+	return port == strconv.Itoa(int(number))
+}
+
+// targetGatherer gathers every target discovered by the selector of a monitor, the targets are
+// discovered again before every gather so that the handlers follow the scaling of the workloads.
+type targetGatherer struct {
+	client    client.Reader
+	factory   *input.Registry
+	namespace string
+	model     string
+	config    input.ConfigMap
+	selector  *kubemonitoriov1.TargetSelector
+	format    *template.Template
+
+	lock     sync.Mutex
+	handlers map[string]*input.Handler
+}
+
+// newTargetGatherer returns the gatherer of the targets selected by monitor, the selector may only
+// discover targets in the monitor namespace and in the allowed ones.
+func newTargetGatherer(c client.Reader, factory *input.Registry, monitor *kubemonitoriov1.Monitor, config input.ConfigMap, allowed []string) (*targetGatherer, error) {
+	selector := monitor.Spec.TargetSelector
+	if !factory.Supported(monitor.Spec.Model.Name) {
+		return nil, fmt.Errorf("%s not register", monitor.Spec.Model.Name)
+	}
+	if selector.ConfigKey == "" {
+		return nil, fmt.Errorf("targetSelector.configKey is empty")
+	}
+	if _, err := metav1.LabelSelectorAsSelector(&selector.Selector); err != nil {
+		return nil, fmt.Errorf("targetSelector.selector: %w", err)
+	}
+	if err := namespacesAllowed(monitor.Namespace, selector.Namespaces, allowed); err != nil {
+		return nil, fmt.Errorf("targetSelector.namespaces: %w", err)
+	}
+
+	format := selector.Format
+	if format == "" {
+		format = "{{ .Address }}"
+	}
+	tmpl, err := template.New("format").Option("missingkey=error").Parse(format)
+	if err != nil {
+		return nil, fmt.Errorf("targetSelector.format: %w", err)
+	}
+
+	return &targetGatherer{
+		client:    c,
+		factory:   factory,
+		namespace: monitor.Namespace,
+		model:     monitor.Spec.Model.Name,
+		config:    config,
+		selector:  selector,
+		format:    tmpl,
+		handlers:  map[string]*input.Handler{},
+	}, nil
+}
+
+// Gather discovers the targets, starts the handlers of the new ones, drops those of the gone ones
+// and gathers the targets concurrently, a target failing or hanging does not prevent the others from being gathered.
+func (g *targetGatherer) Gather(ctx context.Context) (*types.SampleList, error) {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	targets, err := discoverTargets(ctx, g.client, g.namespace, g.selector)
+	if err != nil {
+		return types.NewSampleList(), fmt.Errorf("discover targets: %w", err)
+	}
+
+	var (
+		wg         sync.WaitGroup
+		mu         sync.Mutex
+		errs       []error
+		slist      = types.NewSampleList()
+		sem        = make(chan struct{}, maxTargetGathers)
+		discovered = make(map[string]struct{}, len(targets))
+	)
+	for _, t := range targets {
+		key := t.key()
+		discovered[key] = struct{}{}
+
+		handler, ok := g.handlers[key]
+		if !ok {
+			handler, err = g.newHandler(t)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("target %s: %w", t.address(), err))
+				continue
+			}
+			g.handlers[key] = handler
+		}
+
+		wg.Add(1)
+		go func(t target, handler *input.Handler) {
+			defer wg.Done()
+			sem <- struct{}{}
+			defer func() { <-sem }()
+
+			list, err := g.gatherTarget(ctx, t, handler)
+
+			mu.Lock()
+			defer mu.Unlock()
+			if err != nil {
+				errs = append(errs, fmt.Errorf("target %s: %w", t.address(), err))
+			}
+			slist.PushFrontN(list)
+		}(t, handler)
+	}
+	wg.Wait()
+
+	for key, handler := range g.handlers {
+		if _, ok := discovered[key]; !ok {
+			handler.Drop()
+			delete(g.handlers, key)
+		}
+	}
+	return slist, errors.Join(errs...)
+}
+
+// gatherTarget gathers t within the target timeout and returns its samples with the target labels.
+func (g *targetGatherer) gatherTarget(ctx context.Context, t target, handler *input.Handler) ([]*types.Sample, error) {
+	if g.selector.Timeout != nil && g.selector.Timeout.Duration > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, g.selector.Timeout.Duration)
+		defer cancel()
+	}
+
+	list, err := handler.Gather(ctx)
+	samples := make([]*types.Sample, 0, list.Len())
+	for _, s := range list.PopBackAll() {
+		if s == nil {
+			continue
+		}
+		for k, v := range t.labels {
+			if _, has := s.Labels[k]; !has {
+				s.Labels[k] = v
+			}
+		}
+		samples = append(samples, s)
+	}
+	return samples, err
+}
+
+func (g *targetGatherer) newHandler(t target) (*input.Handler, error) {
+	var value strings.Builder
+	if err := g.format.Execute(&value, map[string]string{"Host": t.host, "Port": t.port, "Address": t.address()}); err != nil {
+		return nil, err
+	}
+
+	config := make(input.ConfigMap, len(g.config)+2)
+	for k, v := range g.config {
+		config[k] = v
+	}
+	config[g.selector.ConfigKey] = value.String()
+	if g.selector.PortKey != "" {
+		config[g.selector.PortKey] = t.port
+	}
+	return g.factory.New(g.model, config)
+}
+
+// Drop releases the handlers of every target.
+func (g *targetGatherer) Drop() {
+	g.lock.Lock()
+	defer g.lock.Unlock()
+
+	for key, handler := range g.handlers {
+		handler.Drop()
+		delete(g.handlers, key)
+	}
+}
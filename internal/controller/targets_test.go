@@ -0,0 +1,194 @@
+package controller
+
+import (
+	"context"
+	"sort"
+	"strconv"
+	"testing"
+	"time"
+
+	corev1 "k8s.io/api/core/v1"
+	discoveryv1 "k8s.io/api/discovery/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/client-go/kubernetes/scheme"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/client/fake"
+
+	kubemonitoriov1 "github.com/noovertime7/kubemonitor/api/v1"
+	"github.com/noovertime7/kubemonitor/pkg/input"
+	"github.com/noovertime7/kubemonitor/pkg/types"
+)
+
+func TestDiscoverTargets(t *testing.T) {
+	redis := func(name, ip string, phase corev1.PodPhase) *corev1.Pod {
+		return &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: name, Namespace: "team-a", Labels: map[string]string{"app": "redis"}},
+			Spec: corev1.PodSpec{Containers: []corev1.Container{{
+				Name:  "redis",
+				Ports: []corev1.ContainerPort{{Name: "redis", ContainerPort: 6379}, {Name: "metrics", ContainerPort: 9121}},
+			}}},
+			Status: corev1.PodStatus{Phase: phase, PodIP: ip},
+		}
+	}
+	var (
+		ready, notReady = true, false
+		portName        = "redis"
+		port            = int32(6379)
+	)
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(
+		redis("redis-0", "10.0.0.1", corev1.PodRunning),
+		redis("redis-1", "10.0.0.2", corev1.PodRunning),
+		redis("redis-2", "", corev1.PodPending),
+		&corev1.Endpoints{
+			ObjectMeta: metav1.ObjectMeta{Name: "redis", Namespace: "team-a", Labels: map[string]string{"app": "redis"}},
+			Subsets: []corev1.EndpointSubset{{
+				Addresses: []corev1.EndpointAddress{{IP: "10.0.0.1", TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "redis-0"}}},
+				Ports:     []corev1.EndpointPort{{Name: "redis", Port: 6379}},
+			}},
+		},
+		&discoveryv1.EndpointSlice{
+			ObjectMeta:  metav1.ObjectMeta{Name: "redis-abcde", Namespace: "team-a", Labels: map[string]string{"app": "redis", discoveryv1.LabelServiceName: "redis"}},
+			AddressType: discoveryv1.AddressTypeIPv4,
+			Endpoints: []discoveryv1.Endpoint{
+				{Addresses: []string{"10.0.0.1"}, Conditions: discoveryv1.EndpointConditions{Ready: &ready}, TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "redis-0"}},
+				{Addresses: []string{"10.0.0.2"}, Conditions: discoveryv1.EndpointConditions{Ready: &notReady}, TargetRef: &corev1.ObjectReference{Kind: "Pod", Name: "redis-1"}},
+			},
+			Ports: []discoveryv1.EndpointPort{{Name: &portName, Port: &port}},
+		},
+	).Build()
+
+	selector := &kubemonitoriov1.TargetSelector{
+		Role:     targetRolePod,
+		Selector: metav1.LabelSelector{MatchLabels: map[string]string{"app": "redis"}},
+		Port:     "redis",
+	}
+	targets, err := discoverTargets(context.Background(), c, "team-a", selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var addresses []string
+	for _, target := range targets {
+		addresses = append(addresses, target.address()+" "+target.labels[targetLabelPod])
+	}
+	sort.Strings(addresses)
+	if len(addresses) != 2 || addresses[0] != "10.0.0.1:6379 redis-0" || addresses[1] != "10.0.0.2:6379 redis-1" {
+		t.Errorf("pod targets = %v, want the running redis-0 and redis-1", addresses)
+	}
+
+	selector.Role = targetRoleEndpoints
+	targets, err = discoverTargets(context.Background(), c, "team-a", selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 1 || targets[0].labels[targetLabelService] != "redis" || targets[0].labels[targetLabelPod] != "redis-0" {
+		t.Errorf("endpoints targets = %+v, want redis-0 of the redis service", targets)
+	}
+
+	selector.Role = targetRoleEndpointSlice
+	targets, err = discoverTargets(context.Background(), c, "team-a", selector)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(targets) != 1 || targets[0].address() != "10.0.0.1:6379" || targets[0].labels[targetLabelService] != "redis" || targets[0].labels[targetLabelPod] != "redis-0" {
+		t.Errorf("endpointslice targets = %+v, want the ready redis-0 of the redis service", targets)
+	}
+}
+
+func TestNamespacesAllowed(t *testing.T) {
+	tests := []struct {
+		name       string
+		namespaces []string
+		allowed    []string
+		wantErr    bool
+	}{
+		{name: "monitor namespace", namespaces: []string{"team-a"}},
+		{name: "other namespace", namespaces: []string{"team-a", "kube-system"}, wantErr: true},
+		{name: "allowed namespace", namespaces: []string{"team-b"}, allowed: []string{"team-b"}},
+		{name: "any namespace", namespaces: []string{"team-b", "kube-system"}, allowed: []string{"*"}},
+		{name: "one not allowed", namespaces: []string{"team-b", "kube-system"}, allowed: []string{"team-b"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := namespacesAllowed("team-a", tt.namespaces, tt.allowed)
+			if (err != nil) != tt.wantErr {
+				t.Errorf("namespacesAllowed() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// hangingHandler pushes up for its address, or hangs until the gather is cancelled when hang.
+type hangingHandler struct {
+	address string
+	hang    bool
+}
+
+func (h *hangingHandler) Name() string { return fakeModel }
+func (h *hangingHandler) Drop()        {}
+
+func (h *hangingHandler) Init(config input.ConfigMap) error {
+	h.address = config["address"]
+	h.hang = h.address == "10.0.0.1:6379"
+	return nil
+}
+
+func (h *hangingHandler) Gather(ctx context.Context, slist *types.SampleList) error {
+	if h.hang {
+		<-ctx.Done()
+		return ctx.Err()
+	}
+	slist.PushSample(fakeModel, "up", 1, map[string]string{"address": h.address})
+	return nil
+}
+
+func TestTargetGathererHangingTarget(t *testing.T) {
+	var objects []client.Object
+	for i, ip := range []string{"10.0.0.1", "10.0.0.2", "10.0.0.3"} {
+		objects = append(objects, &corev1.Pod{
+			ObjectMeta: metav1.ObjectMeta{Name: "redis-" + strconv.Itoa(i), Namespace: "team-a", Labels: map[string]string{"app": "redis"}},
+			Spec:       corev1.PodSpec{Containers: []corev1.Container{{Name: "redis", Ports: []corev1.ContainerPort{{Name: "redis", ContainerPort: 6379}}}}},
+			Status:     corev1.PodStatus{Phase: corev1.PodRunning, PodIP: ip},
+		})
+	}
+	c := fake.NewClientBuilder().WithScheme(scheme.Scheme).WithObjects(objects...).Build()
+
+	registry := input.NewRegistry()
+	registry.Register(fakeModel, func() input.HandlerFactory { return &hangingHandler{} })
+	monitor := &kubemonitoriov1.Monitor{
+		ObjectMeta: metav1.ObjectMeta{Name: "redis", Namespace: "team-a"},
+		Spec: kubemonitoriov1.MonitorSpec{
+			Model: kubemonitoriov1.Model{Name: fakeModel},
+			TargetSelector: &kubemonitoriov1.TargetSelector{
+				Role:      targetRolePod,
+				Selector:  metav1.LabelSelector{MatchLabels: map[string]string{"app": "redis"}},
+				Port:      "redis",
+				ConfigKey: "address",
+				Timeout:   &metav1.Duration{Duration: 50 * time.Millisecond},
+			},
+		},
+	}
+	g, err := newTargetGatherer(c, registry, monitor, input.ConfigMap{}, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer g.Drop()
+
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	start := time.Now()
+	slist, err := g.Gather(ctx)
+	if err == nil {
+		t.Error("gather error = nil, want the timeout of the hanging target")
+	}
+	if elapsed := time.Since(start); elapsed > time.Second {
+		t.Errorf("gather took %s, want the hanging target cut at its timeout", elapsed)
+	}
+	var addresses []string
+	for _, s := range slist.PopBackAll() {
+		addresses = append(addresses, s.Labels["address"])
+	}
+	sort.Strings(addresses)
+	if len(addresses) != 2 || addresses[0] != "10.0.0.2:6379" || addresses[1] != "10.0.0.3:6379" {
+		t.Errorf("gathered %v, want the samples of the targets not hanging", addresses)
+	}
+}
@@ -0,0 +1,259 @@
+package exporter
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/sirupsen/logrus"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/noovertime7/kubemonitor/internal/writer"
+	"github.com/noovertime7/kubemonitor/pkg/types"
+)
+
+// Exporter keeps the samples of the last gather of every source and exposes them for Prometheus
+// to scrape. A source is replaced as a whole on every gather, so that the series it stopped
+// gathering disappear, and is removed when its Monitor is stopped or has not gathered for staleAfter.
+type Exporter struct {
+	staleAfter time.Duration
+
+	lock    sync.Mutex
+	sources map[string]*gathered
+}
+
+type gathered struct {
+	updated time.Time
+	series  []series
+}
+
+type series struct {
+	metric string
+	labels map[string]string
+	value  float64
+	typ    types.ValueType
+	help   string
+
+	histogram *types.HistogramValue
+	summary   *types.SummaryValue
+}
+
+func New(staleAfter time.Duration) *Exporter {
+	return &Exporter{
+		staleAfter: staleAfter,
+		sources:    map[string]*gathered{},
+	}
+}
+
+// Update replaces the samples of source.
+func (e *Exporter) Update(source writer.Source, samples []*types.Sample) {
+	g := &gathered{updated: time.Now(), series: make([]series, 0, len(samples))}
+	for _, s := range samples {
+		if s == nil {
+			continue
+		}
+		labels := make(map[string]string, len(s.Labels))
+		for k, v := range s.Labels {
+			labels[k] = v
+		}
+		ss := series{metric: s.Metric, labels: labels, typ: s.Type, help: s.Help}
+		switch v := s.Value.(type) {
+		case *types.HistogramValue:
+			ss.histogram = v
+		case *types.SummaryValue:
+			ss.summary = v
+		default:
+			value, err := types.ToFloat64(s.Value)
+			if err != nil {
+				continue
+			}
+			ss.value = value
+		}
+		g.series = append(g.series, ss)
+	}
+
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	e.sources[sourceKey(source)] = g
+}
+
+// Forget removes the samples of source.
+func (e *Exporter) Forget(source writer.Source) {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+	delete(e.sources, sourceKey(source))
+}
+
+// sourceKey ignores the labels of source, a Monitor relabeled keeps its samples.
+func sourceKey(source writer.Source) string {
+	return source.Namespace + "/" + source.Name
+}
+
+// ServeHTTP writes the samples in the text exposition format, typed after their first sample,
+// without timestamps so that Prometheus marks the series gone from a source stale.
+func (e *Exporter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	families := e.families(time.Now())
+
+	w.Header().Set("Content-Type", string(expfmt.FmtText))
+	for _, family := range families {
+		if _, err := expfmt.MetricFamilyToText(w, family); err != nil {
+			logrus.Error("E! failed to write metrics:", err)
+			return
+		}
+	}
+}
+
+// families groups the samples by metric name, dropping the sources not updated since staleAfter.
+// The sources are walked in the order of their keys, so that the series kept on a conflict and
+// the type of a family do not change from a scrape to the next.
+func (e *Exporter) families(now time.Time) []*dto.MetricFamily {
+	e.lock.Lock()
+	defer e.lock.Unlock()
+
+	keys := make([]string, 0, len(e.sources))
+	for source := range e.sources {
+		keys = append(keys, source)
+	}
+	sort.Strings(keys)
+
+	byName := map[string]*dto.MetricFamily{}
+	// seen dedupes the series gathered by several sources, Prometheus rejects them
+	seen := map[string]struct{}{}
+	conflicts := 0
+	for _, source := range keys {
+		g := e.sources[source]
+		if e.staleAfter > 0 && now.Sub(g.updated) > e.staleAfter {
+			delete(e.sources, source)
+			continue
+		}
+		for _, s := range g.series {
+			family, ok := byName[s.metric]
+			if !ok {
+				family = &dto.MetricFamily{Name: proto.String(s.metric), Type: familyType(s).Enum()}
+				if s.help != "" {
+					family.Help = proto.String(s.help)
+				}
+				byName[s.metric] = family
+			}
+			pairs := labelPairs(s.labels)
+			key := seriesKey(s.metric, pairs)
+			if _, ok := seen[key]; ok {
+				conflicts++
+				continue
+			}
+			metric := newMetric(family.GetType(), pairs, s)
+			if metric == nil {
+				conflicts++
+				continue
+			}
+			seen[key] = struct{}{}
+			family.Metric = append(family.Metric, metric)
+		}
+	}
+
+	if conflicts > 0 {
+		logrus.Warn("W! dropped ", conflicts, " series already exposed or not of the type of their family")
+	}
+
+	families := make([]*dto.MetricFamily, 0, len(byName))
+	for _, family := range byName {
+		families = append(families, family)
+	}
+	sort.Slice(families, func(i, j int) bool {
+		return families[i].GetName() < families[j].GetName()
+	})
+	return families
+}
+
+// familyType returns the exposition type of s, the summaries and histograms flattened into
+// samples are untyped.
+func familyType(s series) dto.MetricType {
+	switch {
+	case s.histogram != nil:
+		return dto.MetricType_HISTOGRAM
+	case s.summary != nil:
+		return dto.MetricType_SUMMARY
+	}
+	switch s.typ {
+	case types.Counter:
+		return dto.MetricType_COUNTER
+	case types.Gauge:
+		return dto.MetricType_GAUGE
+	default:
+		return dto.MetricType_UNTYPED
+	}
+}
+
+// newMetric returns the metric of s in a family of type t, nil when s is not of the type.
+// The native buckets of the histograms have no text exposition and are left out.
+func newMetric(t dto.MetricType, pairs []*dto.LabelPair, s series) *dto.Metric {
+	if (t == dto.MetricType_HISTOGRAM) != (s.histogram != nil) || (t == dto.MetricType_SUMMARY) != (s.summary != nil) {
+		return nil
+	}
+
+	switch t {
+	case dto.MetricType_HISTOGRAM:
+		h := &dto.Histogram{SampleCount: proto.Uint64(uint64(s.histogram.Count)), SampleSum: proto.Float64(s.histogram.Sum)}
+		for _, b := range s.histogram.Buckets {
+			h.Bucket = append(h.Bucket, &dto.Bucket{UpperBound: proto.Float64(b.UpperBound), CumulativeCount: proto.Uint64(uint64(b.Count))})
+		}
+		return &dto.Metric{Label: pairs, Histogram: h}
+	case dto.MetricType_SUMMARY:
+		summary := &dto.Summary{SampleCount: proto.Uint64(uint64(s.summary.Count)), SampleSum: proto.Float64(s.summary.Sum)}
+		for _, q := range s.summary.Quantiles {
+			summary.Quantile = append(summary.Quantile, &dto.Quantile{Quantile: proto.Float64(q.Quantile), Value: proto.Float64(q.Value)})
+		}
+		return &dto.Metric{Label: pairs, Summary: summary}
+	case dto.MetricType_COUNTER:
+		return &dto.Metric{Label: pairs, Counter: &dto.Counter{Value: proto.Float64(s.value)}}
+	case dto.MetricType_GAUGE:
+		return &dto.Metric{Label: pairs, Gauge: &dto.Gauge{Value: proto.Float64(s.value)}}
+	default:
+		return &dto.Metric{Label: pairs, Untyped: &dto.Untyped{Value: proto.Float64(s.value)}}
+	}
+}
+
+func labelPairs(labels map[string]string) []*dto.LabelPair {
+	pairs := make([]*dto.LabelPair, 0, len(labels))
+	for k, v := range labels {
+		pairs = append(pairs, &dto.LabelPair{Name: proto.String(k), Value: proto.String(v)})
+	}
+	sort.Slice(pairs, func(i, j int) bool {
+		return pairs[i].GetName() < pairs[j].GetName()
+	})
+	return pairs
+}
+
+func seriesKey(metric string, pairs []*dto.LabelPair) string {
+	var b strings.Builder
+	b.WriteString(metric)
+	for _, pair := range pairs {
+		b.WriteString("\xff" + pair.GetName() + "\xff" + pair.GetValue())
+	}
+	return b.String()
+}
+
+// tee writes the samples to the writers and to the exporter.
+type tee struct {
+	writer.WritersManager
+	exporter *Exporter
+}
+
+// Tee returns a WritersManager feeding exporter along with next.
+func Tee(next writer.WritersManager, exporter *Exporter) writer.WritersManager {
+	return &tee{WritersManager: next, exporter: exporter}
+}
+
+func (t *tee) WriteSamples(source writer.Source, samples []*types.Sample) {
+	t.exporter.Update(source, samples)
+	t.WritersManager.WriteSamples(source, samples)
+}
+
+func (t *tee) Forget(source writer.Source) {
+	t.exporter.Forget(source)
+	t.WritersManager.Forget(source)
+}
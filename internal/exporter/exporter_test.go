@@ -0,0 +1,121 @@
+package exporter
+
+import (
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/noovertime7/kubemonitor/internal/writer"
+	"github.com/noovertime7/kubemonitor/pkg/types"
+)
+
+func scrape(t *testing.T, e *Exporter) string {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	e.ServeHTTP(rec, httptest.NewRequest("GET", "/metrics", nil))
+	return rec.Body.String()
+}
+
+func TestExporterReplacesSamplesOfSource(t *testing.T) {
+	e := New(time.Minute)
+	mysql := writer.Source{Namespace: "team-a", Name: "mysql"}
+
+	e.Update(mysql, []*types.Sample{
+		types.NewSample("mysql", "up", 1, map[string]string{"instance": "db:3306"}),
+		types.NewSample("mysql", "uptime", 42, nil),
+	})
+	body := scrape(t, e)
+	for _, want := range []string{"# TYPE mysql_up untyped", `mysql_up{instance="db:3306"} 1`, "mysql_uptime 42"} {
+		if !strings.Contains(body, want) {
+			t.Fatalf("missing %q in:\n%s", want, body)
+		}
+	}
+
+	// a relabeled source replaces the samples of the same Monitor
+	e.Update(writer.Source{Namespace: "team-a", Name: "mysql", Labels: map[string]string{"team": "a"}}, []*types.Sample{
+		types.NewSample("mysql", "up", 0, map[string]string{"instance": "db:3306"}),
+	})
+	body = scrape(t, e)
+	if !strings.Contains(body, `mysql_up{instance="db:3306"} 0`) || strings.Contains(body, "mysql_uptime") {
+		t.Fatalf("samples not replaced:\n%s", body)
+	}
+}
+
+func TestExporterForgetsSource(t *testing.T) {
+	e := New(0)
+	mysql := writer.Source{Namespace: "team-a", Name: "mysql"}
+	redis := writer.Source{Namespace: "team-a", Name: "redis"}
+	e.Update(mysql, []*types.Sample{types.NewSample("mysql", "up", 1, nil)})
+	e.Update(redis, []*types.Sample{types.NewSample("redis", "up", 1, nil)})
+
+	e.Forget(mysql)
+	body := scrape(t, e)
+	if strings.Contains(body, "mysql_up") || !strings.Contains(body, "redis_up 1") {
+		t.Fatalf("mysql not forgotten:\n%s", body)
+	}
+}
+
+func TestExporterDropsStaleSources(t *testing.T) {
+	e := New(time.Minute)
+	e.Update(writer.Source{Namespace: "team-a", Name: "mysql"}, []*types.Sample{types.NewSample("mysql", "up", 1, nil)})
+
+	if families := e.families(time.Now()); len(families) != 1 {
+		t.Fatalf("got %d families, want 1", len(families))
+	}
+	if families := e.families(time.Now().Add(2 * time.Minute)); len(families) != 0 {
+		t.Fatalf("got %d families after staleAfter, want 0", len(families))
+	}
+	if len(e.sources) != 0 {
+		t.Fatalf("stale source kept")
+	}
+}
+
+func TestExporterDedupesSeries(t *testing.T) {
+	e := New(0)
+	labels := map[string]string{"instance": "db:3306"}
+	e.Update(writer.Source{Namespace: "team-b", Name: "mysql"}, []*types.Sample{types.NewSample("mysql", "up", 0, labels)})
+	e.Update(writer.Source{Namespace: "team-a", Name: "mysql"}, []*types.Sample{types.NewSample("mysql", "up", 1, labels)})
+
+	// the series of the first source in key order wins on every scrape
+	for i := 0; i < 20; i++ {
+		families := e.families(time.Now())
+		if len(families) != 1 || len(families[0].Metric) != 1 {
+			t.Fatalf("duplicated series: %v", families)
+		}
+		if value := families[0].Metric[0].GetUntyped().GetValue(); value != 1 {
+			t.Fatalf("scrape %d: mysql_up = %v, want the one of team-a", i, value)
+		}
+	}
+}
+
+func TestExporterExposesDistributions(t *testing.T) {
+	e := New(0)
+	e.Update(writer.Source{Namespace: "team-a", Name: "app"}, []*types.Sample{
+		types.NewSample("app", "rpc_duration_seconds", &types.SummaryValue{
+			Count:     3,
+			Sum:       1.5,
+			Quantiles: []types.Quantile{{Quantile: 0.5, Value: 0.25}},
+		}).SetType(types.Summary),
+		types.NewSample("elasticsearch", "transport_inbound_handling_time_seconds", &types.HistogramValue{
+			Count:   4,
+			Sum:     2,
+			Buckets: []types.Bucket{{UpperBound: 0.001, Count: 1}},
+		}).SetType(types.Histogram),
+	})
+
+	body := scrape(t, e)
+	for _, want := range []string{
+		"# TYPE app_rpc_duration_seconds summary",
+		`app_rpc_duration_seconds{quantile="0.5"} 0.25`,
+		"app_rpc_duration_seconds_count 3",
+		"# TYPE elasticsearch_transport_inbound_handling_time_seconds histogram",
+		`elasticsearch_transport_inbound_handling_time_seconds_bucket{le="0.001"} 1`,
+		`elasticsearch_transport_inbound_handling_time_seconds_bucket{le="+Inf"} 4`,
+		"elasticsearch_transport_inbound_handling_time_seconds_sum 2",
+	} {
+		if !strings.Contains(body, want) {
+			t.Errorf("missing %q in:\n%s", want, body)
+		}
+	}
+}
@@ -2,6 +2,7 @@ package clickhouse
 
 import (
 	"bytes"
+	"context"
 	"encoding/json"
 	"fmt"
 	"io"
@@ -24,7 +25,9 @@ import (
 const inputName = "clickhouse"
 
 func init() {
-	input.Factory.RegisterHandler(&Instance{})
+	input.Factory.Register(inputName, func() input.HandlerFactory {
+		return &Instance{}
+	})
 }
 
 var defaultTimeout = 5 * time.Second
@@ -55,6 +58,12 @@ func (ins *Instance) Name() string {
 	return inputName
 }
 
+func (ins *Instance) Drop() {
+	if ins.HTTPClient != nil {
+		ins.HTTPClient.CloseIdleConnections()
+	}
+}
+
 type connect struct {
 	Cluster  string `json:"cluster"`
 	ShardNum int    `json:"shard_num"`
@@ -91,7 +100,7 @@ func (ins *Instance) Init(config input.ConfigMap) error {
 }
 
 // Gather collect data from ClickHouse server
-func (ins *Instance) Gather(slist *types.SampleList) error {
+func (ins *Instance) Gather(ctx context.Context, slist *types.SampleList) error {
 	var (
 		connects []connect
 		exists   = func(host string) bool {
@@ -113,7 +122,7 @@ func (ins *Instance) Gather(slist *types.SampleList) error {
 		switch {
 		case ins.AutoDiscovery:
 			var conns []connect
-			if err := ins.execQuery(u, "SELECT cluster, shard_num, host_name FROM system.clusters "+ins.clusterIncludeExcludeFilter(), &conns); err != nil {
+			if err := ins.execQuery(ctx, u, "SELECT cluster, shard_num, host_name FROM system.clusters "+ins.clusterIncludeExcludeFilter(), &conns); err != nil {
 				logrus.Error("E! failed to exec clickhouse query:", "SELECT cluster, shard_num, host_name FROM system.clusters "+ins.clusterIncludeExcludeFilter())
 				continue
 			}
@@ -135,7 +144,7 @@ func (ins *Instance) Gather(slist *types.SampleList) error {
 	}
 
 	for i := range connects {
-		metricsFuncs := []func(slist *types.SampleList, conn *connect) error{
+		metricsFuncs := []func(ctx context.Context, slist *types.SampleList, conn *connect) error{
 			ins.tables,
 			ins.zookeeper,
 			ins.replicationQueue,
@@ -148,30 +157,30 @@ func (ins *Instance) Gather(slist *types.SampleList) error {
 		}
 
 		for _, metricFunc := range metricsFuncs {
-			if err := metricFunc(slist, &connects[i]); err != nil {
+			if err := metricFunc(ctx, slist, &connects[i]); err != nil {
 				logrus.Error("E! failed to exec  metrics Funcs error:", err)
 			}
 		}
 
 		for metric := range commonMetrics {
-			if err := ins.commonMetrics(slist, &connects[i], metric); err != nil {
+			if err := ins.commonMetrics(ctx, slist, &connects[i], metric); err != nil {
 				logrus.Error("E! failed to exec query commonMetrics error:", err)
 			}
 		}
 		logrus.Error("E!metrics=", len(ins.Metrics))
 		waitMetrics := new(sync.WaitGroup)
 
-		for i := 0; i < len(ins.Metrics); i++ {
-			m := ins.Metrics[i]
+		for j := 0; j < len(ins.Metrics); j++ {
+			m := ins.Metrics[j]
 			waitMetrics.Add(1)
 			//tags := map[string]string{"address": ins.Address}
 			//go ins.scrapeMetric(waitMetrics, slist, m, tags)
-			go ins.execCustomQuery(&connects[i], waitMetrics, slist, m)
+			go ins.execCustomQuery(ctx, &connects[i], waitMetrics, slist, m)
 		}
 		waitMetrics.Wait()
 
 	}
-	return nil
+	return ctx.Err()
 }
 
 func (ins *Instance) clusterIncludeExcludeFilter() string {
@@ -207,7 +216,7 @@ func (ins *Instance) clusterIncludeExcludeFilter() string {
 	return "WHERE " + includeFilter
 }
 
-func (ins *Instance) commonMetrics(slist *types.SampleList, conn *connect, metric string) error {
+func (ins *Instance) commonMetrics(ctx context.Context, slist *types.SampleList, conn *connect, metric string) error {
 	var intResult []struct {
 		Metric string   `json:"metric"`
 		Value  chUInt64 `json:"value"`
@@ -221,14 +230,14 @@ func (ins *Instance) commonMetrics(slist *types.SampleList, conn *connect, metri
 	tags := ins.makeDefaultTags(conn)
 
 	if commonMetricsIsFloat[metric] {
-		if err := ins.execQuery(conn.url, commonMetrics[metric], &floatResult); err != nil {
+		if err := ins.execQuery(ctx, conn.url, commonMetrics[metric], &floatResult); err != nil {
 			return err
 		}
 		for _, r := range floatResult {
 			slist.PushFront(types.NewSample("clickhouse_"+metric, stringx.SnakeCase(r.Metric), r.Value, tags))
 		}
 	} else {
-		if err := ins.execQuery(conn.url, commonMetrics[metric], &intResult); err != nil {
+		if err := ins.execQuery(ctx, conn.url, commonMetrics[metric], &intResult); err != nil {
 			return err
 		}
 		for _, r := range intResult {
@@ -238,12 +247,12 @@ func (ins *Instance) commonMetrics(slist *types.SampleList, conn *connect, metri
 	return nil
 }
 
-func (ins *Instance) zookeeper(slist *types.SampleList, conn *connect) error {
+func (ins *Instance) zookeeper(ctx context.Context, slist *types.SampleList, conn *connect) error {
 	var zkExists []struct {
 		ZkExists chUInt64 `json:"zk_exists"`
 	}
 
-	if err := ins.execQuery(conn.url, systemZookeeperExistsSQL, &zkExists); err != nil {
+	if err := ins.execQuery(ctx, conn.url, systemZookeeperExistsSQL, &zkExists); err != nil {
 		return err
 	}
 	tags := ins.makeDefaultTags(conn)
@@ -252,7 +261,7 @@ func (ins *Instance) zookeeper(slist *types.SampleList, conn *connect) error {
 		var zkRootNodes []struct {
 			ZkRootNodes chUInt64 `json:"zk_root_nodes"`
 		}
-		if err := ins.execQuery(conn.url, systemZookeeperRootNodesSQL, &zkRootNodes); err != nil {
+		if err := ins.execQuery(ctx, conn.url, systemZookeeperRootNodesSQL, &zkRootNodes); err != nil {
 			return err
 		}
 
@@ -261,12 +270,12 @@ func (ins *Instance) zookeeper(slist *types.SampleList, conn *connect) error {
 	return nil
 }
 
-func (ins *Instance) replicationQueue(slist *types.SampleList, conn *connect) error {
+func (ins *Instance) replicationQueue(ctx context.Context, slist *types.SampleList, conn *connect) error {
 	var replicationQueueExists []struct {
 		ReplicationQueueExists chUInt64 `json:"replication_queue_exists"`
 	}
 
-	if err := ins.execQuery(conn.url, systemReplicationExistsSQL, &replicationQueueExists); err != nil {
+	if err := ins.execQuery(ctx, conn.url, systemReplicationExistsSQL, &replicationQueueExists); err != nil {
 		return err
 	}
 
@@ -277,7 +286,7 @@ func (ins *Instance) replicationQueue(slist *types.SampleList, conn *connect) er
 			NumTriesReplicas     chUInt64 `json:"replication_num_tries_replicas"`
 			TooManyTriesReplicas chUInt64 `json:"replication_too_many_tries_replicas"`
 		}
-		if err := ins.execQuery(conn.url, systemReplicationNumTriesSQL, &replicationTooManyTries); err != nil {
+		if err := ins.execQuery(ctx, conn.url, systemReplicationNumTriesSQL, &replicationTooManyTries); err != nil {
 			return err
 		}
 
@@ -287,11 +296,11 @@ func (ins *Instance) replicationQueue(slist *types.SampleList, conn *connect) er
 	return nil
 }
 
-func (ins *Instance) detachedParts(slist *types.SampleList, conn *connect) error {
+func (ins *Instance) detachedParts(ctx context.Context, slist *types.SampleList, conn *connect) error {
 	var detachedParts []struct {
 		DetachedParts chUInt64 `json:"detached_parts"`
 	}
-	if err := ins.execQuery(conn.url, systemDetachedPartsSQL, &detachedParts); err != nil {
+	if err := ins.execQuery(ctx, conn.url, systemDetachedPartsSQL, &detachedParts); err != nil {
 		return err
 	}
 
@@ -302,13 +311,13 @@ func (ins *Instance) detachedParts(slist *types.SampleList, conn *connect) error
 	return nil
 }
 
-func (ins *Instance) dictionaries(slist *types.SampleList, conn *connect) error {
+func (ins *Instance) dictionaries(ctx context.Context, slist *types.SampleList, conn *connect) error {
 	var brokenDictionaries []struct {
 		Origin         string   `json:"origin"`
 		BytesAllocated chUInt64 `json:"bytes_allocated"`
 		Status         string   `json:"status"`
 	}
-	if err := ins.execQuery(conn.url, systemDictionariesSQL, &brokenDictionaries); err != nil {
+	if err := ins.execQuery(ctx, conn.url, systemDictionariesSQL, &brokenDictionaries); err != nil {
 		return err
 	}
 
@@ -330,13 +339,13 @@ func (ins *Instance) dictionaries(slist *types.SampleList, conn *connect) error
 	return nil
 }
 
-func (ins *Instance) mutations(slist *types.SampleList, conn *connect) error {
+func (ins *Instance) mutations(ctx context.Context, slist *types.SampleList, conn *connect) error {
 	var mutationsStatus []struct {
 		Failed    chUInt64 `json:"failed"`
 		Running   chUInt64 `json:"running"`
 		Completed chUInt64 `json:"completed"`
 	}
-	if err := ins.execQuery(conn.url, systemMutationSQL, &mutationsStatus); err != nil {
+	if err := ins.execQuery(ctx, conn.url, systemMutationSQL, &mutationsStatus); err != nil {
 		return err
 	}
 
@@ -351,7 +360,7 @@ func (ins *Instance) mutations(slist *types.SampleList, conn *connect) error {
 	return nil
 }
 
-func (ins *Instance) disks(slist *types.SampleList, conn *connect) error {
+func (ins *Instance) disks(ctx context.Context, slist *types.SampleList, conn *connect) error {
 	var disksStatus []struct {
 		Name            string   `json:"name"`
 		Path            string   `json:"path"`
@@ -359,7 +368,7 @@ func (ins *Instance) disks(slist *types.SampleList, conn *connect) error {
 		KeepFreePercent chUInt64 `json:"keep_free_space_percent"`
 	}
 
-	if err := ins.execQuery(conn.url, systemDisksSQL, &disksStatus); err != nil {
+	if err := ins.execQuery(ctx, conn.url, systemDisksSQL, &disksStatus); err != nil {
 		return err
 	}
 
@@ -375,7 +384,7 @@ func (ins *Instance) disks(slist *types.SampleList, conn *connect) error {
 	return nil
 }
 
-func (ins *Instance) processes(slist *types.SampleList, conn *connect) error {
+func (ins *Instance) processes(ctx context.Context, slist *types.SampleList, conn *connect) error {
 	var processesStats []struct {
 		QueryType      string  `json:"query_type"`
 		Percentile50   float64 `json:"p50"`
@@ -383,7 +392,7 @@ func (ins *Instance) processes(slist *types.SampleList, conn *connect) error {
 		LongestRunning float64 `json:"longest_running"`
 	}
 
-	if err := ins.execQuery(conn.url, systemProcessesSQL, &processesStats); err != nil {
+	if err := ins.execQuery(ctx, conn.url, systemProcessesSQL, &processesStats); err != nil {
 		return err
 	}
 
@@ -391,20 +400,21 @@ func (ins *Instance) processes(slist *types.SampleList, conn *connect) error {
 		tags := ins.makeDefaultTags(conn)
 		tags["query_type"] = process.QueryType
 
-		slist.PushFront(types.NewSample("clickhouse_processes", "percentile_50", process.Percentile50, tags))
-		slist.PushFront(types.NewSample("clickhouse_processes", "percentile_90", process.Percentile90, tags))
-		slist.PushFront(types.NewSample("clickhouse_processes", "longest_running", process.LongestRunning, tags))
+		// the quantiles of the queries running now, not of the queries run so far as a summary would be
+		slist.PushTypedSample(types.Gauge, "clickhouse_processes", "percentile_50", process.Percentile50, tags)
+		slist.PushTypedSample(types.Gauge, "clickhouse_processes", "percentile_90", process.Percentile90, tags)
+		slist.PushTypedSample(types.Gauge, "clickhouse_processes", "longest_running", process.LongestRunning, tags)
 	}
 
 	return nil
 }
 
-func (ins *Instance) textLog(slist *types.SampleList, conn *connect) error {
+func (ins *Instance) textLog(ctx context.Context, slist *types.SampleList, conn *connect) error {
 	var textLogExists []struct {
 		TextLogExists chUInt64 `json:"text_log_exists"`
 	}
 
-	if err := ins.execQuery(conn.url, systemTextLogExistsSQL, &textLogExists); err != nil {
+	if err := ins.execQuery(ctx, conn.url, systemTextLogExistsSQL, &textLogExists); err != nil {
 		return err
 	}
 
@@ -413,7 +423,7 @@ func (ins *Instance) textLog(slist *types.SampleList, conn *connect) error {
 			Level             string   `json:"level"`
 			MessagesLast10Min chUInt64 `json:"messages_last_10_min"`
 		}
-		if err := ins.execQuery(conn.url, systemTextLogSQL, &textLogLast10MinMessages); err != nil {
+		if err := ins.execQuery(ctx, conn.url, systemTextLogSQL, &textLogLast10MinMessages); err != nil {
 			return err
 		}
 
@@ -426,7 +436,7 @@ func (ins *Instance) textLog(slist *types.SampleList, conn *connect) error {
 	return nil
 }
 
-func (ins *Instance) tables(slist *types.SampleList, conn *connect) error {
+func (ins *Instance) tables(ctx context.Context, slist *types.SampleList, conn *connect) error {
 	var parts []struct {
 		Database string   `json:"database"`
 		Table    string   `json:"table"`
@@ -435,7 +445,7 @@ func (ins *Instance) tables(slist *types.SampleList, conn *connect) error {
 		Rows     chUInt64 `json:"rows"`
 	}
 
-	if err := ins.execQuery(conn.url, systemPartsSQL, &parts); err != nil {
+	if err := ins.execQuery(ctx, conn.url, systemPartsSQL, &parts); err != nil {
 		return err
 	}
 	tags := ins.makeDefaultTags(conn)
@@ -472,11 +482,13 @@ func (e *clickhouseError) Error() string {
 	return fmt.Sprintf("received error code %d: %s", e.StatusCode, e.body)
 }
 
-func (ins *Instance) execQuery(address *url.URL, query string, i interface{}) error {
-	q := address.Query()
+// execQuery runs query on address, the queries of a connection run concurrently so address is left untouched.
+func (ins *Instance) execQuery(ctx context.Context, address *url.URL, query string, i interface{}) error {
+	u := *address
+	q := u.Query()
 	q.Set("query", query+" FORMAT JSON")
-	address.RawQuery = q.Encode()
-	req, _ := http.NewRequest("GET", address.String(), nil)
+	u.RawQuery = q.Encode()
+	req, _ := http.NewRequestWithContext(ctx, "GET", u.String(), nil)
 	if ins.Username != "" {
 		req.Header.Add("X-ClickHouse-User", ins.Username)
 	}
@@ -511,13 +523,13 @@ func (ins *Instance) execQuery(address *url.URL, query string, i interface{}) er
 	return nil
 }
 
-func (ins *Instance) execCustomQuery(conn *connect, waitMetrics *sync.WaitGroup, slist *types.SampleList, metricConf MetricConfig) error {
+func (ins *Instance) execCustomQuery(ctx context.Context, conn *connect, waitMetrics *sync.WaitGroup, slist *types.SampleList, metricConf MetricConfig) error {
 	defer waitMetrics.Done()
 	address := conn.url
 	q := address.Query()
 	q.Set("query", metricConf.Request+" FORMAT JSON")
 	address.RawQuery = q.Encode()
-	req, _ := http.NewRequest("GET", address.String(), nil)
+	req, _ := http.NewRequestWithContext(ctx, "GET", address.String(), nil)
 	if ins.Username != "" {
 		req.Header.Add("X-ClickHouse-User", ins.Username)
 	}
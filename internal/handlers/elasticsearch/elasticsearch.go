@@ -1,6 +1,7 @@
 package elasticsearch
 
 import (
+	"context"
 	"encoding/json"
 	"fmt"
 	"github.com/noovertime7/kubemonitor/pkg/filter"
@@ -9,6 +10,7 @@ import (
 	"github.com/noovertime7/kubemonitor/pkg/types"
 	"github.com/sirupsen/logrus"
 	"io"
+	"math"
 	"net/http"
 	"sort"
 	"strings"
@@ -19,7 +21,9 @@ import (
 const inputName = "elasticsearch"
 
 func init() {
-	input.Factory.RegisterHandler(&Instance{})
+	input.Factory.Register(inputName, func() input.HandlerFactory {
+		return &Instance{}
+	})
 }
 
 // Nodestats are always generated, so simply define a constant for these endpoints
@@ -110,6 +114,12 @@ func (ins *Instance) Name() string {
 	return inputName
 }
 
+func (ins *Instance) Drop() {
+	if ins.client != nil {
+		ins.client.CloseIdleConnections()
+	}
+}
+
 type serverInfo struct {
 	nodeID   string
 	masterID string
@@ -168,7 +178,7 @@ func (ins *Instance) compileIndexMatchers() (map[string]filter.Filter, error) {
 	return indexMatchers, nil
 }
 
-func (ins *Instance) Gather(slist *types.SampleList) error {
+func (ins *Instance) Gather(ctx context.Context, slist *types.SampleList) error {
 	if ins.ClusterStats || len(ins.IndicesInclude) > 0 || len(ins.IndicesLevel) > 0 {
 		var wgC sync.WaitGroup
 		wgC.Add(len(ins.Servers))
@@ -185,8 +195,8 @@ func (ins *Instance) Gather(slist *types.SampleList) error {
 				var err error
 
 				// Gather node ID
-				if info.nodeID, err = ins.gatherNodeID(s + "/_nodes/_local/name"); err != nil {
-					slist.PushSample("elasticsearch", "up", 0, map[string]string{"address": s})
+				if info.nodeID, err = ins.gatherNodeID(ctx, s+"/_nodes/_local/name"); err != nil {
+					slist.PushTypedSample(types.Gauge, "elasticsearch", "up", 0, map[string]string{"address": s})
 					logrus.Error("E! failed to gather node id:", err)
 					clusterErrorCh <- err
 					return
@@ -194,14 +204,14 @@ func (ins *Instance) Gather(slist *types.SampleList) error {
 
 				// get cat/master information here so NodeStats can determine
 				// whether this node is the Master
-				if info.masterID, err = ins.getCatMaster(s + "/_cat/master"); err != nil {
-					slist.PushSample("elasticsearch", "up", 0, map[string]string{"address": s})
+				if info.masterID, err = ins.getCatMaster(ctx, s+"/_cat/master"); err != nil {
+					slist.PushTypedSample(types.Gauge, "elasticsearch", "up", 0, map[string]string{"address": s})
 					logrus.Error("E! failed to get cat master:", err)
 					clusterErrorCh <- err
 					return
 				}
 
-				slist.PushSample("elasticsearch", "up", 1, map[string]string{"address": s})
+				slist.PushTypedSample(types.Gauge, "elasticsearch", "up", 1, map[string]string{"address": s})
 				ins.serverInfoMutex.Lock()
 				ins.serverInfo[s] = info
 				ins.serverInfoMutex.Unlock()
@@ -229,7 +239,7 @@ func (ins *Instance) Gather(slist *types.SampleList) error {
 			url := ins.nodeStatsURL(s)
 
 			// Always gather node stats
-			if err := ins.gatherNodeStats(url, s, slist); err != nil {
+			if err := ins.gatherNodeStats(ctx, url, s, slist); err != nil {
 				logrus.Error("E! failed to gather node stats:", err)
 				serversErrorCh <- err
 				return
@@ -240,7 +250,7 @@ func (ins *Instance) Gather(slist *types.SampleList) error {
 				if ins.ClusterHealthLevel != "" {
 					url = url + "?level=" + ins.ClusterHealthLevel
 				}
-				if err := ins.gatherClusterHealth(url, s, slist); err != nil {
+				if err := ins.gatherClusterHealth(ctx, url, s, slist); err != nil {
 					logrus.Error("E! failed to gather cluster health:", err)
 					serversErrorCh <- err
 					return
@@ -248,7 +258,7 @@ func (ins *Instance) Gather(slist *types.SampleList) error {
 			}
 
 			if ins.ClusterStats && (ins.serverInfo[s].isMaster() || !ins.Local) {
-				if err := ins.gatherClusterStats(s+"/_cluster/stats", s, slist); err != nil {
+				if err := ins.gatherClusterStats(ctx, s+"/_cluster/stats", s, slist); err != nil {
 					logrus.Error("E! failed to gather cluster stats:", err)
 					serversErrorCh <- err
 					return
@@ -257,13 +267,13 @@ func (ins *Instance) Gather(slist *types.SampleList) error {
 
 			if len(ins.IndicesInclude) > 0 && (ins.serverInfo[s].isMaster() || !ins.Local) {
 				if ins.IndicesLevel != "shards" {
-					if err := ins.gatherIndicesStats(s+"/"+strings.Join(ins.IndicesInclude, ",")+"/_stats", s, slist); err != nil {
+					if err := ins.gatherIndicesStats(ctx, s+"/"+strings.Join(ins.IndicesInclude, ",")+"/_stats", s, slist); err != nil {
 						logrus.Error("E! failed to gather indices stats:", err)
 						serversErrorCh <- err
 						return
 					}
 				} else {
-					if err := ins.gatherIndicesStats(s+"/"+strings.Join(ins.IndicesInclude, ",")+"/_stats?level=shards", s, slist); err != nil {
+					if err := ins.gatherIndicesStats(ctx, s+"/"+strings.Join(ins.IndicesInclude, ",")+"/_stats?level=shards", s, slist); err != nil {
 						logrus.Error("E! failed to gather indices stats:", err)
 						serversErrorCh <- err
 						return
@@ -283,21 +293,21 @@ func (ins *Instance) Gather(slist *types.SampleList) error {
 	return nil
 }
 
-func (ins *Instance) gatherIndicesStats(url string, address string, slist *types.SampleList) error {
+func (ins *Instance) gatherIndicesStats(ctx context.Context, url string, address string, slist *types.SampleList) error {
 	indicesStats := &struct {
 		Shards  map[string]interface{} `json:"_shards"`
 		All     map[string]interface{} `json:"_all"`
 		Indices map[string]indexStat   `json:"indices"`
 	}{}
 
-	if err := ins.gatherJSONData(url, indicesStats); err != nil {
+	if err := ins.gatherJSONData(ctx, url, indicesStats); err != nil {
 		return err
 	}
 
 	addrTag := map[string]string{"address": address}
 
 	// Total Shards Stats
-	slist.PushSamples("elasticsearch_indices_stats_shards_total", indicesStats.Shards, addrTag)
+	pushStats(slist, "elasticsearch_indices_stats_shards_total", indicesStats.Shards, addrTag)
 
 	// All Stats
 	for m, s := range indicesStats.All {
@@ -308,7 +318,7 @@ func (ins *Instance) gatherIndicesStats(url string, address string, slist *types
 			return err
 		}
 		for key, val := range jsonParser.Fields {
-			slist.PushSample("elasticsearch", "indices_stats_"+m+"_"+key, val, map[string]string{"index_name": "_all"}, addrTag)
+			slist.PushTypedSample(statType(key), "elasticsearch", "indices_stats_"+m+"_"+key, val, map[string]string{"index_name": "_all"}, addrTag)
 		}
 	}
 
@@ -361,7 +371,7 @@ func (ins *Instance) gatherSingleIndexStats(name string, index indexStat, addrTa
 			return err
 		}
 		for key, val := range f.Fields {
-			slist.PushSample("elasticsearch", "indices_stats_"+m+"_"+key, val, indexTag, addrTag)
+			slist.PushTypedSample(statType(key), "elasticsearch", "indices_stats_"+m+"_"+key, val, indexTag, addrTag)
 		}
 	}
 
@@ -403,7 +413,7 @@ func (ins *Instance) gatherSingleIndexStats(name string, index indexStat, addrTa
 					}
 				}
 
-				slist.PushSamples("elasticsearch_indices_stats_shards", flattened.Fields, shardTags, addrTag)
+				pushStats(slist, "elasticsearch_indices_stats_shards", flattened.Fields, shardTags, addrTag)
 			}
 		}
 	}
@@ -441,9 +451,9 @@ func (ins *Instance) categorizeIndices(indices map[string]indexStat) map[string]
 	return categorizedIndexNames
 }
 
-func (ins *Instance) gatherClusterStats(url string, address string, slist *types.SampleList) error {
+func (ins *Instance) gatherClusterStats(ctx context.Context, url string, address string, slist *types.SampleList) error {
 	clusterStats := &clusterStats{}
-	if err := ins.gatherJSONData(url, clusterStats); err != nil {
+	if err := ins.gatherJSONData(ctx, url, clusterStats); err != nil {
 		return err
 	}
 
@@ -467,17 +477,18 @@ func (ins *Instance) gatherClusterStats(url string, address string, slist *types
 			return err
 		}
 
+		// the cluster stats add up the current nodes, they drop when a node leaves
 		for key, val := range f.Fields {
-			slist.PushSample("elasticsearch", "clusterstats_"+p+"_"+key, val, tags)
+			slist.PushTypedSample(types.Gauge, "elasticsearch", "clusterstats_"+p+"_"+key, val, tags)
 		}
 	}
 
 	return nil
 }
 
-func (ins *Instance) gatherClusterHealth(url string, address string, slist *types.SampleList) error {
+func (ins *Instance) gatherClusterHealth(ctx context.Context, url string, address string, slist *types.SampleList) error {
 	healthStats := &clusterHealth{}
-	if err := ins.gatherJSONData(url, healthStats); err != nil {
+	if err := ins.gatherJSONData(ctx, url, healthStats); err != nil {
 		return err
 	}
 
@@ -495,12 +506,13 @@ func (ins *Instance) gatherClusterHealth(url string, address string, slist *type
 		"cluster_health_number_of_pending_tasks":          healthStats.NumberOfPendingTasks,
 		"cluster_health_relocating_shards":                healthStats.RelocatingShards,
 		"cluster_health_status_code":                      mapHealthStatusToCode(healthStats.Status),
+		"cluster_health_status":                           healthStats.Status,
 		"cluster_health_task_max_waiting_in_queue_millis": healthStats.TaskMaxWaitingInQueueMillis,
 		"cluster_health_timed_out":                        healthStats.TimedOut,
 		"cluster_health_unassigned_shards":                healthStats.UnassignedShards,
 	}
 
-	slist.PushSamples("elasticsearch", clusterFields, map[string]string{"cluster_name": healthStats.ClusterName}, addrTag)
+	pushStats(slist, "elasticsearch", clusterFields, map[string]string{"cluster_name": healthStats.ClusterName}, addrTag)
 
 	for name, health := range healthStats.Indices {
 		indexFields := map[string]interface{}{
@@ -511,21 +523,22 @@ func (ins *Instance) gatherClusterHealth(url string, address string, slist *type
 			"cluster_health_indices_number_of_shards":      health.NumberOfShards,
 			"cluster_health_indices_relocating_shards":     health.RelocatingShards,
 			"cluster_health_indices_status_code":           mapHealthStatusToCode(health.Status),
+			"cluster_health_indices_status":                health.Status,
 			"cluster_health_indices_unassigned_shards":     health.UnassignedShards,
 		}
-		slist.PushSamples("elasticsearch", indexFields, map[string]string{"index": name, "name": healthStats.ClusterName}, addrTag)
+		pushStats(slist, "elasticsearch", indexFields, map[string]string{"index": name, "name": healthStats.ClusterName}, addrTag)
 	}
 
 	return nil
 }
 
-func (ins *Instance) gatherNodeStats(url string, address string, slist *types.SampleList) error {
+func (ins *Instance) gatherNodeStats(ctx context.Context, url string, address string, slist *types.SampleList) error {
 	nodeStats := &struct {
 		ClusterName string               `json:"cluster_name"`
 		Nodes       map[string]*nodeStat `json:"nodes"`
 	}{}
 
-	if err := ins.gatherJSONData(url, nodeStats); err != nil {
+	if err := ins.gatherJSONData(ctx, url, nodeStats); err != nil {
 		return err
 	}
 
@@ -542,7 +555,7 @@ func (ins *Instance) gatherNodeStats(url string, address string, slist *types.Sa
 		}
 
 		for k, v := range n.Attributes {
-			slist.PushSample("elasticsearch", "node_attribute_"+k, v, tags, addrTag)
+			slist.PushTypedSample(types.Gauge, "elasticsearch", "node_attribute_"+k, v, tags, addrTag)
 		}
 
 		stats := map[string]interface{}{
@@ -571,14 +584,82 @@ func (ins *Instance) gatherNodeStats(url string, address string, slist *types.Sa
 			}
 
 			for key, val := range f.Fields {
-				slist.PushSample("elasticsearch", p+"_"+key, val, tags, addrTag)
+				slist.PushTypedSample(statType(key), "elasticsearch", p+"_"+key, val, tags, addrTag)
 			}
 		}
+
+		pushHandlingTimes(slist, n.Transport, tags, addrTag)
 	}
 
 	return nil
 }
 
+// statCounterSuffixes end the flattened stats only growing since the node started, the totals,
+// the times spent and the operations done.
+var statCounterSuffixes = []string{
+	"_total",
+	"_total_opened",
+	"_time_in_millis",
+	"_collection_count",
+	"_evictions",
+	"_rejected",
+	"_completed",
+	"_operations",
+	"_rx_count",
+	"_tx_count",
+	"_rx_size_in_bytes",
+	"_tx_size_in_bytes",
+}
+
+// statType returns the type of the flattened stat key, the stats are gauges but the counters.
+func statType(key string) types.ValueType {
+	for _, suffix := range statCounterSuffixes {
+		if strings.HasSuffix(key, suffix) {
+			return types.Counter
+		}
+	}
+	return types.Gauge
+}
+
+// pushStats pushes the flattened stats fields typed by statType.
+func pushStats(slist *types.SampleList, prefix string, fields map[string]interface{}, labels ...map[string]string) {
+	for key, val := range fields {
+		slist.PushTypedSample(statType(key), prefix, key, val, labels...)
+	}
+}
+
+// handlingTimeHistograms are the transport stats of elasticsearch 8.1+ holding the histograms
+// of the handling times, arrays of buckets in milliseconds the flattened stats leave out.
+var handlingTimeHistograms = []string{"inbound_handling_time_histogram", "outbound_handling_time_histogram"}
+
+// pushHandlingTimes pushes the handling time histograms of transport in seconds. The buckets of
+// elasticsearch are lower than lt_millis, they are taken as less than or equal.
+func pushHandlingTimes(slist *types.SampleList, transport interface{}, labels ...map[string]string) {
+	stats, ok := transport.(map[string]interface{})
+	if !ok {
+		return
+	}
+
+	for _, name := range handlingTimeHistograms {
+		buckets, ok := stats[name].([]interface{})
+		if !ok || len(buckets) == 0 {
+			continue
+		}
+
+		// elasticsearch keeps no sum of the handling times, the _sum series is left out
+		h := &types.HistogramValue{Sum: math.NaN()}
+		for _, b := range buckets {
+			bucket, _ := b.(map[string]interface{})
+			count, _ := bucket["count"].(float64)
+			h.Count += count
+			if lt, ok := bucket["lt_millis"].(float64); ok {
+				h.Buckets = append(h.Buckets, types.Bucket{UpperBound: lt / 1000, Count: h.Count})
+			}
+		}
+		slist.PushHistogram("elasticsearch", "transport_"+strings.TrimSuffix(name, "_histogram")+"_seconds", h, labels...)
+	}
+}
+
 func (ins *Instance) nodeStatsURL(baseURL string) string {
 	var url string
 
@@ -595,8 +676,8 @@ func (ins *Instance) nodeStatsURL(baseURL string) string {
 	return fmt.Sprintf("%s/%s", url, strings.Join(ins.NodeStats, ","))
 }
 
-func (ins *Instance) getCatMaster(url string) (string, error) {
-	req, err := http.NewRequest("GET", url, nil)
+func (ins *Instance) getCatMaster(ctx context.Context, url string) (string, error) {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return "", err
 	}
@@ -627,12 +708,12 @@ func (ins *Instance) getCatMaster(url string) (string, error) {
 	return masterID, nil
 }
 
-func (ins *Instance) gatherNodeID(url string) (string, error) {
+func (ins *Instance) gatherNodeID(ctx context.Context, url string) (string, error) {
 	nodeStats := &struct {
 		ClusterName string               `json:"cluster_name"`
 		Nodes       map[string]*nodeStat `json:"nodes"`
 	}{}
-	if err := ins.gatherJSONData(url, nodeStats); err != nil {
+	if err := ins.gatherJSONData(ctx, url, nodeStats); err != nil {
 		return "", err
 	}
 
@@ -643,8 +724,8 @@ func (ins *Instance) gatherNodeID(url string) (string, error) {
 	return "", nil
 }
 
-func (ins *Instance) gatherJSONData(url string, v interface{}) error {
-	req, err := http.NewRequest("GET", url, nil)
+func (ins *Instance) gatherJSONData(ctx context.Context, url string, v interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, "GET", url, nil)
 	if err != nil {
 		return err
 	}
@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"github.com/noovertime7/kubemonitor/pkg/tagx"
 	"github.com/noovertime7/kubemonitor/pkg/types"
@@ -9,12 +10,12 @@ import (
 	"strings"
 )
 
-func (ins *Instance) gatherBinlog(slist *types.SampleList, db *sql.DB, globalTags map[string]string) {
+func (ins *Instance) gatherBinlog(ctx context.Context, slist *types.SampleList, db *sql.DB, globalTags map[string]string) {
 	if ins.DisablebinLogs {
 		return
 	}
 	var logBin uint8
-	err := db.QueryRow(`SELECT @@log_bin`).Scan(&logBin)
+	err := db.QueryRowContext(ctx, `SELECT @@log_bin`).Scan(&logBin)
 	if err != nil {
 		logrus.Error("E! failed to query SELECT @@log_bin:", err)
 		return
@@ -25,7 +26,7 @@ func (ins *Instance) gatherBinlog(slist *types.SampleList, db *sql.DB, globalTag
 		return
 	}
 
-	rows, err := db.Query(`SHOW BINARY LOGS`)
+	rows, err := db.QueryContext(ctx, `SHOW BINARY LOGS`)
 	if err != nil {
 		logrus.Error("E! failed to query SHOW BINARY LOGS:", err)
 		return
@@ -67,14 +68,14 @@ func (ins *Instance) gatherBinlog(slist *types.SampleList, db *sql.DB, globalTag
 	}
 
 	tags := tagx.Copy(globalTags)
-	slist.PushSample(inputName, "binlog_size_bytes", size, tags)
-	slist.PushSample(inputName, "binlog_file_count", count, tags)
+	slist.PushTypedSample(types.Gauge, inputName, "binlog_size_bytes", size, tags)
+	slist.PushTypedSample(types.Gauge, inputName, "binlog_file_count", count, tags)
 
 	if count == 0 || len(strings.Split(filename, ".")) < 2 {
 		return
 	}
 	value, err := strconv.ParseFloat(strings.Split(filename, ".")[1], 64)
 	if err == nil {
-		slist.PushSample(inputName, "binlog_file_number", value, tags)
+		slist.PushTypedSample(types.Gauge, inputName, "binlog_file_number", value, tags)
 	}
 }
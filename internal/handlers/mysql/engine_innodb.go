@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"github.com/noovertime7/kubemonitor/pkg/tagx"
 	"github.com/noovertime7/kubemonitor/pkg/types"
@@ -10,11 +11,11 @@ import (
 	"strings"
 )
 
-func (ins *Instance) gatherEngineInnodbStatus(slist *types.SampleList, db *sql.DB, globalTags map[string]string, cache map[string]float64) {
+func (ins *Instance) gatherEngineInnodbStatus(ctx context.Context, slist *types.SampleList, db *sql.DB, globalTags map[string]string, cache map[string]float64) {
 	if ins.DisableInnodbStatus {
 		return
 	}
-	rows, err := db.Query(SQL_ENGINE_INNODB_STATUS)
+	rows, err := db.QueryContext(ctx, SQL_ENGINE_INNODB_STATUS)
 	if err != nil {
 		logrus.Error("E! failed to query engine innodb status:", err)
 		return
@@ -44,19 +45,19 @@ func (ins *Instance) gatherEngineInnodbStatus(slist *types.SampleList, db *sql.D
 			if err != nil {
 				continue
 			}
-			slist.PushFront(types.NewSample(inputName, "engine_innodb_queries_inside_innodb", value, tags))
+			slist.PushFront(types.NewSample(inputName, "engine_innodb_queries_inside_innodb", value, tags).SetType(types.Gauge))
 
 			value, err = strconv.ParseFloat(data[2], 64)
 			if err != nil {
 				continue
 			}
-			slist.PushFront(types.NewSample(inputName, "engine_innodb_queries_in_queue", value, tags))
+			slist.PushFront(types.NewSample(inputName, "engine_innodb_queries_in_queue", value, tags).SetType(types.Gauge))
 		} else if data := rViews.FindStringSubmatch(line); data != nil {
 			value, err := strconv.ParseFloat(data[1], 64)
 			if err != nil {
 				continue
 			}
-			slist.PushFront(types.NewSample(inputName, "engine_innodb_read_views_open_inside_innodb", value, tags))
+			slist.PushFront(types.NewSample(inputName, "engine_innodb_read_views_open_inside_innodb", value, tags).SetType(types.Gauge))
 		}
 	}
 }
@@ -23,14 +23,14 @@ func (ins *Instance) gatherEngineInnodbStatusCompute(slist *types.SampleList, db
 		pageUtil = pageUsed / cache["innodb_buffer_pool_pages_total"] * 100
 	}
 
-	slist.PushFront(types.NewSample(inputName, "global_status_buffer_pool_bytes_used", byteUsed, tags))
-	slist.PushFront(types.NewSample(inputName, "global_status_buffer_pool_bytes_data", byteData, tags))
-	slist.PushFront(types.NewSample(inputName, "global_status_buffer_pool_bytes_free", byteFree, tags))
-	slist.PushFront(types.NewSample(inputName, "global_status_buffer_pool_bytes_total", byteTotal, tags))
-	slist.PushFront(types.NewSample(inputName, "global_status_buffer_pool_bytes_dirty", byteDirty, tags))
-	slist.PushFront(types.NewSample(inputName, "global_status_buffer_pool_pages_utilization", pageUtil, tags))
+	slist.PushFront(types.NewSample(inputName, "global_status_buffer_pool_bytes_used", byteUsed, tags).SetType(types.Gauge))
+	slist.PushFront(types.NewSample(inputName, "global_status_buffer_pool_bytes_data", byteData, tags).SetType(types.Gauge))
+	slist.PushFront(types.NewSample(inputName, "global_status_buffer_pool_bytes_free", byteFree, tags).SetType(types.Gauge))
+	slist.PushFront(types.NewSample(inputName, "global_status_buffer_pool_bytes_total", byteTotal, tags).SetType(types.Gauge))
+	slist.PushFront(types.NewSample(inputName, "global_status_buffer_pool_bytes_dirty", byteDirty, tags).SetType(types.Gauge))
+	slist.PushFront(types.NewSample(inputName, "global_status_buffer_pool_pages_utilization", pageUtil, tags).SetType(types.Gauge))
 
 	if ins.ExtraInnodbMetrics {
-		slist.PushFront(types.NewSample(inputName, "global_status_buffer_pool_pages_used", pageUsed, tags))
+		slist.PushFront(types.NewSample(inputName, "global_status_buffer_pool_pages_used", pageUsed, tags).SetType(types.Gauge))
 	}
 }
@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"github.com/noovertime7/kubemonitor/pkg/tagx"
 	"github.com/noovertime7/kubemonitor/pkg/types"
@@ -14,11 +15,90 @@ import (
 // Regexp to match various groups of status vars.
 var globalStatusRE = regexp.MustCompile(`^(com|handler|connection_errors|innodb_buffer_pool_pages|innodb_rows|performance_schema)_(.*)$`)
 
-func (ins *Instance) gatherGlobalStatus(slist *types.SampleList, db *sql.DB, globalTags map[string]string, cache map[string]float64) {
+// globalStatusCounters are the status vars only growing since the server started, out of those not matching globalStatusRE
+var globalStatusCounters = map[string]bool{
+	"aborted_clients":                       true,
+	"aborted_connects":                      true,
+	"binlog_cache_disk_use":                 true,
+	"binlog_cache_use":                      true,
+	"bytes_received":                        true,
+	"bytes_sent":                            true,
+	"connections":                           true,
+	"created_tmp_disk_tables":               true,
+	"created_tmp_files":                     true,
+	"created_tmp_tables":                    true,
+	"innodb_buffer_pool_read_ahead":         true,
+	"innodb_buffer_pool_read_ahead_evicted": true,
+	"innodb_buffer_pool_read_ahead_rnd":     true,
+	"innodb_buffer_pool_read_requests":      true,
+	"innodb_buffer_pool_reads":              true,
+	"innodb_buffer_pool_wait_free":          true,
+	"innodb_buffer_pool_write_requests":     true,
+	"innodb_data_fsyncs":                    true,
+	"innodb_data_read":                      true,
+	"innodb_data_reads":                     true,
+	"innodb_data_writes":                    true,
+	"innodb_data_written":                   true,
+	"innodb_dblwr_pages_written":            true,
+	"innodb_dblwr_writes":                   true,
+	"innodb_log_waits":                      true,
+	"innodb_log_write_requests":             true,
+	"innodb_log_writes":                     true,
+	"innodb_os_log_fsyncs":                  true,
+	"innodb_os_log_written":                 true,
+	"innodb_pages_created":                  true,
+	"innodb_pages_read":                     true,
+	"innodb_pages_written":                  true,
+	"innodb_row_lock_time":                  true,
+	"innodb_row_lock_waits":                 true,
+	"key_read_requests":                     true,
+	"key_reads":                             true,
+	"key_write_requests":                    true,
+	"key_writes":                            true,
+	"opened_tables":                         true,
+	"qcache_hits":                           true,
+	"qcache_inserts":                        true,
+	"qcache_lowmem_prunes":                  true,
+	"qcache_not_cached":                     true,
+	"queries":                               true,
+	"questions":                             true,
+	"select_full_join":                      true,
+	"select_full_range_join":                true,
+	"select_range":                          true,
+	"select_range_check":                    true,
+	"select_scan":                           true,
+	"slow_queries":                          true,
+	"sort_merge_passes":                     true,
+	"sort_range":                            true,
+	"sort_rows":                             true,
+	"sort_scan":                             true,
+	"table_locks_immediate":                 true,
+	"table_locks_waited":                    true,
+	"table_open_cache_hits":                 true,
+	"table_open_cache_misses":               true,
+	"threads_created":                       true,
+	"wsrep_flow_control_paused_ns":          true,
+	"wsrep_flow_control_recv":               true,
+	"wsrep_flow_control_sent":               true,
+	"wsrep_local_cert_failures":             true,
+	"wsrep_received":                        true,
+	"wsrep_received_bytes":                  true,
+	"wsrep_replicated_bytes":                true,
+}
+
+// globalStatusType returns the type of the status var key, the vars are gauges but the counters.
+func globalStatusType(key string) types.ValueType {
+	if globalStatusCounters[key] {
+		return types.Counter
+	}
+	return types.Gauge
+}
+
+func (ins *Instance) gatherGlobalStatus(ctx context.Context, slist *types.SampleList, db *sql.DB, globalTags map[string]string, cache map[string]float64) {
 	if ins.DisableGlobalStatus {
 		return
 	}
-	rows, err := db.Query(SQL_GLOBAL_STATUS)
+	rows, err := db.QueryContext(ctx, SQL_GLOBAL_STATUS)
 	if err != nil {
 		logrus.Error("E! failed to query global status:", err)
 		return
@@ -63,35 +143,42 @@ func (ins *Instance) gatherGlobalStatus(slist *types.SampleList, db *sql.DB, glo
 
 			match := globalStatusRE.FindStringSubmatch(key)
 			if match == nil {
-				slist.PushFront(types.NewSample(inputName, "global_status_"+key, floatVal, tags))
+				slist.PushFront(types.NewSample(inputName, "global_status_"+key, floatVal, tags).SetType(globalStatusType(key)))
 				continue
 			}
 
 			switch match[1] {
 			case "com":
 				// Total number of executed MySQL commands.
-				slist.PushFront(types.NewSample(inputName, "global_status_commands_total", floatVal, tags, map[string]string{"command": match[2]}))
+				slist.PushFront(types.NewSample(inputName, "global_status_commands_total", floatVal, tags, map[string]string{"command": match[2]}).
+					SetType(types.Counter).SetHelp("Total number of executed MySQL commands."))
 			case "handler":
 				// Total number of executed MySQL handlers.
-				slist.PushFront(types.NewSample(inputName, "global_status_handlers_total", floatVal, tags, map[string]string{"handler": match[2]}))
+				slist.PushFront(types.NewSample(inputName, "global_status_handlers_total", floatVal, tags, map[string]string{"handler": match[2]}).
+					SetType(types.Counter).SetHelp("Total number of executed MySQL handlers."))
 			case "connection_errors":
 				// Total number of MySQL connection errors.
-				slist.PushFront(types.NewSample(inputName, "global_status_connection_errors_total", floatVal, tags, map[string]string{"error": match[2]}))
+				slist.PushFront(types.NewSample(inputName, "global_status_connection_errors_total", floatVal, tags, map[string]string{"error": match[2]}).
+					SetType(types.Counter).SetHelp("Total number of MySQL connection errors."))
 			case "innodb_buffer_pool_pages":
 				switch match[2] {
 				case "data", "free", "misc", "old", "total", "dirty":
 					// Innodb buffer pool pages by state.
-					slist.PushFront(types.NewSample(inputName, "global_status_buffer_pool_pages_"+match[2], floatVal, tags))
+					slist.PushFront(types.NewSample(inputName, "global_status_buffer_pool_pages_"+match[2], floatVal, tags).
+						SetType(types.Gauge).SetHelp("Innodb buffer pool pages by state."))
 				default:
 					// Innodb buffer pool page state changes.
-					slist.PushFront(types.NewSample(inputName, "global_status_buffer_pool_page_changes_total", floatVal, tags, map[string]string{"operation": match[2]}))
+					slist.PushFront(types.NewSample(inputName, "global_status_buffer_pool_page_changes_total", floatVal, tags, map[string]string{"operation": match[2]}).
+						SetType(types.Counter).SetHelp("Innodb buffer pool page state changes."))
 				}
 			case "innodb_rows":
 				// Total number of MySQL InnoDB row operations.
-				slist.PushFront(types.NewSample(inputName, "global_status_innodb_row_ops_total", floatVal, tags, map[string]string{"operation": match[2]}))
+				slist.PushFront(types.NewSample(inputName, "global_status_innodb_row_ops_total", floatVal, tags, map[string]string{"operation": match[2]}).
+					SetType(types.Counter).SetHelp("Total number of MySQL InnoDB row operations."))
 			case "performance_schema":
 				// Total number of MySQL instrumentations that could not be loaded or created due to memory constraints.
-				slist.PushFront(types.NewSample(inputName, "global_status_performance_schema_lost_total", floatVal, tags, map[string]string{"instrumentation": match[2]}))
+				slist.PushFront(types.NewSample(inputName, "global_status_performance_schema_lost_total", floatVal, tags, map[string]string{"instrumentation": match[2]}).
+					SetType(types.Counter).SetHelp("Total number of MySQL instrumentations that could not be loaded or created due to memory constraints."))
 			}
 		}
 	}
@@ -102,7 +189,7 @@ func (ins *Instance) gatherGlobalStatus(slist *types.SampleList, db *sql.DB, glo
 			"wsrep_local_state_uuid":   textItems["wsrep_local_state_uuid"],
 			"wsrep_cluster_state_uuid": textItems["wsrep_cluster_state_uuid"],
 			"wsrep_provider_version":   textItems["wsrep_provider_version"],
-		}))
+		}).SetType(types.Gauge))
 	}
 
 	// mysql_galera_evs_repl_latency
@@ -135,7 +222,7 @@ func (ins *Instance) gatherGlobalStatus(slist *types.SampleList, db *sql.DB, glo
 
 			if evsParsingSuccess {
 				for _, v := range evsMap {
-					slist.PushFront(types.NewSample(inputName, "galera_evs_repl_latency_"+v.name, v.value, tags))
+					slist.PushFront(types.NewSample(inputName, "galera_evs_repl_latency_"+v.name, v.value, tags).SetType(types.Gauge))
 				}
 			}
 		}
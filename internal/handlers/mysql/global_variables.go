@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"github.com/noovertime7/kubemonitor/pkg/tagx"
 	"github.com/noovertime7/kubemonitor/pkg/types"
@@ -10,11 +11,11 @@ import (
 	"strings"
 )
 
-func (ins *Instance) gatherGlobalVariables(slist *types.SampleList, db *sql.DB, globalTags map[string]string, cache map[string]float64) {
+func (ins *Instance) gatherGlobalVariables(ctx context.Context, slist *types.SampleList, db *sql.DB, globalTags map[string]string, cache map[string]float64) {
 	if ins.DisableGlobalStatus {
 		return
 	}
-	rows, err := db.Query(SQL_GLOBAL_VARIABLES)
+	rows, err := db.QueryContext(ctx, SQL_GLOBAL_VARIABLES)
 	if err != nil {
 		logrus.Error("E! failed to query global variables:", err)
 		return
@@ -60,7 +61,7 @@ func (ins *Instance) gatherGlobalVariables(slist *types.SampleList, db *sql.DB,
 				continue
 			}
 
-			slist.PushFront(types.NewSample(inputName, "global_variables_"+key, floatVal, tags))
+			slist.PushFront(types.NewSample(inputName, "global_variables_"+key, floatVal, tags).SetType(types.Gauge))
 			continue
 		}
 	}
@@ -69,19 +70,19 @@ func (ins *Instance) gatherGlobalVariables(slist *types.SampleList, db *sql.DB,
 		"version":         textItems["version"],
 		"innodb_version":  textItems["innodb_version"],
 		"version_comment": textItems["version_comment"],
-	}))
+	}).SetType(types.Gauge))
 
 	// mysql_galera_variables_info metric.
 	// PXC/Galera variables information.
 	if textItems["wsrep_cluster_name"] != "" {
 		slist.PushFront(types.NewSample(inputName, "galera_variables_info", 1, tags, map[string]string{
 			"wsrep_cluster_name": textItems["wsrep_cluster_name"],
-		}))
+		}).SetType(types.Gauge))
 	}
 
 	// mysql_galera_gcache_size_bytes metric.
 	if textItems["wsrep_provider_options"] != "" {
-		slist.PushFront(types.NewSample(inputName, "galera_gcache_size_bytes", parseWsrepProviderOptions(textItems["wsrep_provider_options"]), tags))
+		slist.PushFront(types.NewSample(inputName, "galera_gcache_size_bytes", parseWsrepProviderOptions(textItems["wsrep_provider_options"]), tags).SetType(types.Gauge))
 	}
 
 	if textItems["transaction_isolation"] != "" || textItems["tx_isolation"] != "" {
@@ -90,7 +91,7 @@ func (ins *Instance) gatherGlobalVariables(slist *types.SampleList, db *sql.DB,
 			level = textItems["tx_isolation"]
 		}
 
-		slist.PushFront(types.NewSample(inputName, "transaction_isolation", 1, tags, map[string]string{"level": level}))
+		slist.PushFront(types.NewSample(inputName, "transaction_isolation", 1, tags, map[string]string{"level": level}).SetType(types.Gauge))
 	}
 }
 
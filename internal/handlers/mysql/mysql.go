@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/noovertime7/kubemonitor/pkg/input"
@@ -16,7 +17,9 @@ import (
 const inputName = "mysql"
 
 func init() {
-	input.Factory.RegisterHandler(&Instance{})
+	input.Factory.Register(inputName, func() input.HandlerFactory {
+		return &Instance{}
+	})
 }
 
 type Instance struct {
@@ -49,6 +52,9 @@ func (ins *Instance) Name() string {
 	return inputName
 }
 
+// Drop is a no-op, connections are opened and closed by every Gather.
+func (ins *Instance) Drop() {}
+
 func (ins *Instance) Init(config input.ConfigMap) error {
 	ins.Address = config["address"]
 	ins.Username = config["username"]
@@ -162,7 +168,7 @@ func (ins *Instance) InitValidMetrics() {
 	}
 }
 
-func (ins *Instance) Gather(slist *types.SampleList) error {
+func (ins *Instance) Gather(ctx context.Context, slist *types.SampleList) error {
 	tags := map[string]string{"address": ins.Address}
 
 	begun := time.Now()
@@ -170,12 +176,12 @@ func (ins *Instance) Gather(slist *types.SampleList) error {
 	// scrape use seconds
 	defer func(begun time.Time) {
 		use := time.Since(begun).Seconds()
-		slist.PushSample(inputName, "scrape_use_seconds", use, tags)
+		slist.PushTypedSample(types.Gauge, inputName, "scrape_use_seconds", use, tags)
 	}(begun)
 
 	db, err := sql.Open("mysql", ins.dsn)
 	if err != nil {
-		slist.PushSample(inputName, "up", 0, tags)
+		slist.PushTypedSample(types.Gauge, inputName, "up", 0, tags)
 		logrus.Error("E! failed to open mysql:", err)
 		return err
 	}
@@ -186,27 +192,28 @@ func (ins *Instance) Gather(slist *types.SampleList) error {
 	db.SetMaxIdleConns(1)
 	db.SetConnMaxLifetime(time.Minute)
 
-	if err = db.Ping(); err != nil {
-		slist.PushSample(inputName, "up", 0, tags)
+	if err = db.PingContext(ctx); err != nil {
+		slist.PushTypedSample(types.Gauge, inputName, "up", 0, tags)
 		logrus.Error("E! failed to ping mysql:", err)
 		return err
 	}
 
-	slist.PushSample(inputName, "up", 1, tags)
+	slist.PushTypedSample(types.Gauge, inputName, "up", 1, tags)
 
 	cache := make(map[string]float64)
 
-	ins.gatherGlobalStatus(slist, db, tags, cache)
-	ins.gatherGlobalVariables(slist, db, tags, cache)
-	ins.gatherEngineInnodbStatus(slist, db, tags, cache)
+	ins.gatherGlobalStatus(ctx, slist, db, tags, cache)
+	ins.gatherGlobalVariables(ctx, slist, db, tags, cache)
+	ins.gatherEngineInnodbStatus(ctx, slist, db, tags, cache)
 	ins.gatherEngineInnodbStatusCompute(slist, db, tags, cache)
-	ins.gatherBinlog(slist, db, tags)
-	ins.gatherProcesslistByState(slist, db, tags)
-	ins.gatherProcesslistByUser(slist, db, tags)
-	ins.gatherSchemaSize(slist, db, tags)
-	ins.gatherTableSize(slist, db, tags, false)
-	ins.gatherTableSize(slist, db, tags, true)
-	ins.gatherSlaveStatus(slist, db, tags)
-
-	return nil
+	ins.gatherBinlog(ctx, slist, db, tags)
+	ins.gatherProcesslistByState(ctx, slist, db, tags)
+	ins.gatherProcesslistByUser(ctx, slist, db, tags)
+	ins.gatherSchemaSize(ctx, slist, db, tags)
+	ins.gatherTableSize(ctx, slist, db, tags, false)
+	ins.gatherTableSize(ctx, slist, db, tags, true)
+	ins.gatherSlaveStatus(ctx, slist, db, tags)
+
+	// the queries failing on the gather timeout only log, report it
+	return ctx.Err()
 }
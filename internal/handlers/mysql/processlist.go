@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"github.com/noovertime7/kubemonitor/pkg/tagx"
 	"github.com/noovertime7/kubemonitor/pkg/types"
@@ -88,12 +89,12 @@ var (
 	}
 )
 
-func (ins *Instance) gatherProcesslistByState(slist *types.SampleList, db *sql.DB, globalTags map[string]string) {
+func (ins *Instance) gatherProcesslistByState(ctx context.Context, slist *types.SampleList, db *sql.DB, globalTags map[string]string) {
 	if !ins.GatherProcessListProcessByState {
 		return
 	}
 
-	rows, err := db.Query(SQL_INFO_SCHEMA_PROCESSLIST)
+	rows, err := db.QueryContext(ctx, SQL_INFO_SCHEMA_PROCESSLIST)
 	if err != nil {
 		logrus.Error("E! failed to get processlist:", err)
 		return
@@ -129,7 +130,7 @@ func (ins *Instance) gatherProcesslistByState(slist *types.SampleList, db *sql.D
 	}
 
 	for s, c := range stateCounts {
-		slist.PushFront(types.NewSample(inputName, "processlist_processes_by_state", c, labels, map[string]string{"state": s}))
+		slist.PushFront(types.NewSample(inputName, "processlist_processes_by_state", c, labels, map[string]string{"state": s}).SetType(types.Gauge))
 	}
 }
 
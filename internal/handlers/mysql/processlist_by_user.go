@@ -1,18 +1,19 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"github.com/noovertime7/kubemonitor/pkg/tagx"
 	"github.com/noovertime7/kubemonitor/pkg/types"
 	"github.com/sirupsen/logrus"
 )
 
-func (ins *Instance) gatherProcesslistByUser(slist *types.SampleList, db *sql.DB, globalTags map[string]string) {
+func (ins *Instance) gatherProcesslistByUser(ctx context.Context, slist *types.SampleList, db *sql.DB, globalTags map[string]string) {
 	if !ins.GatherProcessListProcessByUser {
 		return
 	}
 
-	rows, err := db.Query(SQL_INFO_SCHEMA_PROCESSLIST_BY_USER)
+	rows, err := db.QueryContext(ctx, SQL_INFO_SCHEMA_PROCESSLIST_BY_USER)
 	if err != nil {
 		logrus.Error("E! failed to get processlist:", err)
 		return
@@ -32,6 +33,6 @@ func (ins *Instance) gatherProcesslistByUser(slist *types.SampleList, db *sql.DB
 			return
 		}
 
-		slist.PushFront(types.NewSample(inputName, "processlist_processes_by_user", connections, labels, map[string]string{"user": user}))
+		slist.PushFront(types.NewSample(inputName, "processlist_processes_by_user", connections, labels, map[string]string{"user": user}).SetType(types.Gauge))
 	}
 }
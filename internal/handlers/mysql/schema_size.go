@@ -1,18 +1,19 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"github.com/noovertime7/kubemonitor/pkg/tagx"
 	"github.com/noovertime7/kubemonitor/pkg/types"
 	"github.com/sirupsen/logrus"
 )
 
-func (ins *Instance) gatherSchemaSize(slist *types.SampleList, db *sql.DB, globalTags map[string]string) {
+func (ins *Instance) gatherSchemaSize(ctx context.Context, slist *types.SampleList, db *sql.DB, globalTags map[string]string) {
 	if !ins.GatherSchemaSize {
 		return
 	}
 
-	rows, err := db.Query(SQL_QUERY_SCHEMA_SIZE)
+	rows, err := db.QueryContext(ctx, SQL_QUERY_SCHEMA_SIZE)
 	if err != nil {
 		logrus.Error("E! failed to get schema size:", err)
 		return
@@ -32,6 +33,6 @@ func (ins *Instance) gatherSchemaSize(slist *types.SampleList, db *sql.DB, globa
 			return
 		}
 
-		slist.PushFront(types.NewSample(inputName, "schema_size_bytes", size, labels, map[string]string{"schema": schema}))
+		slist.PushFront(types.NewSample(inputName, "schema_size_bytes", size, labels, map[string]string{"schema": schema}).SetType(types.Gauge))
 	}
 }
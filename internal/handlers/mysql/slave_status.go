@@ -1,6 +1,7 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"fmt"
 	"github.com/noovertime7/kubemonitor/pkg/types"
@@ -11,16 +12,16 @@ import (
 var slaveStatusQueries = [2]string{"SHOW ALL SLAVES STATUS", "SHOW SLAVE STATUS"}
 var slaveStatusQuerySuffixes = [3]string{" NONBLOCKING", " NOLOCK", ""}
 
-func querySlaveStatus(db *sql.DB) (rows *sql.Rows, err error) {
+func querySlaveStatus(ctx context.Context, db *sql.DB) (rows *sql.Rows, err error) {
 	for _, query := range slaveStatusQueries {
-		rows, err = db.Query(query)
+		rows, err = db.QueryContext(ctx, query)
 		if err == nil {
 			return rows, nil
 		}
 
 		// Leverage lock-free SHOW SLAVE STATUS by guessing the right suffix
 		for _, suffix := range slaveStatusQuerySuffixes {
-			rows, err = db.Query(fmt.Sprint(query, suffix))
+			rows, err = db.QueryContext(ctx, fmt.Sprint(query, suffix))
 			if err == nil {
 				return rows, nil
 			}
@@ -29,12 +30,12 @@ func querySlaveStatus(db *sql.DB) (rows *sql.Rows, err error) {
 	return
 }
 
-func (ins *Instance) gatherSlaveStatus(slist *types.SampleList, db *sql.DB, globalTags map[string]string) {
+func (ins *Instance) gatherSlaveStatus(ctx context.Context, slist *types.SampleList, db *sql.DB, globalTags map[string]string) {
 	if !ins.GatherSlaveStatus {
 		return
 	}
 
-	rows, err := querySlaveStatus(db)
+	rows, err := querySlaveStatus(ctx, db)
 	if err != nil {
 		logrus.Error("E! failed to query slave status:", err)
 		return
@@ -90,9 +91,22 @@ func (ins *Instance) gatherSlaveStatus(slist *types.SampleList, db *sql.DB, glob
 					"master_host":  masterHost,
 					"master_uuid":  masterUUID,
 					"channel_name": channelName,
-				}))
+				}).SetType(types.Gauge))
 			}
 		}
+
+		// the states are free text, e.g. "Waiting for master to send event", not values to map
+		ioState := columnValue(scanArgs, slaveCols, "Slave_IO_State")
+		sqlState := columnValue(scanArgs, slaveCols, "Slave_SQL_Running_State")
+		if ioState != "" || sqlState != "" {
+			slist.PushFront(types.NewSample(inputName, "slave_status_state_info", 1, globalTags, map[string]string{
+				"master_host":       masterHost,
+				"master_uuid":       masterUUID,
+				"channel_name":      channelName,
+				"io_state":          ioState,
+				"sql_running_state": sqlState,
+			}).SetType(types.Gauge))
+		}
 	}
 }
 
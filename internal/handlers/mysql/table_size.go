@@ -1,13 +1,14 @@
 package mysql
 
 import (
+	"context"
 	"database/sql"
 	"github.com/noovertime7/kubemonitor/pkg/tagx"
 	"github.com/noovertime7/kubemonitor/pkg/types"
 	"github.com/sirupsen/logrus"
 )
 
-func (ins *Instance) gatherTableSize(slist *types.SampleList, db *sql.DB, globalTags map[string]string, isSystem bool) {
+func (ins *Instance) gatherTableSize(ctx context.Context, slist *types.SampleList, db *sql.DB, globalTags map[string]string, isSystem bool) {
 	query := SQL_QUERY_TABLE_SIZE
 	if isSystem {
 		query = SQL_QUERY_SYSTEM_TABLE_SIZE
@@ -20,7 +21,7 @@ func (ins *Instance) gatherTableSize(slist *types.SampleList, db *sql.DB, global
 		}
 	}
 
-	rows, err := db.Query(query)
+	rows, err := db.QueryContext(ctx, query)
 	if err != nil {
 		logrus.Error("E! failed to get table size:", err)
 		return
@@ -40,7 +41,7 @@ func (ins *Instance) gatherTableSize(slist *types.SampleList, db *sql.DB, global
 			return
 		}
 
-		slist.PushFront(types.NewSample(inputName, "table_size_index_bytes", indexSize, labels, map[string]string{"schema": schema, "table": table}))
-		slist.PushFront(types.NewSample(inputName, "table_size_data_bytes", dataSize, labels, map[string]string{"schema": schema, "table": table}))
+		slist.PushFront(types.NewSample(inputName, "table_size_index_bytes", indexSize, labels, map[string]string{"schema": schema, "table": table}).SetType(types.Gauge))
+		slist.PushFront(types.NewSample(inputName, "table_size_data_bytes", dataSize, labels, map[string]string{"schema": schema, "table": table}).SetType(types.Gauge))
 	}
 }
@@ -26,13 +26,17 @@ const (
 )
 
 func init() {
-	input.Factory.RegisterHandler(&Instance{})
+	input.Factory.Register(inputName, func() input.HandlerFactory {
+		return &Instance{}
+	})
 }
 
 type MetricConfig struct {
-	Mesurement       string        `toml:"mesurement"`
-	LabelFields      []string      `toml:"label_fields"`
-	MetricFields     []string      `toml:"metric_fields"`
+	Mesurement   string   `toml:"mesurement"`
+	LabelFields  []string `toml:"label_fields"`
+	MetricFields []string `toml:"metric_fields"`
+	// CounterFields are the metric fields only growing, the others are gauges
+	CounterFields    []string      `toml:"counter_fields"`
 	FieldToAppend    string        `toml:"field_to_append"`
 	Timeout          time.Duration `toml:"timeout"`
 	Request          string        `toml:"request"`
@@ -60,8 +64,56 @@ func (ins *Instance) Name() string {
 	return inputName
 }
 
+// Drop is a no-op, connections are opened and closed by every Gather.
+func (ins *Instance) Drop() {}
+
 var ignoredColumns = map[string]bool{"stats_reset": true}
 
+// statCounters are the pg_stat_database and pg_stat_bgwriter columns only growing since the stats reset
+var statCounters = map[string]bool{
+	"xact_commit":              true,
+	"xact_rollback":            true,
+	"blks_read":                true,
+	"blks_hit":                 true,
+	"tup_returned":             true,
+	"tup_fetched":              true,
+	"tup_inserted":             true,
+	"tup_updated":              true,
+	"tup_deleted":              true,
+	"conflicts":                true,
+	"temp_files":               true,
+	"temp_bytes":               true,
+	"deadlocks":                true,
+	"checksum_failures":        true,
+	"blk_read_time":            true,
+	"blk_write_time":           true,
+	"session_time":             true,
+	"active_time":              true,
+	"idle_in_transaction_time": true,
+	"sessions":                 true,
+	"sessions_abandoned":       true,
+	"sessions_fatal":           true,
+	"sessions_killed":          true,
+	"checkpoints_timed":        true,
+	"checkpoints_req":          true,
+	"checkpoint_write_time":    true,
+	"checkpoint_sync_time":     true,
+	"buffers_checkpoint":       true,
+	"buffers_clean":            true,
+	"maxwritten_clean":         true,
+	"buffers_backend":          true,
+	"buffers_backend_fsync":    true,
+	"buffers_alloc":            true,
+}
+
+// statType returns the type of the stats column, the columns are gauges but the counters.
+func statType(column string) types.ValueType {
+	if statCounters[column] {
+		return types.Counter
+	}
+	return types.Gauge
+}
+
 func (ins *Instance) IgnoredColumns() map[string]bool {
 	return ignoredColumns
 }
@@ -108,7 +160,7 @@ func (ins *Instance) Init(config input.ConfigMap) error {
 	return nil
 }
 
-func (ins *Instance) Gather(slist *types.SampleList) error {
+func (ins *Instance) Gather(ctx context.Context, slist *types.SampleList) error {
 	var (
 		err     error
 		query   string
@@ -120,12 +172,12 @@ func (ins *Instance) Gather(slist *types.SampleList) error {
 	}
 	tags := map[string]string{"server": addr}
 	if ins.db, err = sql.Open("pgx", ins.connConfig); err != nil {
-		slist.PushSample(inputName, "up", 0, tags)
+		slist.PushTypedSample(types.Gauge, inputName, "up", 0, tags)
 		logrus.Error("E! can't open db :", err)
 		return err
 	}
 	defer ins.db.Close()
-	slist.PushSample(inputName, "up", 1, tags)
+	slist.PushTypedSample(types.Gauge, inputName, "up", 1, tags)
 
 	ins.db.SetMaxOpenConns(ins.MaxOpen)
 	ins.db.SetMaxIdleConns(ins.MaxIdle)
@@ -141,7 +193,7 @@ func (ins *Instance) Gather(slist *types.SampleList) error {
 			strings.Join(ins.Databases, "','"))
 	}
 
-	rows, err := ins.db.Query(query)
+	rows, err := ins.db.QueryContext(ctx, query)
 	if err != nil {
 		logrus.Error("E! failed to execute Query :", err)
 		return err
@@ -165,7 +217,7 @@ func (ins *Instance) Gather(slist *types.SampleList) error {
 
 	query = `SELECT * FROM pg_stat_bgwriter`
 
-	bgWriterRow, err := ins.db.Query(query)
+	bgWriterRow, err := ins.db.QueryContext(ctx, query)
 	if err != nil {
 		logrus.Error("E! failed to execute Query:", err)
 		return err
@@ -193,18 +245,18 @@ func (ins *Instance) Gather(slist *types.SampleList) error {
 		m := ins.Metrics[i]
 		waitMetrics.Add(1)
 		tags := map[string]string{}
-		go ins.scrapeMetric(waitMetrics, slist, m, tags)
+		go ins.scrapeMetric(ctx, waitMetrics, slist, m, tags)
 	}
 
 	waitMetrics.Wait()
 	return nil
 }
 
-func (ins *Instance) scrapeMetric(waitMetrics *sync.WaitGroup, slist *types.SampleList, metricConf MetricConfig, tags map[string]string) {
+func (ins *Instance) scrapeMetric(gatherCtx context.Context, waitMetrics *sync.WaitGroup, slist *types.SampleList, metricConf MetricConfig, tags map[string]string) {
 	defer waitMetrics.Done()
 
 	timeout := metricConf.Timeout
-	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	ctx, cancel := context.WithTimeout(gatherCtx, timeout)
 	defer cancel()
 
 	rows, err := ins.db.QueryContext(ctx, metricConf.Request)
@@ -276,6 +328,14 @@ func (ins *Instance) parseRow(row map[string]string, metricConf MetricConfig, sl
 	}
 
 	for _, column := range metricConf.MetricFields {
+		valueType := types.Gauge
+		for _, counter := range metricConf.CounterFields {
+			if counter == column {
+				valueType = types.Counter
+				break
+			}
+		}
+
 		value, err := conv.ToFloat64(row[column])
 		if err != nil {
 			logrus.Error("E! failed to convert field:", column, "value:", value, "error:", err)
@@ -283,10 +343,10 @@ func (ins *Instance) parseRow(row map[string]string, metricConf MetricConfig, sl
 		}
 
 		if metricConf.FieldToAppend == "" {
-			slist.PushSample(inputName, metricConf.Mesurement+"_"+column, value, labels)
+			slist.PushTypedSample(valueType, inputName, metricConf.Mesurement+"_"+column, value, labels)
 		} else {
 			suffix := cleanName(row[metricConf.FieldToAppend])
-			slist.PushSample(inputName, metricConf.Mesurement+"_"+suffix+"_"+column, value, labels)
+			slist.PushTypedSample(valueType, inputName, metricConf.Mesurement+"_"+suffix+"_"+column, value, labels)
 		}
 	}
 
@@ -368,7 +428,7 @@ func (ins *Instance) accRow(row scanner, slist *types.SampleList, columns []stri
 	}
 	// acc.AddFields("postgresql", fields, tags)
 	for key, val := range fields {
-		slist.PushSample(inputName, key, val, tags)
+		slist.PushTypedSample(statType(key), inputName, key, val, tags)
 	}
 	return nil
 }
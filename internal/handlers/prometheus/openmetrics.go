@@ -0,0 +1,237 @@
+package prometheus
+
+import (
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/textparse"
+)
+
+const openMetricsType = "application/openmetrics-text"
+
+// familySuffixes are the suffixes of the series of every metric type, the _created series
+// are not written.
+var familySuffixes = map[textparse.MetricType][]string{
+	textparse.MetricTypeCounter:        {"_total", "_created"},
+	textparse.MetricTypeHistogram:      {"_bucket", "_count", "_sum", "_created"},
+	textparse.MetricTypeGaugeHistogram: {"_bucket", "_gcount", "_gsum"},
+	textparse.MetricTypeSummary:        {"_count", "_sum", "_created"},
+	textparse.MetricTypeInfo:           {"_info"},
+}
+
+// declared is the metadata of a family of an OpenMetrics body.
+type declared struct {
+	typ  textparse.MetricType
+	help string
+	unit string
+}
+
+// openMetricsDecoder assembles the series of an OpenMetrics body into metric families, the way
+// expfmt does for the text exposition format.
+type openMetricsDecoder struct {
+	declared map[string]*declared
+	families map[string]*dto.MetricFamily
+	metrics  map[string]*dto.Metric
+	order    []*dto.MetricFamily
+	units    map[string]string
+}
+
+// decodeOpenMetrics returns the metric families of body and the units of the families having one.
+func decodeOpenMetrics(body []byte, contentType string) ([]*dto.MetricFamily, map[string]string, error) {
+	parser, err := textparse.New(body, contentType, false)
+	if err != nil {
+		return nil, nil, err
+	}
+	d := &openMetricsDecoder{
+		declared: map[string]*declared{},
+		families: map[string]*dto.MetricFamily{},
+		metrics:  map[string]*dto.Metric{},
+		units:    map[string]string{},
+	}
+
+	var lset labels.Labels
+	for {
+		entry, err := parser.Next()
+		if err == io.EOF {
+			return d.order, d.units, nil
+		}
+		if err != nil {
+			return nil, nil, err
+		}
+		switch entry {
+		case textparse.EntryType:
+			name, typ := parser.Type()
+			d.declare(string(name)).typ = typ
+		case textparse.EntryHelp:
+			name, help := parser.Help()
+			d.declare(string(name)).help = string(help)
+		case textparse.EntryUnit:
+			name, unit := parser.Unit()
+			d.declare(string(name)).unit = string(unit)
+		case textparse.EntrySeries:
+			_, ts, value := parser.Series()
+			parser.Metric(&lset)
+			if err := d.add(lset, ts, value); err != nil {
+				return nil, nil, err
+			}
+		}
+	}
+}
+
+func (d *openMetricsDecoder) declare(name string) *declared {
+	f, ok := d.declared[name]
+	if !ok {
+		f = &declared{}
+		d.declared[name] = f
+	}
+	return f
+}
+
+// add adds a series to the metric of its family, the bucket, quantile, _count and _sum series
+// of a histogram or summary make up a single metric.
+func (d *openMetricsDecoder) add(lset labels.Labels, ts *int64, value float64) error {
+	mf, suffix := d.family(lset.Get(model.MetricNameLabel))
+	if mf == nil {
+		return nil
+	}
+
+	builder := labels.NewBuilder(lset).Del(model.MetricNameLabel)
+	if typ := mf.GetType(); typ == dto.MetricType_HISTOGRAM || typ == dto.MetricType_GAUGE_HISTOGRAM ||
+		typ == dto.MetricType_SUMMARY {
+		builder.Del(model.BucketLabel, model.QuantileLabel)
+	}
+	m := d.metric(mf, builder.Labels())
+	if ts != nil {
+		m.TimestampMs = ts
+	}
+
+	switch mf.GetType() {
+	case dto.MetricType_COUNTER:
+		m.Counter = &dto.Counter{Value: &value}
+	case dto.MetricType_GAUGE:
+		m.Gauge = &dto.Gauge{Value: &value}
+	case dto.MetricType_SUMMARY:
+		if m.Summary == nil {
+			m.Summary = &dto.Summary{}
+		}
+		switch suffix {
+		case "_count":
+			count := uint64(value)
+			m.Summary.SampleCount = &count
+		case "_sum":
+			m.Summary.SampleSum = &value
+		default:
+			quantile, err := strconv.ParseFloat(lset.Get(model.QuantileLabel), 64)
+			if err != nil {
+				return fmt.Errorf("invalid quantile of %s: %v", mf.GetName(), err)
+			}
+			m.Summary.Quantile = append(m.Summary.Quantile, &dto.Quantile{Quantile: &quantile, Value: &value})
+		}
+	case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+		if m.Histogram == nil {
+			m.Histogram = &dto.Histogram{}
+		}
+		switch suffix {
+		case "_count", "_gcount":
+			m.Histogram.SampleCountFloat = &value
+		case "_sum", "_gsum":
+			m.Histogram.SampleSum = &value
+		case "_bucket":
+			upperBound, err := strconv.ParseFloat(lset.Get(model.BucketLabel), 64)
+			if err != nil {
+				return fmt.Errorf("invalid le of %s: %v", mf.GetName(), err)
+			}
+			m.Histogram.Bucket = append(m.Histogram.Bucket, &dto.Bucket{UpperBound: &upperBound, CumulativeCountFloat: &value})
+		}
+	default:
+		m.Untyped = &dto.Untyped{Value: &value}
+	}
+	return nil
+}
+
+// family returns the family the series named metric belongs to and the suffix of the series,
+// nil for the _created series. The counters and infos are written under the name of their
+// series, the histograms and summaries under the name of their family.
+func (d *openMetricsDecoder) family(metric string) (*dto.MetricFamily, string) {
+	if f, ok := d.declared[metric]; ok {
+		switch f.typ {
+		case textparse.MetricTypeGauge, textparse.MetricTypeStateset, textparse.MetricTypeSummary:
+			return d.output(metric, f), ""
+		}
+	}
+	for typ, suffixes := range familySuffixes {
+		for _, suffix := range suffixes {
+			name := strings.TrimSuffix(metric, suffix)
+			f, ok := d.declared[name]
+			if name == metric || !ok || f.typ != typ {
+				continue
+			}
+			switch {
+			case suffix == "_created":
+				return nil, suffix
+			case typ == textparse.MetricTypeCounter || typ == textparse.MetricTypeInfo:
+				return d.output(metric, f), suffix
+			default:
+				return d.output(name, f), suffix
+			}
+		}
+	}
+	return d.output(metric, d.declared[metric]), ""
+}
+
+// output returns the family written as name, typed after f when declared.
+func (d *openMetricsDecoder) output(name string, f *declared) *dto.MetricFamily {
+	if mf, ok := d.families[name]; ok {
+		return mf
+	}
+	mf := &dto.MetricFamily{Name: &name, Type: dto.MetricType_UNTYPED.Enum()}
+	if f != nil {
+		help := f.help
+		mf.Help, mf.Type = &help, familyType(f.typ).Enum()
+		if f.unit != "" {
+			d.units[name] = f.unit
+		}
+	}
+	d.families[name] = mf
+	d.order = append(d.order, mf)
+	return mf
+}
+
+// metric returns the metric of mf having the labels lset.
+func (d *openMetricsDecoder) metric(mf *dto.MetricFamily, lset labels.Labels) *dto.Metric {
+	key := mf.GetName() + lset.String()
+	if m, ok := d.metrics[key]; ok {
+		return m
+	}
+	m := &dto.Metric{}
+	lset.Range(func(l labels.Label) {
+		name, value := l.Name, l.Value
+		m.Label = append(m.Label, &dto.LabelPair{Name: &name, Value: &value})
+	})
+	d.metrics[key] = m
+	mf.Metric = append(mf.Metric, m)
+	return m
+}
+
+// familyType converts an OpenMetrics type, the infos and statesets are gauges.
+func familyType(typ textparse.MetricType) dto.MetricType {
+	switch typ {
+	case textparse.MetricTypeCounter:
+		return dto.MetricType_COUNTER
+	case textparse.MetricTypeGauge, textparse.MetricTypeInfo, textparse.MetricTypeStateset:
+		return dto.MetricType_GAUGE
+	case textparse.MetricTypeHistogram:
+		return dto.MetricType_HISTOGRAM
+	case textparse.MetricTypeGaugeHistogram:
+		return dto.MetricType_GAUGE_HISTOGRAM
+	case textparse.MetricTypeSummary:
+		return dto.MetricType_SUMMARY
+	default:
+		return dto.MetricType_UNTYPED
+	}
+}
@@ -0,0 +1,365 @@
+package prometheus
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"mime"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/noovertime7/kubemonitor/pkg/input"
+	"github.com/noovertime7/kubemonitor/pkg/types"
+	"github.com/sirupsen/logrus"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"github.com/prometheus/common/model"
+)
+
+const inputName = "prometheus"
+
+// acceptHeader prefers the protobuf format, the only one carrying native histograms, then
+// OpenMetrics and the text exposition format, as Prometheus does with native histograms enabled
+const acceptHeader = `application/vnd.google.protobuf;proto=io.prometheus.client.MetricFamily;encoding=delimited;q=0.5,application/openmetrics-text;version=1.0.0;q=0.4,application/openmetrics-text;version=0.0.1;q=0.3,text/plain;version=0.0.4;q=0.2,*/*;q=0.1`
+
+const defaultTimeout = 10 * time.Second
+
+func init() {
+	input.Factory.Register(inputName, func() input.HandlerFactory {
+		return &Instance{}
+	})
+}
+
+// Instance scrapes the /metrics endpoints of URLs, every URL is a target with its own instance label.
+type Instance struct {
+	URLs []string `toml:"urls"`
+	// HonorLabels keeps the scraped labels conflicting with the target labels,
+	// otherwise they are renamed to exported_<label>
+	HonorLabels bool          `toml:"honor_labels"`
+	Timeout     time.Duration `toml:"timeout"`
+	Username    string        `toml:"username"`
+	Password    string        `toml:"password"`
+	BearerToken string        `toml:"bearer_token"`
+
+	client *http.Client
+}
+
+func (ins *Instance) Name() string {
+	return inputName
+}
+
+func (ins *Instance) Drop() {
+	if ins.client != nil {
+		ins.client.CloseIdleConnections()
+	}
+}
+
+func (ins *Instance) Init(config input.ConfigMap) error {
+	for _, u := range config.ParseSlice("urls") {
+		u = strings.TrimSpace(u)
+		if u == "" {
+			continue
+		}
+		if _, err := url.Parse(u); err != nil {
+			return fmt.Errorf("invalid url %s: %v", u, err)
+		}
+		ins.URLs = append(ins.URLs, u)
+	}
+	if len(ins.URLs) == 0 {
+		return fmt.Errorf("urls is empty")
+	}
+
+	ins.HonorLabels = config.ParseBool("honor_labels")
+	ins.Username = config.Get("username")
+	ins.Password = config.Get("password")
+	ins.BearerToken = config.Get("bearer_token")
+
+	ins.Timeout = defaultTimeout
+	if timeout := config.Get("timeout"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return fmt.Errorf("invalid timeout %s: %v", timeout, err)
+		}
+		ins.Timeout = d
+	}
+
+	ins.client = &http.Client{Timeout: ins.Timeout}
+	return nil
+}
+
+func (ins *Instance) Gather(ctx context.Context, slist *types.SampleList) error {
+	var (
+		wg   sync.WaitGroup
+		lock sync.Mutex
+		errs []error
+	)
+	for _, u := range ins.URLs {
+		wg.Add(1)
+		go func(u string) {
+			defer wg.Done()
+			if err := ins.gatherTarget(ctx, u, slist); err != nil {
+				logrus.Error("E! failed to scrape:", u, " error:", err)
+				lock.Lock()
+				errs = append(errs, fmt.Errorf("scrape %s: %w", u, err))
+				lock.Unlock()
+			}
+		}(u)
+	}
+	wg.Wait()
+	return errors.Join(errs...)
+}
+
+// gatherTarget scrapes u and pushes its samples along with up and scrape_duration_seconds.
+// The synthetic series are left out when the target exposes a metric of the same name,
+// which would otherwise be written twice.
+func (ins *Instance) gatherTarget(ctx context.Context, u string, slist *types.SampleList) error {
+	targetLabels := map[string]string{model.InstanceLabel: instance(u)}
+	begun := time.Now()
+
+	samples, err := ins.scrape(ctx, u, targetLabels)
+
+	scraped := make(map[string]bool, len(samples))
+	for _, s := range samples {
+		scraped[s.Metric] = true
+	}
+	push := func(metric string, value interface{}) {
+		if !scraped[metric] {
+			slist.PushFront(types.NewSample("", metric, value, targetLabels))
+		}
+	}
+
+	push("scrape_duration_seconds", time.Since(begun).Seconds())
+	if err != nil {
+		push("up", 0)
+		return err
+	}
+	push("up", 1)
+	push("scrape_samples_scraped", len(samples))
+	slist.PushFrontN(samples)
+	return nil
+}
+
+func (ins *Instance) scrape(ctx context.Context, u string, targetLabels map[string]string) ([]*types.Sample, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", acceptHeader)
+	if ins.Username != "" || ins.Password != "" {
+		req.SetBasicAuth(ins.Username, ins.Password)
+	}
+	if ins.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+ins.BearerToken)
+	}
+
+	resp, err := ins.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("server returned HTTP status %s", resp.Status)
+	}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, err
+	}
+
+	return ins.parse(body, resp.Header, targetLabels)
+}
+
+// parse converts the body into samples carrying the target labels, the histograms and summaries
+// are assembled into distributions.
+func (ins *Instance) parse(body []byte, header http.Header, targetLabels map[string]string) ([]*types.Sample, error) {
+	var (
+		families []*dto.MetricFamily
+		units    map[string]string
+		err      error
+	)
+	contentType := header.Get("Content-Type")
+	if mediaType, _, _ := mime.ParseMediaType(contentType); mediaType == openMetricsType {
+		families, units, err = decodeOpenMetrics(body, contentType)
+	} else {
+		families, err = decode(body, expfmt.ResponseFormat(header))
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var samples []*types.Sample
+	for _, mf := range families {
+		samples = append(samples, ins.convert(mf, units[mf.GetName()], targetLabels)...)
+	}
+	return samples, nil
+}
+
+// decode reads the metric families of a protobuf or text exposition body.
+func decode(body []byte, format expfmt.Format) ([]*dto.MetricFamily, error) {
+	var (
+		families []*dto.MetricFamily
+		decoder  = expfmt.NewDecoder(bytes.NewReader(body), format)
+	)
+	for {
+		mf := &dto.MetricFamily{}
+		err := decoder.Decode(mf)
+		if err == io.EOF {
+			return families, nil
+		}
+		if err != nil {
+			return nil, err
+		}
+		families = append(families, mf)
+	}
+}
+
+// convert returns a sample for every metric of mf, the untyped ones get no ValueType.
+func (ins *Instance) convert(mf *dto.MetricFamily, unit string, targetLabels map[string]string) []*types.Sample {
+	samples := make([]*types.Sample, 0, len(mf.GetMetric()))
+	for _, m := range mf.GetMetric() {
+		s := &types.Sample{
+			Metric: mf.GetName(),
+			Help:   mf.GetHelp(),
+			Unit:   unit,
+			Labels: make(map[string]string, len(m.GetLabel())+len(targetLabels)),
+		}
+		for _, l := range m.GetLabel() {
+			s.Labels[l.GetName()] = l.GetValue()
+		}
+		ins.mergeTargetLabels(s.Labels, targetLabels)
+		if m.TimestampMs != nil {
+			s.Timestamp = time.UnixMilli(m.GetTimestampMs())
+		}
+
+		switch mf.GetType() {
+		case dto.MetricType_COUNTER:
+			s.Type, s.Value = types.Counter, m.GetCounter().GetValue()
+		case dto.MetricType_GAUGE:
+			s.Type, s.Value = types.Gauge, m.GetGauge().GetValue()
+		case dto.MetricType_SUMMARY:
+			s.Type, s.Value = types.Summary, summaryValue(m.GetSummary())
+		case dto.MetricType_HISTOGRAM, dto.MetricType_GAUGE_HISTOGRAM:
+			s.Type, s.Value = types.Histogram, histogramValue(m.GetHistogram())
+		default:
+			s.Value = m.GetUntyped().GetValue()
+		}
+		samples = append(samples, s)
+	}
+	return samples
+}
+
+// summaryValue converts a scraped summary, its sum is unknown when not exposed.
+func summaryValue(s *dto.Summary) *types.SummaryValue {
+	v := &types.SummaryValue{Count: float64(s.GetSampleCount()), Sum: math.NaN()}
+	if s.SampleSum != nil {
+		v.Sum = s.GetSampleSum()
+	}
+	for _, q := range s.GetQuantile() {
+		v.Quantiles = append(v.Quantiles, types.Quantile{Quantile: q.GetQuantile(), Value: q.GetValue()})
+	}
+	return v
+}
+
+// histogramValue converts a scraped histogram, with its native buckets when it has some.
+func histogramValue(h *dto.Histogram) *types.HistogramValue {
+	v := &types.HistogramValue{Count: float64(h.GetSampleCount()), Sum: math.NaN()}
+	if h.GetSampleCountFloat() > 0 {
+		v.Count = h.GetSampleCountFloat()
+	}
+	if h.SampleSum != nil {
+		v.Sum = h.GetSampleSum()
+	}
+	for _, b := range h.GetBucket() {
+		if math.IsInf(b.GetUpperBound(), 1) {
+			continue
+		}
+		count := float64(b.GetCumulativeCount())
+		if b.GetCumulativeCountFloat() > 0 {
+			count = b.GetCumulativeCountFloat()
+		}
+		v.Buckets = append(v.Buckets, types.Bucket{UpperBound: b.GetUpperBound(), Count: count})
+	}
+	sort.Slice(v.Buckets, func(i, j int) bool { return v.Buckets[i].UpperBound < v.Buckets[j].UpperBound })
+
+	if !isNative(h) {
+		return v
+	}
+	v.Native = &types.NativeBuckets{
+		Schema:        h.GetSchema(),
+		ZeroThreshold: h.GetZeroThreshold(),
+		ZeroCount:     float64(h.GetZeroCount()),
+		Positive:      nativeBuckets(h.GetPositiveSpan(), h.GetPositiveDelta(), h.GetPositiveCount()),
+		Negative:      nativeBuckets(h.GetNegativeSpan(), h.GetNegativeDelta(), h.GetNegativeCount()),
+	}
+	if h.GetZeroCountFloat() > 0 {
+		v.Native.ZeroCount = h.GetZeroCountFloat()
+	}
+	return v
+}
+
+// isNative reports whether h has native buckets, the way Prometheus tells them apart from the
+// classic histograms.
+func isNative(h *dto.Histogram) bool {
+	return h.GetZeroThreshold() > 0 || h.GetZeroCount() > 0 || h.GetZeroCountFloat() > 0 ||
+		len(h.GetPositiveSpan()) > 0 || len(h.GetNegativeSpan()) > 0
+}
+
+// nativeBuckets returns the bucket counts by index of the spans, given as deltas for the integer
+// histograms and as absolute counts for the float ones. The offset of the first span is the index
+// of its first bucket, the next ones the gap from the previous span.
+func nativeBuckets(spans []*dto.BucketSpan, deltas []int64, counts []float64) map[int]float64 {
+	var (
+		buckets = map[int]float64{}
+		index   int
+		next    int
+		count   int64
+	)
+	for _, span := range spans {
+		index += int(span.GetOffset())
+		for i := uint32(0); i < span.GetLength(); i++ {
+			switch {
+			case next < len(counts):
+				buckets[index] = counts[next]
+			case next < len(deltas):
+				count += deltas[next]
+				buckets[index] = float64(count)
+			}
+			index++
+			next++
+		}
+	}
+	return buckets
+}
+
+// mergeTargetLabels adds the target labels to the scraped labels, following honor_labels on conflicts.
+func (ins *Instance) mergeTargetLabels(scraped, targetLabels map[string]string) {
+	for k, v := range targetLabels {
+		existing, has := scraped[k]
+		if !has {
+			scraped[k] = v
+			continue
+		}
+		if ins.HonorLabels {
+			continue
+		}
+		scraped[model.ExportedLabelPrefix+k] = existing
+		scraped[k] = v
+	}
+}
+
+// instance returns the host:port of u, the instance label of its target.
+func instance(u string) string {
+	parsed, err := url.Parse(u)
+	if err != nil || parsed.Host == "" {
+		return u
+	}
+	return parsed.Host
+}
@@ -0,0 +1,181 @@
+package prometheus
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/noovertime7/kubemonitor/pkg/input"
+	"github.com/noovertime7/kubemonitor/pkg/types"
+
+	dto "github.com/prometheus/client_model/go"
+	"github.com/prometheus/common/expfmt"
+	"google.golang.org/protobuf/proto"
+)
+
+func TestGather(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/openmetrics-text; version=1.0.0; charset=utf-8")
+		_, _ = w.Write([]byte("# TYPE http_requests counter\nhttp_requests_total{code=\"200\",instance=\"app\"} 3\n# EOF\n"))
+	}))
+	defer server.Close()
+
+	for _, honorLabels := range []string{"false", "true"} {
+		ins := &Instance{}
+		if err := ins.Init(input.ConfigMap{"urls": server.URL, "honor_labels": honorLabels}); err != nil {
+			t.Fatal(err)
+		}
+
+		slist := types.NewSampleList()
+		if err := ins.Gather(context.Background(), slist); err != nil {
+			t.Fatal(err)
+		}
+
+		var found *types.Sample
+		for _, s := range slist.PopBackAll() {
+			if s.Metric == "http_requests_total" {
+				found = s
+			}
+		}
+		if found == nil || found.Value != float64(3) || found.Labels["code"] != "200" {
+			t.Fatalf("honor_labels=%s: http_requests_total = %+v", honorLabels, found)
+		}
+		if found.Type != types.Counter {
+			t.Errorf("honor_labels=%s: type = %v, want the counter of the TYPE line", honorLabels, found.Type)
+		}
+		if honorLabels == "true" && found.Labels["instance"] != "app" {
+			t.Errorf("honor_labels=true: instance = %q, want the scraped app", found.Labels["instance"])
+		}
+		if honorLabels == "false" && (found.Labels["instance"] != instance(server.URL) || found.Labels["exported_instance"] != "app") {
+			t.Errorf("honor_labels=false: labels = %v, want the target instance and exported_instance", found.Labels)
+		}
+	}
+}
+
+func TestGatherScrapedUp(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain; version=0.0.4")
+		_, _ = w.Write([]byte("# TYPE up gauge\nup 0\n"))
+	}))
+	defer server.Close()
+
+	ins := &Instance{}
+	if err := ins.Init(input.ConfigMap{"urls": server.URL}); err != nil {
+		t.Fatal(err)
+	}
+	slist := types.NewSampleList()
+	if err := ins.Gather(context.Background(), slist); err != nil {
+		t.Fatal(err)
+	}
+
+	var ups []*types.Sample
+	for _, s := range slist.PopBackAll() {
+		if s.Metric == "up" {
+			ups = append(ups, s)
+		}
+	}
+	if len(ups) != 1 || ups[0].Value != float64(0) {
+		t.Fatalf("up = %+v, want only the scraped series", ups)
+	}
+}
+
+// gatherFrom gathers the target served by handler and returns its samples by metric.
+func gatherFrom(t *testing.T, handler http.HandlerFunc) map[string]*types.Sample {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	defer server.Close()
+
+	ins := &Instance{}
+	if err := ins.Init(input.ConfigMap{"urls": server.URL}); err != nil {
+		t.Fatal(err)
+	}
+	slist := types.NewSampleList()
+	if err := ins.Gather(context.Background(), slist); err != nil {
+		t.Fatal(err)
+	}
+	samples := map[string]*types.Sample{}
+	for _, s := range slist.PopBackAll() {
+		samples[s.Metric] = s
+	}
+	return samples
+}
+
+func TestGatherDistributions(t *testing.T) {
+	const text = `# TYPE rpc_seconds histogram
+rpc_seconds_bucket{le="0.1"} 1
+rpc_seconds_bucket{le="1"} 3
+rpc_seconds_bucket{le="+Inf"} 4
+rpc_seconds_sum 5.5
+rpc_seconds_count 4
+# TYPE rpc_quantiles summary
+rpc_quantiles{quantile="0.5"} 0.2
+rpc_quantiles{quantile="0.9"} 0.8
+rpc_quantiles_sum 5.5
+rpc_quantiles_count 4
+`
+	tests := []struct {
+		contentType string
+		body        string
+	}{
+		{contentType: "text/plain; version=0.0.4", body: text},
+		{contentType: "application/openmetrics-text; version=1.0.0; charset=utf-8", body: text + "# EOF\n"},
+	}
+	for _, tt := range tests {
+		samples := gatherFrom(t, func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", tt.contentType)
+			_, _ = w.Write([]byte(tt.body))
+		})
+
+		histogram := &types.HistogramValue{Count: 4, Sum: 5.5, Buckets: []types.Bucket{{UpperBound: 0.1, Count: 1}, {UpperBound: 1, Count: 3}}}
+		if s := samples["rpc_seconds"]; s == nil || s.Type != types.Histogram || !reflect.DeepEqual(s.Value, histogram) {
+			t.Errorf("%s: rpc_seconds = %+v, want %+v", tt.contentType, s, histogram)
+		}
+		summary := &types.SummaryValue{Count: 4, Sum: 5.5, Quantiles: []types.Quantile{{Quantile: 0.5, Value: 0.2}, {Quantile: 0.9, Value: 0.8}}}
+		if s := samples["rpc_quantiles"]; s == nil || s.Type != types.Summary || !reflect.DeepEqual(s.Value, summary) {
+			t.Errorf("%s: rpc_quantiles = %+v, want %+v", tt.contentType, s, summary)
+		}
+		for _, metric := range []string{"rpc_seconds_bucket", "rpc_seconds_count", "rpc_quantiles_sum"} {
+			if _, ok := samples[metric]; ok {
+				t.Errorf("%s: %s is a sample of its own", tt.contentType, metric)
+			}
+		}
+	}
+}
+
+func TestGatherNativeHistogram(t *testing.T) {
+	mf := &dto.MetricFamily{
+		Name: proto.String("rpc_seconds"),
+		Type: dto.MetricType_HISTOGRAM.Enum(),
+		Metric: []*dto.Metric{{Histogram: &dto.Histogram{
+			SampleCount:   proto.Uint64(8),
+			SampleSum:     proto.Float64(10),
+			Schema:        proto.Int32(0),
+			ZeroThreshold: proto.Float64(1e-128),
+			ZeroCount:     proto.Uint64(1),
+			PositiveSpan: []*dto.BucketSpan{
+				{Offset: proto.Int32(1), Length: proto.Uint32(2)},
+				{Offset: proto.Int32(2), Length: proto.Uint32(1)},
+			},
+			PositiveDelta: []int64{2, -1, 3},
+		}}},
+	}
+	samples := gatherFrom(t, func(w http.ResponseWriter, r *http.Request) {
+		format := expfmt.Negotiate(r.Header)
+		w.Header().Set("Content-Type", string(format))
+		if err := expfmt.NewEncoder(w, format).Encode(mf); err != nil {
+			t.Error(err)
+		}
+	})
+
+	want := &types.HistogramValue{Count: 8, Sum: 10, Native: &types.NativeBuckets{
+		ZeroThreshold: 1e-128,
+		ZeroCount:     1,
+		Positive:      map[int]float64{1: 2, 2: 1, 5: 4},
+		Negative:      map[int]float64{},
+	}}
+	if s := samples["rpc_seconds"]; s == nil || s.Type != types.Histogram || !reflect.DeepEqual(s.Value, want) {
+		t.Fatalf("rpc_seconds = %+v, want the native histogram %+v", s, want)
+	}
+}
@@ -19,7 +19,9 @@ import (
 const inputName = "redis"
 
 func init() {
-	input.Factory.RegisterHandler(&Instance{})
+	input.Factory.Register(inputName, func() input.HandlerFactory {
+		return &Instance{}
+	})
 }
 
 var replicationSlaveMetricPrefix = regexp.MustCompile(`^slave\d+`)
@@ -44,6 +46,15 @@ func (ins *Instance) Name() string {
 	return inputName
 }
 
+func (ins *Instance) Drop() {
+	if ins.client == nil {
+		return
+	}
+	if err := ins.client.Close(); err != nil {
+		logrus.Error("E! failed to close redis client:", ins.Address, "error:", err)
+	}
+}
+
 func (ins *Instance) Init(config input.ConfigMap) error {
 	ins.Address = config.Get("address")
 	ins.Username = config.Get("username")
@@ -76,36 +87,36 @@ func (ins *Instance) Init(config input.ConfigMap) error {
 	return nil
 }
 
-func (ins *Instance) Gather(slist *types.SampleList) error {
+func (ins *Instance) Gather(ctx context.Context, slist *types.SampleList) error {
 	tags := map[string]string{"address": ins.Address}
 	begun := time.Now()
 
 	// scrape use seconds
 	defer func(begun time.Time) {
 		use := time.Since(begun).Seconds()
-		slist.PushFront(types.NewSample(inputName, "scrape_use_seconds", use, tags))
+		slist.PushFront(types.NewSample(inputName, "scrape_use_seconds", use, tags).SetType(types.Gauge).SetUnit("seconds"))
 	}(begun)
 
 	// ping
-	err := ins.client.Ping(context.Background()).Err()
-	slist.PushFront(types.NewSample(inputName, "ping_use_seconds", time.Since(begun).Seconds(), tags))
+	err := ins.client.Ping(ctx).Err()
+	slist.PushFront(types.NewSample(inputName, "ping_use_seconds", time.Since(begun).Seconds(), tags).SetType(types.Gauge).SetUnit("seconds"))
 	if err != nil {
-		slist.PushFront(types.NewSample(inputName, "up", 0, tags))
+		slist.PushFront(types.NewSample(inputName, "up", 0, tags).SetType(types.Gauge))
 		logrus.Error("E! failed to ping redis:", ins.Address, "error:", err)
 		return err
 	} else {
-		slist.PushFront(types.NewSample(inputName, "up", 1, tags))
+		slist.PushFront(types.NewSample(inputName, "up", 1, tags).SetType(types.Gauge))
 	}
 
-	ins.gatherInfoAll(slist, tags)
-	ins.gatherCommandValues(slist, tags)
-	return nil
+	ins.gatherInfoAll(ctx, slist, tags)
+	ins.gatherCommandValues(ctx, slist, tags)
+	return ctx.Err()
 }
 
-func (ins *Instance) gatherCommandValues(slist *types.SampleList, tags map[string]string) {
+func (ins *Instance) gatherCommandValues(ctx context.Context, slist *types.SampleList, tags map[string]string) {
 	fields := make(map[string]interface{})
 	for _, cmd := range ins.Commands {
-		val, err := ins.client.Do(context.Background(), cmd.Command...).Result()
+		val, err := ins.client.Do(ctx, cmd.Command...).Result()
 		if err != nil {
 			logrus.Error("E! failed to exec redis command:", cmd.Command)
 			continue
@@ -128,10 +139,10 @@ func (ins *Instance) gatherCommandValues(slist *types.SampleList, tags map[strin
 	}
 }
 
-func (ins *Instance) gatherInfoAll(slist *types.SampleList, tags map[string]string) {
-	info, err := ins.client.Info(context.Background(), "ALL").Result()
+func (ins *Instance) gatherInfoAll(ctx context.Context, slist *types.SampleList, tags map[string]string) {
+	info, err := ins.client.Info(ctx, "ALL").Result()
 	if err != nil || len(info) == 0 {
-		info, err = ins.client.Info(context.Background()).Result()
+		info, err = ins.client.Info(ctx).Result()
 	}
 
 	if err != nil {
@@ -247,10 +258,49 @@ func (ins *Instance) gatherInfoAll(slist *types.SampleList, tags map[string]stri
 	fields["keyspace_hitrate"] = keyspaceHitrate
 
 	for k, v := range fields {
-		slist.PushFront(types.NewSample(inputName, k, v, tags))
+		slist.PushFront(types.NewSample(inputName, k, v, tags).SetType(infoType(k)))
 	}
 }
 
+// infoCounters are the INFO fields only growing since the server started
+var infoCounters = map[string]bool{
+	"total_connections_received":     true,
+	"total_commands_processed":       true,
+	"total_net_input_bytes":          true,
+	"total_net_output_bytes":         true,
+	"total_net_repl_input_bytes":     true,
+	"total_net_repl_output_bytes":    true,
+	"total_error_replies":            true,
+	"total_reads_processed":          true,
+	"total_writes_processed":         true,
+	"total_forks":                    true,
+	"total_eviction_exceeded_time":   true,
+	"rejected_connections":           true,
+	"expired_keys":                   true,
+	"expired_time_cap_reached_count": true,
+	"evicted_keys":                   true,
+	"keyspace_hits":                  true,
+	"keyspace_misses":                true,
+	"sync_full":                      true,
+	"sync_partial_ok":                true,
+	"sync_partial_err":               true,
+	"unexpected_error_replies":       true,
+	"io_threaded_reads_processed":    true,
+	"io_threaded_writes_processed":   true,
+	"used_cpu_sys":                   true,
+	"used_cpu_user":                  true,
+	"used_cpu_sys_children":          true,
+	"used_cpu_user_children":         true,
+}
+
+// infoType returns the type of the INFO field name, the fields are gauges but the counters.
+func infoType(name string) types.ValueType {
+	if infoCounters[name] {
+		return types.Counter
+	}
+	return types.Gauge
+}
+
 // Parse the special Keyspace line at end of redis stats
 // This is a special line that looks something like:
 //
@@ -280,7 +330,7 @@ func gatherKeyspaceLine(
 		}
 
 		for k, v := range fields {
-			slist.PushFront(types.NewSample(inputName, "keyspace_"+k, v, tags))
+			slist.PushFront(types.NewSample(inputName, "keyspace_"+k, v, tags).SetType(types.Gauge))
 		}
 	}
 }
@@ -331,7 +381,11 @@ func gatherCommandstateLine(
 	}
 
 	for k, v := range fields {
-		slist.PushFront(types.NewSample(inputName, "cmdstat_"+k, v, tags))
+		typ := types.Counter
+		if k == "usec_per_call" {
+			typ = types.Gauge
+		}
+		slist.PushFront(types.NewSample(inputName, "cmdstat_"+k, v, tags).SetType(typ))
 	}
 }
 
@@ -379,6 +433,6 @@ func gatherReplicationLine(
 	}
 
 	for k, v := range fields {
-		slist.PushFront(types.NewSample(inputName, "replication_"+k, v, tags))
+		slist.PushFront(types.NewSample(inputName, "replication_"+k, v, tags).SetType(types.Gauge))
 	}
 }
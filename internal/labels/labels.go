@@ -1,5 +1,10 @@
 package labels
 
+const (
+	MonitorNamespace = "monitor_namespace"
+	MonitorName      = "monitor_name"
+)
+
 func Labels(labels map[string]string) map[string]string {
 	ret := make(map[string]string)
 	for k, v := range labels {
@@ -13,3 +18,11 @@ func GlobalLabels() map[string]string {
 		"source": "kubemonitor",
 	}
 }
+
+// MonitorLabels returns a copy of labels with the namespace and name of the monitor added
+func MonitorLabels(namespace, name string, labels map[string]string) map[string]string {
+	ret := Labels(labels)
+	ret[MonitorNamespace] = namespace
+	ret[MonitorName] = name
+	return ret
+}
@@ -0,0 +1,310 @@
+package shard
+
+import (
+	"context"
+	"hash/fnv"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	apierrors "k8s.io/apimachinery/pkg/api/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"sigs.k8s.io/controller-runtime/pkg/client"
+	"sigs.k8s.io/controller-runtime/pkg/event"
+
+	kubemonitoriov1 "github.com/noovertime7/kubemonitor/api/v1"
+)
+
+const (
+	// LeaseLabel marks the Leases of the shards
+	LeaseLabel = "kubemonitor.io/shard"
+	// Annotation pins a Monitor to the shard it names, bypassing the hashing
+	Annotation = "kubemonitor.io/shard"
+	// MembersAnnotation of a Lease lists the members its shard assigns the Monitors by, so that
+	// the other shards know the Monitors it stopped gathering
+	MembersAnnotation = "kubemonitor.io/shard-members"
+
+	leasePrefix = "kubemonitor-shard-"
+)
+
+// Options configures the shard of a replica.
+type Options struct {
+	// ID is the name of the shard, unique among the replicas, e.g. the pod name
+	ID string
+	// Namespace holds the Leases of the shards
+	Namespace string
+	// LeaseDuration is the time a shard stays a member without renewing its Lease
+	LeaseDuration time.Duration
+	// RenewInterval is the period the Lease is renewed and the members listed at
+	RenewInterval time.Duration
+}
+
+// Sharder keeps the Lease of a replica and assigns every Monitor to one of the live shards
+// by rendezvous hashing, so that a shard joining or leaving only moves its share of the Monitors.
+type Sharder struct {
+	client client.Client
+	reader client.Reader
+	opts   Options
+	logger logr.Logger
+
+	lock    sync.RWMutex
+	members []string
+	// views are the members every live shard assigns the Monitors by, as published in its Lease
+	views map[string][]string
+	// ready is false until the members were listed once, no Monitor is owned before
+	ready bool
+
+	events chan event.GenericEvent
+}
+
+// New returns the Sharder of the replica, reader lists the Leases uncached.
+func New(c client.Client, reader client.Reader, opts Options, logger logr.Logger) *Sharder {
+	if opts.LeaseDuration <= 0 {
+		opts.LeaseDuration = 15 * time.Second
+	}
+	if opts.RenewInterval <= 0 {
+		opts.RenewInterval = opts.LeaseDuration / 3
+	}
+	return &Sharder{
+		client: c,
+		reader: reader,
+		opts:   opts,
+		logger: logger.WithName("shard").WithValues("shard", opts.ID),
+		events: make(chan event.GenericEvent, 1024),
+	}
+}
+
+// ID returns the name of the shard.
+func (s *Sharder) ID() string {
+	return s.opts.ID
+}
+
+// Events emits the Monitors to reconcile again when the members changed.
+func (s *Sharder) Events() <-chan event.GenericEvent {
+	return s.events
+}
+
+// Owns reports whether obj is assigned to this shard.
+func (s *Sharder) Owns(obj client.Object) bool {
+	if shard, ok := obj.GetAnnotations()[Annotation]; ok && shard != "" {
+		return shard == s.opts.ID
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	if !s.ready {
+		return false
+	}
+	return Owner(s.members, client.ObjectKeyFromObject(obj).String()) == s.opts.ID
+}
+
+// Released reports whether the other live shards stopped gathering obj, which is owned by this
+// shard: none of them assigns obj to itself by the members published in its Lease. A Monitor
+// moved to this shard is started only once released, the previous owner stops it on its next sync.
+func (s *Sharder) Released(obj client.Object) bool {
+	if shard, ok := obj.GetAnnotations()[Annotation]; ok && shard != "" {
+		return true
+	}
+
+	s.lock.RLock()
+	defer s.lock.RUnlock()
+	key := client.ObjectKeyFromObject(obj).String()
+	for member, view := range s.views {
+		if member != s.opts.ID && Owner(view, key) == member {
+			return false
+		}
+	}
+	return true
+}
+
+// RenewInterval returns the period the members are listed at.
+func (s *Sharder) RenewInterval() time.Duration {
+	return s.opts.RenewInterval
+}
+
+// Owner returns the member with the highest hash of member and key.
+func Owner(members []string, key string) string {
+	var (
+		owner string
+		max   uint64
+	)
+	for _, member := range members {
+		h := fnv.New64a()
+		_, _ = h.Write([]byte(member))
+		_, _ = h.Write([]byte{'/'})
+		_, _ = h.Write([]byte(key))
+		if sum := h.Sum64(); owner == "" || sum > max {
+			owner, max = member, sum
+		}
+	}
+	return owner
+}
+
+// NeedLeaderElection is false, every replica runs its shard.
+func (s *Sharder) NeedLeaderElection() bool {
+	return false
+}
+
+// Start renews the Lease and follows the members until ctx is done, the Lease is deleted then
+// so that the other shards take the Monitors over without waiting for it to expire.
+func (s *Sharder) Start(ctx context.Context) error {
+	ticker := time.NewTicker(s.opts.RenewInterval)
+	defer ticker.Stop()
+
+	for {
+		if err := s.renew(ctx); err != nil {
+			s.logger.Error(err, "renew shard lease error")
+		}
+		if err := s.sync(ctx); err != nil {
+			s.logger.Error(err, "list shard leases error")
+		}
+
+		select {
+		case <-ctx.Done():
+			s.release()
+			return nil
+		case <-ticker.C:
+		}
+	}
+}
+
+func (s *Sharder) leaseName() string {
+	return leasePrefix + s.opts.ID
+}
+
+func (s *Sharder) renew(ctx context.Context) error {
+	now := metav1.NewMicroTime(time.Now())
+	seconds := int32(s.opts.LeaseDuration.Seconds())
+
+	s.lock.RLock()
+	members := strings.Join(s.members, ",")
+	s.lock.RUnlock()
+
+	lease := &coordinationv1.Lease{}
+	err := s.reader.Get(ctx, client.ObjectKey{Namespace: s.opts.Namespace, Name: s.leaseName()}, lease)
+	if apierrors.IsNotFound(err) {
+		lease = &coordinationv1.Lease{
+			ObjectMeta: metav1.ObjectMeta{
+				Name:        s.leaseName(),
+				Namespace:   s.opts.Namespace,
+				Labels:      map[string]string{LeaseLabel: "true"},
+				Annotations: map[string]string{MembersAnnotation: members},
+			},
+			Spec: coordinationv1.LeaseSpec{
+				HolderIdentity:       &s.opts.ID,
+				LeaseDurationSeconds: &seconds,
+				AcquireTime:          &now,
+				RenewTime:            &now,
+			},
+		}
+		return s.client.Create(ctx, lease)
+	}
+	if err != nil {
+		return err
+	}
+
+	if lease.Annotations == nil {
+		lease.Annotations = map[string]string{}
+	}
+	lease.Annotations[MembersAnnotation] = members
+	lease.Spec.HolderIdentity = &s.opts.ID
+	lease.Spec.LeaseDurationSeconds = &seconds
+	lease.Spec.RenewTime = &now
+	return s.client.Update(ctx, lease)
+}
+
+// sync lists the live shards and enqueues every Monitor when they changed.
+func (s *Sharder) sync(ctx context.Context) error {
+	leases := &coordinationv1.LeaseList{}
+	if err := s.reader.List(ctx, leases, client.InNamespace(s.opts.Namespace), client.MatchingLabels{LeaseLabel: "true"}); err != nil {
+		return err
+	}
+	members, views := liveMembers(leases.Items, time.Now())
+
+	s.lock.Lock()
+	changed := !s.ready || !equal(s.members, members)
+	s.members = members
+	s.views = views
+	s.ready = true
+	s.lock.Unlock()
+
+	if !changed {
+		return nil
+	}
+	s.logger.Info("shard members changed", "members", members)
+
+	monitors := &kubemonitoriov1.MonitorList{}
+	if err := s.client.List(ctx, monitors); err != nil {
+		return err
+	}
+	for i := range monitors.Items {
+		select {
+		case s.events <- event.GenericEvent{Object: &monitors.Items[i]}:
+		case <-ctx.Done():
+			return nil
+		}
+	}
+	return nil
+}
+
+func (s *Sharder) release() {
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+
+	lease := &coordinationv1.Lease{ObjectMeta: metav1.ObjectMeta{Namespace: s.opts.Namespace, Name: s.leaseName()}}
+	if err := s.client.Delete(ctx, lease); client.IgnoreNotFound(err) != nil {
+		s.logger.Error(err, "delete shard lease error")
+	}
+}
+
+// liveMembers returns the sorted holders of the Leases renewed within their duration and the members
+// each of them published, the holders publishing none assign by the live members.
+func liveMembers(leases []coordinationv1.Lease, now time.Time) ([]string, map[string][]string) {
+	var (
+		members []string
+		views   = map[string][]string{}
+	)
+	for _, lease := range leases {
+		spec := lease.Spec
+		if spec.HolderIdentity == nil || spec.RenewTime == nil || spec.LeaseDurationSeconds == nil {
+			continue
+		}
+		expiry := spec.RenewTime.Add(time.Duration(*spec.LeaseDurationSeconds) * time.Second)
+		if !now.Before(expiry) {
+			continue
+		}
+		members = append(members, *spec.HolderIdentity)
+		if view, ok := lease.Annotations[MembersAnnotation]; ok {
+			views[*spec.HolderIdentity] = splitMembers(view)
+		}
+	}
+	sort.Strings(members)
+	for _, member := range members {
+		if _, ok := views[member]; !ok {
+			views[member] = members
+		}
+	}
+	return members, views
+}
+
+func splitMembers(view string) []string {
+	if view == "" {
+		return nil
+	}
+	return strings.Split(view, ",")
+}
+
+func equal(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,124 @@
+package shard
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	coordinationv1 "k8s.io/api/coordination/v1"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+
+	kubemonitoriov1 "github.com/noovertime7/kubemonitor/api/v1"
+)
+
+func TestOwnerMovesOnlyTheLeavingShare(t *testing.T) {
+	members := []string{"kubemonitor-0", "kubemonitor-1", "kubemonitor-2"}
+
+	before := map[string]string{}
+	counts := map[string]int{}
+	for i := 0; i < 3000; i++ {
+		key := fmt.Sprintf("team-%d/mysql", i)
+		before[key] = Owner(members, key)
+		counts[before[key]]++
+	}
+	for _, member := range members {
+		if counts[member] < 800 {
+			t.Errorf("%s owns %d of 3000 monitors, want about a third", member, counts[member])
+		}
+	}
+
+	for key, owner := range before {
+		after := Owner(members[:2], key)
+		if owner != "kubemonitor-2" && after != owner {
+			t.Fatalf("%s moved from %s to %s when kubemonitor-2 left", key, owner, after)
+		}
+	}
+}
+
+func TestLiveMembers(t *testing.T) {
+	now := time.Now()
+	lease := func(holder string, renewed time.Time) coordinationv1.Lease {
+		seconds := int32(15)
+		renewTime := metav1.NewMicroTime(renewed)
+		return coordinationv1.Lease{Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &seconds,
+			RenewTime:            &renewTime,
+		}}
+	}
+
+	members, _ := liveMembers([]coordinationv1.Lease{
+		lease("kubemonitor-1", now.Add(-time.Second)),
+		lease("kubemonitor-0", now.Add(-5*time.Second)),
+		lease("kubemonitor-2", now.Add(-time.Minute)),
+	}, now)
+	if len(members) != 2 || members[0] != "kubemonitor-0" || members[1] != "kubemonitor-1" {
+		t.Errorf("liveMembers() = %v, want the two renewed leases", members)
+	}
+}
+
+func TestReleasedWaitsForThePreviousOwner(t *testing.T) {
+	now := time.Now()
+	lease := func(holder string, members *string) coordinationv1.Lease {
+		seconds := int32(15)
+		renewTime := metav1.NewMicroTime(now)
+		l := coordinationv1.Lease{Spec: coordinationv1.LeaseSpec{
+			HolderIdentity:       &holder,
+			LeaseDurationSeconds: &seconds,
+			RenewTime:            &renewTime,
+		}}
+		if members != nil {
+			l.Annotations = map[string]string{MembersAnnotation: *members}
+		}
+		return l
+	}
+	str := func(s string) *string { return &s }
+
+	// kubemonitor-1 joined, kubemonitor-0 still assigns every monitor to itself
+	members := []string{"kubemonitor-0", "kubemonitor-1"}
+	var monitor *kubemonitoriov1.Monitor
+	for i := 0; monitor == nil; i++ {
+		m := &kubemonitoriov1.Monitor{ObjectMeta: metav1.ObjectMeta{Namespace: fmt.Sprintf("team-%d", i), Name: "mysql"}}
+		if Owner(members, m.Namespace+"/"+m.Name) == "kubemonitor-1" {
+			monitor = m
+		}
+	}
+
+	tests := []struct {
+		name   string
+		leases []coordinationv1.Lease
+		want   bool
+	}{
+		{
+			name:   "previous owner not synced",
+			leases: []coordinationv1.Lease{lease("kubemonitor-0", str("kubemonitor-0")), lease("kubemonitor-1", str(""))},
+			want:   false,
+		},
+		{
+			name:   "previous owner synced",
+			leases: []coordinationv1.Lease{lease("kubemonitor-0", str("kubemonitor-0,kubemonitor-1")), lease("kubemonitor-1", str(""))},
+			want:   true,
+		},
+		{
+			name:   "previous owner gone",
+			leases: []coordinationv1.Lease{lease("kubemonitor-1", str(""))},
+			want:   true,
+		},
+		{
+			name:   "previous owner publishing no members",
+			leases: []coordinationv1.Lease{lease("kubemonitor-0", nil), lease("kubemonitor-1", str(""))},
+			want:   true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := New(nil, nil, Options{ID: "kubemonitor-1"}, logr.Discard())
+			s.members, s.views = liveMembers(tt.leases, now)
+			s.ready = true
+			if got := s.Released(monitor); got != tt.want {
+				t.Errorf("Released() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
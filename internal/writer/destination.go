@@ -0,0 +1,253 @@
+package writer
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// retainBackoff is the pause before a batch the writer did not accept is written again
+const retainBackoff = time.Second
+
+// destination is a registered writer with its own queue, senders and counters,
+// so that a slow or dead endpoint only backs up its own queue.
+type destination struct {
+	name   string
+	queue  Queue
+	logger logr.Logger
+
+	lock     sync.Mutex
+	writer   Writer
+	snapshot Snapshot
+	// retired are the replaced writers, closed by run once no send uses them
+	retired []Writer
+
+	cancel context.CancelFunc
+	done   chan struct{}
+}
+
+func newDestination(name string, w Writer, queue Queue, logger logr.Logger) *destination {
+	ctx, cancel := context.WithCancel(context.Background())
+	d := &destination{
+		name:   name,
+		queue:  queue,
+		logger: logger.WithValues("destination", name),
+		writer: w,
+		cancel: cancel,
+		done:   make(chan struct{}),
+	}
+	go d.run(ctx)
+	return d
+}
+
+// setWriter replaces the writer, the queued series are kept. The replaced writer may still be
+// sending, it is closed by run after the in-flight send.
+func (d *destination) setWriter(w Writer) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.snapshot.addDelivered(d.writer)
+	d.retired = append(d.retired, d.writer)
+	d.writer = w
+}
+
+// closeRetired closes the replaced writers, it is called when no send is in flight.
+func (d *destination) closeRetired() error {
+	d.lock.Lock()
+	retired := d.retired
+	d.retired = nil
+	d.lock.Unlock()
+
+	var errs []error
+	for _, w := range retired {
+		errs = append(errs, w.Close())
+	}
+	return errors.Join(errs...)
+}
+
+func (d *destination) currentWriter() Writer {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	return d.writer
+}
+
+func (d *destination) matches(source Source) bool {
+	return d.currentWriter().Opts.Matches(source)
+}
+
+func (d *destination) enqueue(items []*prompb.TimeSeries) bool {
+	success := d.queue.Push(items)
+
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	d.snapshot.QueueTotalCount += uint64(len(items))
+	d.snapshot.QueueSize = uint64(d.queue.Len())
+	if !success {
+		d.snapshot.QueueFailCount++
+		d.snapshot.QueueFailTotal += uint64(len(items))
+	}
+	return success
+}
+
+// run writes the queued series until the destination is stopped, a batch stays queued until
+// the writer accepts it so that series survive remote write outages and, with a WAL queue, restarts.
+func (d *destination) run(ctx context.Context) {
+	defer close(d.done)
+
+	for {
+		if err := d.closeRetired(); err != nil {
+			d.logger.Error(err, "close replaced writer error")
+		}
+		w := d.currentWriter()
+		batch, concurrency := w.Opts.Batch, w.Opts.Concurrency
+
+		series, err := d.queue.Peek(batch * concurrency)
+		if err != nil {
+			d.logger.Error(err, "read writer queue error")
+			if !sleep(ctx, retainBackoff) {
+				return
+			}
+			continue
+		}
+		if len(series) == 0 {
+			if !sleep(ctx, time.Millisecond*400) {
+				return
+			}
+			continue
+		}
+
+		// only the batches not accepted yet are sent again, the endpoint would get the others twice
+		batches := splitBatches(series, batch)
+		done := make([]bool, len(batches))
+		for !d.send(ctx, w, batches, done) {
+			if !sleep(ctx, retainBackoff) {
+				d.commit(sentPrefix(batches, done))
+				return
+			}
+			if err := d.closeRetired(); err != nil {
+				d.logger.Error(err, "close replaced writer error")
+			}
+			w = d.currentWriter()
+		}
+		d.commit(len(series))
+	}
+}
+
+func (d *destination) commit(n int) {
+	if n == 0 {
+		return
+	}
+	if err := d.queue.Commit(n); err != nil {
+		d.logger.Error(err, "commit writer queue error")
+	}
+}
+
+// splitBatches splits series in batches of up to batch series.
+func splitBatches(series []*prompb.TimeSeries, batch int) [][]prompb.TimeSeries {
+	batches := make([][]prompb.TimeSeries, 0, (len(series)+batch-1)/batch)
+	for start := 0; start < len(series); start += batch {
+		end := start + batch
+		if end > len(series) {
+			end = len(series)
+		}
+
+		items := make([]prompb.TimeSeries, end-start)
+		for i := range items {
+			items[i] = *series[start+i]
+		}
+		batches = append(batches, items)
+	}
+	return batches
+}
+
+// sentPrefix returns the number of series of the batches done from the front, they can be
+// committed while the next ones are not.
+func sentPrefix(batches [][]prompb.TimeSeries, done []bool) int {
+	n := 0
+	for i, items := range batches {
+		if !done[i] {
+			break
+		}
+		n += len(items)
+	}
+	return n
+}
+
+// send writes the batches not done in parallel and marks done those accepted or rejected for
+// good, it reports whether every batch is done.
+func (d *destination) send(ctx context.Context, w Writer, batches [][]prompb.TimeSeries, done []bool) bool {
+	var (
+		wg     sync.WaitGroup
+		lock   sync.Mutex
+		failed bool
+	)
+	for i, items := range batches {
+		if done[i] {
+			continue
+		}
+
+		wg.Add(1)
+		go func(i int, items []prompb.TimeSeries) {
+			defer wg.Done()
+			retries, err := w.Write(ctx, items)
+			retry := err != nil && isRecoverable(err) || ctx.Err() != nil
+			d.record(len(items), retries, err, !retry)
+
+			lock.Lock()
+			defer lock.Unlock()
+			if retry {
+				failed = true
+				return
+			}
+			done[i] = true
+		}(i, items)
+	}
+	wg.Wait()
+	return !failed
+}
+
+// record counts a push of count series, they are counted written once done so that the
+// retries of a batch do not count it again.
+func (d *destination) record(count, retries int, err error, done bool) {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+
+	if done {
+		d.snapshot.WriteTotalCount += uint64(count)
+	}
+	d.snapshot.WriteRetryTotal += uint64(retries)
+	d.snapshot.QueueSize = uint64(d.queue.Len())
+	if err != nil {
+		d.snapshot.WriteFailCount++
+		d.snapshot.WriteFailTotal += uint64(count)
+	}
+}
+
+// metrics returns the counters of the destination, including the deliveries of its current writer.
+func (d *destination) metrics() Snapshot {
+	d.lock.Lock()
+	defer d.lock.Unlock()
+	snapshot := d.snapshot
+	snapshot.addDelivered(d.writer)
+	return snapshot
+}
+
+// stop cancels the in-flight pushes, waits for the senders and closes the writers and the queue.
+func (d *destination) stop() error {
+	d.cancel()
+	<-d.done
+	return errors.Join(d.closeRetired(), d.currentWriter().Close(), d.queue.Close())
+}
+
+// sleep waits for duration, it returns false when ctx is done first.
+func sleep(ctx context.Context, duration time.Duration) bool {
+	select {
+	case <-time.After(duration):
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
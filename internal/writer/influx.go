@@ -0,0 +1,180 @@
+package writer
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/prometheus/client_golang/api"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+)
+
+// InfluxOption configures the writers of TypeInflux.
+type InfluxOption struct {
+	// Database and RetentionPolicy select where InfluxDB 1.x writes
+	Database        string `toml:"database"`
+	RetentionPolicy string `toml:"retention_policy"`
+	// Bucket and Org select where InfluxDB 2.x writes, Bucket set selects the 2.x API
+	Bucket string `toml:"bucket"`
+	Org    string `toml:"org"`
+	Token  string `toml:"token"`
+	// Measurement is the measurement of every point and the metric names its fields,
+	// when empty the metric name is the measurement and the field is "value"
+	Measurement string `toml:"measurement"`
+	Gzip        bool   `toml:"gzip"`
+}
+
+const influxValueField = "value"
+
+// influxClient sends the series as InfluxDB line protocol with millisecond timestamps.
+type influxClient struct {
+	opts     WriterOption
+	client   api.Client
+	endpoint string
+}
+
+func newInfluxClient(opt WriterOption, cli api.Client) (*influxClient, error) {
+	endpoint, err := url.Parse(opt.Url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %s: %w", opt.Url, err)
+	}
+
+	influx := opt.Influx
+	if endpoint.Path == "" || endpoint.Path == "/" {
+		endpoint.Path = "/write"
+		if influx.Bucket != "" {
+			endpoint.Path = "/api/v2/write"
+		}
+	}
+
+	query := endpoint.Query()
+	if influx.Bucket != "" {
+		query.Set("bucket", influx.Bucket)
+		if influx.Org != "" {
+			query.Set("org", influx.Org)
+		}
+	} else {
+		if influx.Database != "" {
+			query.Set("db", influx.Database)
+		}
+		if influx.RetentionPolicy != "" {
+			query.Set("rp", influx.RetentionPolicy)
+		}
+	}
+	query.Set("precision", "ms")
+	endpoint.RawQuery = query.Encode()
+
+	return &influxClient{opts: opt, client: cli, endpoint: endpoint.String()}, nil
+}
+
+// send drops the metadata, line protocol has no room for it.
+func (c *influxClient) send(ctx context.Context, items []prompb.TimeSeries, _ []prompb.MetricMetadata) error {
+	body, err := compress(encodeLineProtocol(items, c.opts.Influx.Measurement), c.opts.Influx.Gzip)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		logrus.Error("W! create influx write request got error:", err)
+		return err
+	}
+
+	httpReq.Header.Set("Content-Type", "text/plain; charset=utf-8")
+	httpReq.Header.Set("User-Agent", "categraf")
+	if c.opts.Influx.Gzip {
+		httpReq.Header.Set("Content-Encoding", "gzip")
+	}
+	c.opts.setHeaders(httpReq)
+	if c.opts.Influx.Token != "" {
+		httpReq.Header.Set("Authorization", "Token "+c.opts.Influx.Token)
+	}
+
+	return do(ctx, c.client, httpReq, "influx write")
+}
+
+// encodeLineProtocol converts items to one line per sample, the samples InfluxDB cannot store
+// (NaN and infinite values, series without a name) are dropped.
+func encodeLineProtocol(items []prompb.TimeSeries, measurement string) []byte {
+	var (
+		b    bytes.Buffer
+		tags []prompb.Label
+	)
+	for _, ts := range items {
+		name := ""
+		tags = tags[:0]
+		for _, l := range ts.Labels {
+			if l.Name == model.MetricNameLabel {
+				name = l.Value
+				continue
+			}
+			// InfluxDB rejects the empty tags, they are absent labels to Prometheus too
+			if l.Value != "" {
+				tags = append(tags, l)
+			}
+		}
+		if name == "" {
+			continue
+		}
+		sort.Slice(tags, func(i, j int) bool {
+			return tags[i].Name < tags[j].Name
+		})
+
+		pointMeasurement, field := name, influxValueField
+		if measurement != "" {
+			pointMeasurement, field = measurement, name
+		}
+
+		for _, sample := range ts.Samples {
+			if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+				continue
+			}
+			b.WriteString(measurementEscaper.Replace(pointMeasurement))
+			for _, tag := range tags {
+				b.WriteByte(',')
+				b.WriteString(keyEscaper.Replace(tag.Name))
+				b.WriteByte('=')
+				b.WriteString(keyEscaper.Replace(tag.Value))
+			}
+			b.WriteByte(' ')
+			b.WriteString(keyEscaper.Replace(field))
+			b.WriteByte('=')
+			b.WriteString(strconv.FormatFloat(sample.Value, 'g', -1, 64))
+			b.WriteByte(' ')
+			b.WriteString(strconv.FormatInt(sample.Timestamp, 10))
+			b.WriteByte('\n')
+		}
+	}
+	return b.Bytes()
+}
+
+// compress returns data gzipped when enabled.
+func compress(data []byte, enabled bool) ([]byte, error) {
+	if !enabled {
+		return data, nil
+	}
+	var b bytes.Buffer
+	gz := gzip.NewWriter(&b)
+	if _, err := gz.Write(data); err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, err
+	}
+	return b.Bytes(), nil
+}
+
+var (
+	// line protocol has no escape for newlines, they are replaced by spaces
+	measurementEscaper = strings.NewReplacer(`\`, `\\`, ",", `\,`, " ", `\ `, "\n", `\ `)
+	keyEscaper         = strings.NewReplacer(`\`, `\\`, ",", `\,`, "=", `\=`, " ", `\ `, "\n", `\ `)
+)
@@ -0,0 +1,103 @@
+package writer
+
+import (
+	"compress/gzip"
+	"context"
+	"io"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+func TestEncodeLineProtocol(t *testing.T) {
+	items := []prompb.TimeSeries{
+		{
+			Labels: []prompb.Label{
+				{Name: "__name__", Value: "mysql_up"},
+				{Name: "instance", Value: "db 1,a=b"},
+				{Name: "empty", Value: ""},
+				{Name: "cluster", Value: "prod"},
+			},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}, {Value: math.NaN(), Timestamp: 2000}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "instance", Value: "nameless"}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}},
+		},
+	}
+
+	tests := []struct {
+		name        string
+		measurement string
+		want        string
+	}{
+		{
+			name: "metric name as measurement",
+			want: "mysql_up,cluster=prod,instance=db\\ 1\\,a\\=b value=1 1000\n",
+		},
+		{
+			name:        "metric name as field",
+			measurement: "kubemonitor",
+			want:        "kubemonitor,cluster=prod,instance=db\\ 1\\,a\\=b mysql_up=1 1000\n",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := string(encodeLineProtocol(items, tt.measurement)); got != tt.want {
+				t.Errorf("encodeLineProtocol() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestInfluxWriter(t *testing.T) {
+	var (
+		path, query, auth string
+		body              []byte
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, query, auth = r.URL.Path, r.URL.RawQuery, r.Header.Get("Authorization")
+		reader := io.Reader(r.Body)
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			gz, err := gzip.NewReader(r.Body)
+			if err != nil {
+				t.Error(err)
+				return
+			}
+			reader = gz
+		}
+		body, _ = io.ReadAll(reader)
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer server.Close()
+
+	w, err := newWriter(WriterOption{
+		Type:   TypeInflux,
+		Url:    server.URL,
+		Influx: InfluxOption{Bucket: "metrics", Org: "team-a", Token: "secret", Gzip: true},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	series := []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}},
+	}}
+	if _, err := w.Write(context.Background(), series); err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/api/v2/write" || query != "bucket=metrics&org=team-a&precision=ms" {
+		t.Errorf("pushed to %s?%s", path, query)
+	}
+	if auth != "Token secret" {
+		t.Errorf("Authorization = %q", auth)
+	}
+	if string(body) != "up value=1 1000\n" {
+		t.Errorf("body = %q", body)
+	}
+}
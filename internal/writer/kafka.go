@@ -0,0 +1,321 @@
+package writer
+
+import (
+	"context"
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"sync/atomic"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/segmentio/kafka-go"
+	"github.com/segmentio/kafka-go/sasl"
+	"github.com/segmentio/kafka-go/sasl/plain"
+	"github.com/segmentio/kafka-go/sasl/scram"
+	"github.com/sirupsen/logrus"
+)
+
+// KafkaOption configures the writers of TypeKafka.
+type KafkaOption struct {
+	Brokers []string `toml:"brokers"`
+	Topic   string   `toml:"topic"`
+	// PartitionKey is KafkaKeyMetric or KafkaKeyLabel, the messages are keyed by the metric name
+	// or by the value of PartitionLabel
+	PartitionKey   string `toml:"partition_key"`
+	PartitionLabel string `toml:"partition_label"`
+	// Format is KafkaFormatJSON or KafkaFormatProtobuf
+	Format      string `toml:"format"`
+	Compression string `toml:"compression"`
+	// TLS connects with TLS even when no TLS option of the writer is set
+	TLS           bool   `toml:"tls"`
+	SASLMechanism string `toml:"sasl_mechanism"`
+	SASLUsername  string `toml:"sasl_username"`
+	SASLPassword  string `toml:"sasl_password"`
+}
+
+const (
+	KafkaKeyMetric = "metric"
+	KafkaKeyLabel  = "label"
+
+	// KafkaFormatJSON produces a kafkaSample per sample
+	KafkaFormatJSON = "json"
+	// KafkaFormatProtobuf produces a prompb.TimeSeries per series
+	KafkaFormatProtobuf = "protobuf"
+)
+
+// kafkaSample is the JSON payload of a sample.
+type kafkaSample struct {
+	Name      string            `json:"name"`
+	Labels    map[string]string `json:"labels"`
+	Value     float64           `json:"value"`
+	Timestamp int64             `json:"timestamp"`
+}
+
+// kafkaProducer is the part of kafka.Writer used by kafkaClient.
+type kafkaProducer interface {
+	WriteMessages(ctx context.Context, msgs ...kafka.Message) error
+	Close() error
+}
+
+// kafkaClient produces the series to a topic, a batch is sent once acknowledged by all the in-sync replicas.
+type kafkaClient struct {
+	opts   KafkaOption
+	writer kafkaProducer
+
+	messages atomic.Uint64
+	bytes    atomic.Uint64
+}
+
+func newKafkaClient(opt WriterOption) (*kafkaClient, error) {
+	kopt := opt.Kafka
+	if len(kopt.Brokers) == 0 {
+		return nil, fmt.Errorf("kafka brokers is empty")
+	}
+	if kopt.Topic == "" {
+		return nil, fmt.Errorf("kafka topic is empty")
+	}
+	switch kopt.Format {
+	case "":
+		kopt.Format = KafkaFormatJSON
+	case KafkaFormatJSON, KafkaFormatProtobuf:
+	default:
+		return nil, fmt.Errorf("unknown kafka format %q", kopt.Format)
+	}
+	if kopt.PartitionKey == KafkaKeyLabel && kopt.PartitionLabel == "" {
+		return nil, fmt.Errorf("kafka partition_label is empty")
+	}
+
+	compression, err := kafkaCompression(kopt.Compression)
+	if err != nil {
+		return nil, err
+	}
+	mechanism, err := kafkaSASL(kopt)
+	if err != nil {
+		return nil, err
+	}
+	tlsConfig, err := opt.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+	if tlsConfig == nil && kopt.TLS {
+		tlsConfig = &tls.Config{}
+	}
+
+	return &kafkaClient{
+		opts: kopt,
+		writer: &kafka.Writer{
+			Addr:         kafka.TCP(kopt.Brokers...),
+			Topic:        kopt.Topic,
+			Balancer:     &kafka.Hash{},
+			BatchSize:    opt.Batch,
+			BatchTimeout: 10 * time.Millisecond,
+			WriteTimeout: time.Duration(opt.Timeout) * time.Second,
+			RequiredAcks: kafka.RequireAll,
+			// the failed batches are retried by Writer.Write
+			MaxAttempts: 1,
+			Compression: compression,
+			Transport: &kafka.Transport{
+				DialTimeout: time.Duration(opt.DialTimeout) * time.Second,
+				ClientID:    "kubemonitor",
+				TLS:         tlsConfig,
+				SASL:        mechanism,
+			},
+		},
+	}, nil
+}
+
+func kafkaCompression(name string) (kafka.Compression, error) {
+	switch name {
+	case "", "none":
+		return 0, nil
+	case "gzip":
+		return kafka.Gzip, nil
+	case "snappy":
+		return kafka.Snappy, nil
+	case "lz4":
+		return kafka.Lz4, nil
+	case "zstd":
+		return kafka.Zstd, nil
+	default:
+		return 0, fmt.Errorf("unknown kafka compression %q", name)
+	}
+}
+
+func kafkaSASL(opt KafkaOption) (sasl.Mechanism, error) {
+	switch opt.SASLMechanism {
+	case "":
+		return nil, nil
+	case "plain":
+		return plain.Mechanism{Username: opt.SASLUsername, Password: opt.SASLPassword}, nil
+	case "scram-sha-256":
+		return scram.Mechanism(scram.SHA256, opt.SASLUsername, opt.SASLPassword)
+	case "scram-sha-512":
+		return scram.Mechanism(scram.SHA512, opt.SASLUsername, opt.SASLPassword)
+	default:
+		return nil, fmt.Errorf("unknown kafka sasl mechanism %q", opt.SASLMechanism)
+	}
+}
+
+// send drops the metadata, the consumers get the series only. When some of the messages
+// failed, only their samples are retried.
+func (c *kafkaClient) send(ctx context.Context, items []prompb.TimeSeries, _ []prompb.MetricMetadata) error {
+	messages, origins, err := c.messagesOf(items)
+	if err != nil {
+		logrus.Error("W! marshal kafka messages got error:", err)
+		return err
+	}
+	if len(messages) == 0 {
+		return nil
+	}
+
+	err = c.writer.WriteMessages(ctx, messages...)
+	if err == nil {
+		c.countDelivered(messages)
+		return nil
+	}
+	if ctx.Err() != nil {
+		return ctx.Err()
+	}
+
+	var failed []int
+	var writeErrors kafka.WriteErrors
+	if errors.As(err, &writeErrors) && len(writeErrors) == len(messages) {
+		delivered := make([]kafka.Message, 0, len(messages))
+		for i, e := range writeErrors {
+			if e != nil {
+				failed = append(failed, i)
+			} else {
+				delivered = append(delivered, messages[i])
+			}
+		}
+		c.countDelivered(delivered)
+	}
+
+	err = fmt.Errorf("produce to kafka topic %s got error: %w", c.opts.Topic, err)
+	if !isKafkaRecoverable(err) {
+		return err
+	}
+	if failed == nil {
+		return &recoverableError{err: err}
+	}
+	return &recoverableError{err: err, retry: retryItems(items, origins, failed)}
+}
+
+// countDelivered counts the messages acknowledged by the brokers.
+func (c *kafkaClient) countDelivered(messages []kafka.Message) {
+	var size int
+	for _, m := range messages {
+		size += len(m.Key) + len(m.Value)
+	}
+	c.messages.Add(uint64(len(messages)))
+	c.bytes.Add(uint64(size))
+}
+
+// kafkaOrigin is the series and the sample a message was produced from, sample is -1 when the
+// message is the whole series.
+type kafkaOrigin struct {
+	series int
+	sample int
+}
+
+// retryItems returns the series of the failed messages, with only their failed samples.
+func retryItems(items []prompb.TimeSeries, origins []kafkaOrigin, failed []int) []prompb.TimeSeries {
+	var (
+		retry []prompb.TimeSeries
+		index = map[int]int{}
+	)
+	for _, i := range failed {
+		origin := origins[i]
+		if origin.sample < 0 {
+			retry = append(retry, items[origin.series])
+			continue
+		}
+		j, ok := index[origin.series]
+		if !ok {
+			j = len(retry)
+			index[origin.series] = j
+			retry = append(retry, prompb.TimeSeries{Labels: items[origin.series].Labels})
+		}
+		retry[j].Samples = append(retry[j].Samples, items[origin.series].Samples[origin.sample])
+	}
+	return retry
+}
+
+// messagesOf converts items to messages in the configured format, along with the origin of every message.
+func (c *kafkaClient) messagesOf(items []prompb.TimeSeries) ([]kafka.Message, []kafkaOrigin, error) {
+	var (
+		messages = make([]kafka.Message, 0, len(items))
+		origins  = make([]kafkaOrigin, 0, len(items))
+	)
+	for i := range items {
+		ts := &items[i]
+		name, labels := "", make(map[string]string, len(ts.Labels))
+		for _, l := range ts.Labels {
+			if l.Name == model.MetricNameLabel {
+				name = l.Value
+				continue
+			}
+			labels[l.Name] = l.Value
+		}
+		key := []byte(name)
+		if c.opts.PartitionKey == KafkaKeyLabel {
+			key = []byte(labels[c.opts.PartitionLabel])
+		}
+
+		if c.opts.Format == KafkaFormatProtobuf {
+			value, err := proto.Marshal(ts)
+			if err != nil {
+				return nil, nil, err
+			}
+			messages = append(messages, kafka.Message{Key: key, Value: value})
+			origins = append(origins, kafkaOrigin{series: i, sample: -1})
+			continue
+		}
+
+		for j, sample := range ts.Samples {
+			// JSON has no NaN nor infinite numbers
+			if math.IsNaN(sample.Value) || math.IsInf(sample.Value, 0) {
+				continue
+			}
+			value, err := json.Marshal(kafkaSample{Name: name, Labels: labels, Value: sample.Value, Timestamp: sample.Timestamp})
+			if err != nil {
+				return nil, nil, err
+			}
+			messages = append(messages, kafka.Message{Key: key, Value: value})
+			origins = append(origins, kafkaOrigin{series: i, sample: j})
+		}
+	}
+	return messages, origins, nil
+}
+
+// isKafkaRecoverable reports whether err is worth retrying, only the kafka errors known
+// to be permanent, e.g. a message too large or an unknown topic, are not.
+func isKafkaRecoverable(err error) bool {
+	var writeErrors kafka.WriteErrors
+	if errors.As(err, &writeErrors) {
+		for _, e := range writeErrors {
+			if e != nil && isKafkaRecoverable(e) {
+				return true
+			}
+		}
+		return false
+	}
+	var kafkaErr kafka.Error
+	if errors.As(err, &kafkaErr) {
+		return kafkaErr.Temporary()
+	}
+	return true
+}
+
+func (c *kafkaClient) delivered() (messages, bytes uint64) {
+	return c.messages.Load(), c.bytes.Load()
+}
+
+func (c *kafkaClient) Close() error {
+	return c.writer.Close()
+}
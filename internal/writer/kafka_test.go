@@ -0,0 +1,180 @@
+package writer
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"math"
+	"testing"
+	"time"
+
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/segmentio/kafka-go"
+)
+
+func TestKafkaMessages(t *testing.T) {
+	series := []prompb.TimeSeries{{
+		Labels: []prompb.Label{
+			{Name: "__name__", Value: "mysql_up"},
+			{Name: "instance", Value: "db:3306"},
+		},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}, {Value: math.NaN(), Timestamp: 2000}},
+	}}
+
+	t.Run("json keyed by metric", func(t *testing.T) {
+		c, err := newKafkaClient(WriterOption{Type: TypeKafka, Kafka: KafkaOption{Brokers: []string{"kafka:9092"}, Topic: "metrics"}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		messages, _, err := c.messagesOf(series)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(messages) != 1 {
+			t.Fatalf("got %d messages, want one per sample that is a number", len(messages))
+		}
+		if string(messages[0].Key) != "mysql_up" {
+			t.Errorf("key = %q", messages[0].Key)
+		}
+		var sample kafkaSample
+		if err := json.Unmarshal(messages[0].Value, &sample); err != nil {
+			t.Fatal(err)
+		}
+		if sample.Name != "mysql_up" || sample.Labels["instance"] != "db:3306" || sample.Value != 1 || sample.Timestamp != 1000 {
+			t.Errorf("sample = %+v", sample)
+		}
+	})
+
+	t.Run("protobuf keyed by label", func(t *testing.T) {
+		c, err := newKafkaClient(WriterOption{Type: TypeKafka, Kafka: KafkaOption{
+			Brokers:        []string{"kafka:9092"},
+			Topic:          "metrics",
+			Format:         KafkaFormatProtobuf,
+			PartitionKey:   KafkaKeyLabel,
+			PartitionLabel: "instance",
+		}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer c.Close()
+
+		messages, _, err := c.messagesOf(series)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if len(messages) != 1 || string(messages[0].Key) != "db:3306" {
+			t.Fatalf("messages = %v, want one keyed by the instance", messages)
+		}
+		var ts prompb.TimeSeries
+		if err := proto.Unmarshal(messages[0].Value, &ts); err != nil {
+			t.Fatal(err)
+		}
+		if len(ts.Samples) != 2 || len(ts.Labels) != 2 {
+			t.Errorf("series = %v", ts.String())
+		}
+	})
+}
+
+func TestKafkaOptionValidation(t *testing.T) {
+	tests := []struct {
+		name string
+		opt  KafkaOption
+	}{
+		{name: "no brokers", opt: KafkaOption{Topic: "metrics"}},
+		{name: "no topic", opt: KafkaOption{Brokers: []string{"kafka:9092"}}},
+		{name: "label key without label", opt: KafkaOption{Brokers: []string{"kafka:9092"}, Topic: "metrics", PartitionKey: KafkaKeyLabel}},
+		{name: "unknown format", opt: KafkaOption{Brokers: []string{"kafka:9092"}, Topic: "metrics", Format: "avro"}},
+		{name: "unknown sasl", opt: KafkaOption{Brokers: []string{"kafka:9092"}, Topic: "metrics", SASLMechanism: "gssapi"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := newWriter(WriterOption{Type: TypeKafka, Kafka: tt.opt}); err == nil {
+				t.Error("newWriter() succeeded, want an error")
+			}
+		})
+	}
+}
+
+func TestIsKafkaRecoverable(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want bool
+	}{
+		{name: "network error", err: errors.New("connection refused"), want: true},
+		{name: "temporary kafka error", err: kafka.NotLeaderForPartition, want: true},
+		{name: "permanent kafka error", err: kafka.MessageSizeTooLarge, want: false},
+		{name: "write errors with a temporary one", err: kafka.WriteErrors{kafka.MessageSizeTooLarge, kafka.LeaderNotAvailable}, want: true},
+		{name: "write errors all permanent", err: kafka.WriteErrors{kafka.MessageSizeTooLarge, nil}, want: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isKafkaRecoverable(tt.err); got != tt.want {
+				t.Errorf("isKafkaRecoverable() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+// failingProducer fails the messages of fail in its first write.
+type failingProducer struct {
+	fail   map[int]error
+	writes [][]kafka.Message
+}
+
+func (p *failingProducer) WriteMessages(_ context.Context, msgs ...kafka.Message) error {
+	p.writes = append(p.writes, msgs)
+	if len(p.writes) > 1 {
+		return nil
+	}
+	errs := make(kafka.WriteErrors, len(msgs))
+	for i, err := range p.fail {
+		errs[i] = err
+	}
+	return errs
+}
+
+func (p *failingProducer) Close() error {
+	return nil
+}
+
+func TestKafkaRetriesFailedMessages(t *testing.T) {
+	w, err := newWriter(WriterOption{Type: TypeKafka, MinBackoff: time.Millisecond, Kafka: KafkaOption{Brokers: []string{"kafka:9092"}, Topic: "metrics"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	producer := &failingProducer{fail: map[int]error{1: kafka.LeaderNotAvailable}}
+	w.client.(*kafkaClient).writer = producer
+
+	series := []prompb.TimeSeries{
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "mysql_up"}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}, {Value: 1, Timestamp: 2000}},
+		},
+		{
+			Labels:  []prompb.Label{{Name: "__name__", Value: "redis_up"}},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}},
+		},
+	}
+	retries, err := w.Write(context.Background(), series)
+	if err != nil || retries != 1 {
+		t.Fatalf("Write() = %d, %v, want a single retry", retries, err)
+	}
+
+	if len(producer.writes) != 2 || len(producer.writes[1]) != 1 {
+		t.Fatalf("writes = %v, want the failed message retried alone", producer.writes)
+	}
+	var sample kafkaSample
+	if err := json.Unmarshal(producer.writes[1][0].Value, &sample); err != nil {
+		t.Fatal(err)
+	}
+	if sample.Name != "mysql_up" || sample.Timestamp != 2000 {
+		t.Errorf("retried %+v, want the second mysql_up sample", sample)
+	}
+	if messages, _ := w.delivered(); messages != 3 {
+		t.Errorf("delivered %d messages, want 3", messages)
+	}
+}
@@ -0,0 +1,100 @@
+package writer
+
+import (
+	"strings"
+	"sync"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+
+	types2 "github.com/noovertime7/kubemonitor/pkg/types"
+)
+
+// metadataStore keeps the last metadata written of every metric, the writers send it along
+// with the series of the metric.
+type metadataStore struct {
+	lock     sync.RWMutex
+	families map[string]prompb.MetricMetadata
+}
+
+func newMetadataStore() *metadataStore {
+	return &metadataStore{families: map[string]prompb.MetricMetadata{}}
+}
+
+// update records the metadata of samples.
+func (m *metadataStore) update(samples []*types2.Sample) {
+	var changed []prompb.MetricMetadata
+	m.lock.RLock()
+	for _, sample := range samples {
+		metadata := sample.ConvertMetadata()
+		if metadata == nil {
+			continue
+		}
+		if known, ok := m.families[metadata.MetricFamilyName]; !ok || !sameMetadata(known, *metadata) {
+			changed = append(changed, *metadata)
+		}
+	}
+	m.lock.RUnlock()
+	if len(changed) == 0 {
+		return
+	}
+
+	m.lock.Lock()
+	defer m.lock.Unlock()
+	for _, metadata := range changed {
+		m.families[metadata.MetricFamilyName] = metadata
+	}
+}
+
+func sameMetadata(a, b prompb.MetricMetadata) bool {
+	return a.Type == b.Type && a.MetricFamilyName == b.MetricFamilyName && a.Help == b.Help && a.Unit == b.Unit
+}
+
+// lookup returns the metadata of the metrics of items, once per metric.
+func (m *metadataStore) lookup(items []prompb.TimeSeries) []prompb.MetricMetadata {
+	if m == nil {
+		return nil
+	}
+
+	m.lock.RLock()
+	defer m.lock.RUnlock()
+	if len(m.families) == 0 {
+		return nil
+	}
+
+	var (
+		metadata []prompb.MetricMetadata
+		seen     = map[string]bool{}
+	)
+	for _, ts := range items {
+		for _, l := range ts.Labels {
+			if l.Name != model.MetricNameLabel {
+				continue
+			}
+			if family, ok := m.family(l.Value); ok && !seen[family.MetricFamilyName] {
+				seen[family.MetricFamilyName] = true
+				metadata = append(metadata, family)
+			}
+			break
+		}
+	}
+	return metadata
+}
+
+// family returns the metadata of the metric name, the _bucket, _sum and _count series of
+// the histograms and summaries are of the metric without the suffix.
+func (m *metadataStore) family(name string) (prompb.MetricMetadata, bool) {
+	if family, ok := m.families[name]; ok {
+		return family, true
+	}
+	for _, suffix := range []string{"_bucket", "_sum", "_count"} {
+		if !strings.HasSuffix(name, suffix) {
+			continue
+		}
+		family, ok := m.families[strings.TrimSuffix(name, suffix)]
+		if ok && (family.Type == prompb.MetricMetadata_HISTOGRAM || family.Type == prompb.MetricMetadata_SUMMARY) {
+			return family, true
+		}
+	}
+	return prompb.MetricMetadata{}, false
+}
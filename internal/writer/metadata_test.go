@@ -0,0 +1,78 @@
+package writer
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+
+	types2 "github.com/noovertime7/kubemonitor/pkg/types"
+)
+
+func TestWritersSendMetadata(t *testing.T) {
+	requests := make(chan prompb.WriteRequest, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		data, err := snappy.Decode(nil, body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var req prompb.WriteRequest
+		if err := proto.Unmarshal(data, &req); err != nil {
+			t.Error(err)
+			return
+		}
+		requests <- req
+	}))
+	defer server.Close()
+
+	ws := NewWriter(100, 10, logr.Discard())
+	defer ws.Close()
+	if err := ws.Register("default/remote", WriterOption{Url: server.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now()
+	ws.WriteSamples(Source{}, []*types2.Sample{
+		types2.NewSample("mysql", "queries_total", 42).SetType(types2.Counter).SetHelp("Queries.").SetTime(now),
+		types2.NewSample("mysql", "queries_total", 43, map[string]string{"instance": "b"}).SetType(types2.Counter).SetHelp("Queries.").SetTime(now),
+		types2.NewSample("mysql", "up", 1).SetTime(now),
+	})
+
+	select {
+	case req := <-requests:
+		if len(req.Metadata) != 1 {
+			t.Fatalf("metadata = %v, want one per typed metric", req.Metadata)
+		}
+		metadata := req.Metadata[0]
+		if metadata.MetricFamilyName != "mysql_queries_total" || metadata.Type != prompb.MetricMetadata_COUNTER || metadata.Help != "Queries." {
+			t.Errorf("metadata = %+v", metadata)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("nothing was written")
+	}
+}
+
+func TestMetadataOfDistributions(t *testing.T) {
+	m := newMetadataStore()
+	m.update([]*types2.Sample{
+		types2.NewSample("app", "rpc_duration_seconds", &types2.SummaryValue{Count: 1}).SetType(types2.Summary),
+		types2.NewSample("mysql", "queries", 1).SetType(types2.Counter),
+	})
+
+	var items []prompb.TimeSeries
+	for _, name := range []string{"app_rpc_duration_seconds", "app_rpc_duration_seconds_sum", "mysql_queries_count"} {
+		items = append(items, prompb.TimeSeries{Labels: []prompb.Label{{Name: "__name__", Value: name}}})
+	}
+	metadata := m.lookup(items)
+	if len(metadata) != 1 || metadata[0].Type != prompb.MetricMetadata_SUMMARY {
+		t.Errorf("lookup() = %v, want the summary once and no counter of another suffix", metadata)
+	}
+}
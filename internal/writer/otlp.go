@@ -0,0 +1,258 @@
+package writer
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/prometheus/client_golang/api"
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/prompb"
+	"github.com/sirupsen/logrus"
+	commonv1 "go.opentelemetry.io/proto/otlp/common/v1"
+	metricsv1 "go.opentelemetry.io/proto/otlp/metrics/v1"
+	resourcev1 "go.opentelemetry.io/proto/otlp/resource/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/noovertime7/kubemonitor/internal/labels"
+)
+
+// OTLPOption configures the writers of TypeOTLP.
+type OTLPOption struct {
+	// ResourceLabels are the labels moved to the resource attributes, the monitor labels when empty
+	ResourceLabels []string `toml:"resource_labels"`
+	Gzip           bool     `toml:"gzip"`
+}
+
+const otlpScope = "kubemonitor"
+
+var defaultResourceLabels = []string{labels.MonitorNamespace, labels.MonitorName}
+
+// otlpClient sends the series as an OTLP/HTTP export request in protobuf.
+type otlpClient struct {
+	opts     WriterOption
+	client   api.Client
+	endpoint string
+}
+
+func newOTLPClient(opt WriterOption, cli api.Client) (*otlpClient, error) {
+	endpoint, err := url.Parse(opt.Url)
+	if err != nil {
+		return nil, fmt.Errorf("invalid url %s: %w", opt.Url, err)
+	}
+	if endpoint.Path == "" || endpoint.Path == "/" {
+		endpoint.Path = "/v1/metrics"
+	}
+	if len(opt.OTLP.ResourceLabels) == 0 {
+		opt.OTLP.ResourceLabels = defaultResourceLabels
+	}
+	return &otlpClient{opts: opt, client: cli, endpoint: endpoint.String()}, nil
+}
+
+func (c *otlpClient) send(ctx context.Context, items []prompb.TimeSeries, metadata []prompb.MetricMetadata) error {
+	// MetricsData has the wire format of ExportMetricsServiceRequest, without its gRPC dependencies
+	data, err := proto.Marshal(encodeOTLP(items, c.opts.OTLP.ResourceLabels, metadata))
+	if err != nil {
+		logrus.Error("W! marshal otlp metrics got error:", err)
+		return err
+	}
+	body, err := compress(data, c.opts.OTLP.Gzip)
+	if err != nil {
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.endpoint, bytes.NewReader(body))
+	if err != nil {
+		logrus.Error("W! create otlp request got error:", err)
+		return err
+	}
+
+	httpReq.Header.Set("Content-Type", "application/x-protobuf")
+	httpReq.Header.Set("User-Agent", "categraf")
+	if c.opts.OTLP.Gzip {
+		httpReq.Header.Set("Content-Encoding", "gzip")
+	}
+	c.opts.setHeaders(httpReq)
+
+	return do(ctx, c.client, httpReq, "otlp")
+}
+
+// encodeOTLP groups items by the values of resourceLabels into resources, and by name into metrics.
+// The counters are monotonic cumulative sums and the gauges gauges, the metrics without
+// metadata are sums when named *_total and gauges otherwise. The native histograms are
+// exponential histograms.
+func encodeOTLP(items []prompb.TimeSeries, resourceLabels []string, metadata []prompb.MetricMetadata) *metricsv1.MetricsData {
+	isResource := make(map[string]bool, len(resourceLabels))
+	for _, name := range resourceLabels {
+		isResource[name] = true
+	}
+	families := make(map[string]prompb.MetricMetadata, len(metadata))
+	for _, family := range metadata {
+		families[family.MetricFamilyName] = family
+	}
+
+	type resourceMetrics struct {
+		scope   *metricsv1.ScopeMetrics
+		metrics map[string]*metricsv1.Metric
+	}
+	var (
+		data      = &metricsv1.MetricsData{}
+		resources = map[string]*resourceMetrics{}
+	)
+	for _, ts := range items {
+		var (
+			name       string
+			values     = map[string]string{}
+			resource   = []*commonv1.KeyValue{stringAttribute("service.name", otlpScope)}
+			attributes []*commonv1.KeyValue
+			key        strings.Builder
+		)
+		for _, l := range ts.Labels {
+			switch {
+			case l.Name == model.MetricNameLabel:
+				name = l.Value
+			case isResource[l.Name]:
+				values[l.Name] = l.Value
+			default:
+				attributes = append(attributes, stringAttribute(l.Name, l.Value))
+			}
+		}
+		if name == "" {
+			continue
+		}
+		// the labels of a series come in no particular order, the resource follows resourceLabels
+		for _, label := range resourceLabels {
+			if value, ok := values[label]; ok {
+				resource = append(resource, stringAttribute(label, value))
+				key.WriteString(label + "\xff" + value + "\xff")
+			}
+		}
+
+		rm, ok := resources[key.String()]
+		if !ok {
+			rm = &resourceMetrics{
+				scope:   &metricsv1.ScopeMetrics{Scope: &commonv1.InstrumentationScope{Name: otlpScope}},
+				metrics: map[string]*metricsv1.Metric{},
+			}
+			resources[key.String()] = rm
+			data.ResourceMetrics = append(data.ResourceMetrics, &metricsv1.ResourceMetrics{
+				Resource:     &resourcev1.Resource{Attributes: resource},
+				ScopeMetrics: []*metricsv1.ScopeMetrics{rm.scope},
+			})
+		}
+
+		metric, ok := rm.metrics[name]
+		if !ok {
+			metric = newOTLPMetric(name, families[name], len(ts.Histograms) > 0)
+			rm.metrics[name] = metric
+			rm.scope.Metrics = append(rm.scope.Metrics, metric)
+		}
+
+		points := make([]*metricsv1.NumberDataPoint, 0, len(ts.Samples))
+		for _, sample := range ts.Samples {
+			points = append(points, &metricsv1.NumberDataPoint{
+				Attributes:   attributes,
+				TimeUnixNano: uint64(sample.Timestamp) * 1e6,
+				Value:        &metricsv1.NumberDataPoint_AsDouble{AsDouble: sample.Value},
+			})
+		}
+		switch d := metric.Data.(type) {
+		case *metricsv1.Metric_ExponentialHistogram:
+			for i := range ts.Histograms {
+				d.ExponentialHistogram.DataPoints = append(d.ExponentialHistogram.DataPoints, exponentialPoint(&ts.Histograms[i], attributes))
+			}
+		case *metricsv1.Metric_Sum:
+			d.Sum.DataPoints = append(d.Sum.DataPoints, points...)
+		case *metricsv1.Metric_Gauge:
+			d.Gauge.DataPoints = append(d.Gauge.DataPoints, points...)
+		}
+	}
+	return data
+}
+
+func newOTLPMetric(name string, family prompb.MetricMetadata, native bool) *metricsv1.Metric {
+	metric := &metricsv1.Metric{Name: name, Description: family.Help, Unit: family.Unit}
+
+	if native {
+		metric.Data = &metricsv1.Metric_ExponentialHistogram{ExponentialHistogram: &metricsv1.ExponentialHistogram{
+			AggregationTemporality: metricsv1.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+		}}
+		return metric
+	}
+
+	counter := family.Type == prompb.MetricMetadata_COUNTER
+	if family.Type == prompb.MetricMetadata_UNKNOWN {
+		counter = strings.HasSuffix(name, "_total")
+	}
+	if counter {
+		metric.Data = &metricsv1.Metric_Sum{Sum: &metricsv1.Sum{
+			AggregationTemporality: metricsv1.AggregationTemporality_AGGREGATION_TEMPORALITY_CUMULATIVE,
+			IsMonotonic:            true,
+		}}
+		return metric
+	}
+	metric.Data = &metricsv1.Metric_Gauge{Gauge: &metricsv1.Gauge{}}
+	return metric
+}
+
+// exponentialPoint converts the native histogram h, the schemas of Prometheus are the scales of OTLP.
+func exponentialPoint(h *prompb.Histogram, attributes []*commonv1.KeyValue) *metricsv1.ExponentialHistogramDataPoint {
+	point := &metricsv1.ExponentialHistogramDataPoint{
+		Attributes:    attributes,
+		TimeUnixNano:  uint64(h.Timestamp) * 1e6,
+		Count:         h.GetCountInt(),
+		Sum:           &h.Sum,
+		Scale:         h.Schema,
+		ZeroCount:     h.GetZeroCountInt(),
+		ZeroThreshold: h.ZeroThreshold,
+		Positive:      exponentialBuckets(h.PositiveSpans, h.PositiveDeltas, h.PositiveCounts),
+		Negative:      exponentialBuckets(h.NegativeSpans, h.NegativeDeltas, h.NegativeCounts),
+	}
+	if _, ok := h.Count.(*prompb.Histogram_CountFloat); ok {
+		point.Count = uint64(h.GetCountFloat())
+	}
+	if _, ok := h.ZeroCount.(*prompb.Histogram_ZeroCountFloat); ok {
+		point.ZeroCount = uint64(h.GetZeroCountFloat())
+	}
+	return point
+}
+
+// exponentialBuckets converts the sparse buckets of a native histogram, counted by deltas or
+// by counts, to the dense buckets of OTLP. The bucket i of Prometheus is (base^(i-1), base^i],
+// it is the bucket i-1 of OTLP.
+func exponentialBuckets(spans []prompb.BucketSpan, deltas []int64, counts []float64) *metricsv1.ExponentialHistogramDataPoint_Buckets {
+	if len(spans) == 0 {
+		return nil
+	}
+
+	var (
+		buckets = &metricsv1.ExponentialHistogramDataPoint_Buckets{Offset: spans[0].Offset - 1}
+		k       int
+		count   int64
+	)
+	for i, span := range spans {
+		if i > 0 {
+			for j := int32(0); j < span.Offset; j++ {
+				buckets.BucketCounts = append(buckets.BucketCounts, 0)
+			}
+		}
+		for j := uint32(0); j < span.Length; j++ {
+			switch {
+			case k < len(deltas):
+				count += deltas[k]
+				buckets.BucketCounts = append(buckets.BucketCounts, uint64(count))
+			case k < len(counts):
+				buckets.BucketCounts = append(buckets.BucketCounts, uint64(counts[k]))
+			}
+			k++
+		}
+	}
+	return buckets
+}
+
+func stringAttribute(key, value string) *commonv1.KeyValue {
+	return &commonv1.KeyValue{Key: key, Value: &commonv1.AnyValue{Value: &commonv1.AnyValue_StringValue{StringValue: value}}}
+}
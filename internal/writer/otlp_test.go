@@ -0,0 +1,146 @@
+package writer
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+	metricsv1 "go.opentelemetry.io/proto/otlp/metrics/v1"
+	"google.golang.org/protobuf/proto"
+
+	"github.com/noovertime7/kubemonitor/pkg/types"
+)
+
+func TestOTLPWriter(t *testing.T) {
+	var (
+		path string
+		data metricsv1.MetricsData
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		body, _ := io.ReadAll(r.Body)
+		if err := proto.Unmarshal(body, &data); err != nil {
+			t.Error(err)
+		}
+	}))
+	defer server.Close()
+
+	w, err := newWriter(WriterOption{Type: TypeOTLP, Url: server.URL})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	monitor := func(name, metric string, value float64) prompb.TimeSeries {
+		return prompb.TimeSeries{
+			Labels: []prompb.Label{
+				{Name: "__name__", Value: metric},
+				{Name: "instance", Value: "db:3306"},
+				{Name: "monitor_name", Value: name},
+				{Name: "monitor_namespace", Value: "team-a"},
+			},
+			Samples: []prompb.Sample{{Value: value, Timestamp: 1000}},
+		}
+	}
+	series := []prompb.TimeSeries{
+		monitor("mysql", "mysql_up", 1),
+		monitor("mysql", "mysql_queries_total", 42),
+		monitor("mysql2", "mysql_up", 0),
+	}
+	if _, err := w.Write(context.Background(), series); err != nil {
+		t.Fatal(err)
+	}
+
+	if path != "/v1/metrics" {
+		t.Errorf("pushed to %s", path)
+	}
+	if len(data.ResourceMetrics) != 2 {
+		t.Fatalf("got %d resources, want one per monitor", len(data.ResourceMetrics))
+	}
+
+	resource := data.ResourceMetrics[0]
+	attributes := map[string]string{}
+	for _, kv := range resource.Resource.Attributes {
+		attributes[kv.Key] = kv.Value.GetStringValue()
+	}
+	if attributes["monitor_name"] != "mysql" || attributes["monitor_namespace"] != "team-a" || attributes["service.name"] != "kubemonitor" {
+		t.Errorf("resource attributes = %v", attributes)
+	}
+
+	metrics := resource.ScopeMetrics[0].Metrics
+	if len(metrics) != 2 {
+		t.Fatalf("got %d metrics, want 2", len(metrics))
+	}
+	up := metrics[0].GetGauge().GetDataPoints()
+	if len(up) != 1 || up[0].GetAsDouble() != 1 || up[0].TimeUnixNano != 1e9 {
+		t.Errorf("mysql_up data points = %v", up)
+	}
+	if len(up[0].Attributes) != 1 || up[0].Attributes[0].Key != "instance" {
+		t.Errorf("mysql_up attributes = %v", up[0].Attributes)
+	}
+	sum := metrics[1].GetSum()
+	if sum == nil || !sum.IsMonotonic || sum.DataPoints[0].GetAsDouble() != 42 {
+		t.Errorf("mysql_queries_total = %v, want a monotonic sum", metrics[1])
+	}
+}
+
+func TestEncodeOTLPLabelOrder(t *testing.T) {
+	series := []prompb.TimeSeries{
+		{
+			Labels: []prompb.Label{
+				{Name: "__name__", Value: "mysql_up"},
+				{Name: "monitor_name", Value: "mysql"},
+				{Name: "monitor_namespace", Value: "team-a"},
+			},
+			Samples: []prompb.Sample{{Value: 1, Timestamp: 1000}},
+		},
+		{
+			Labels: []prompb.Label{
+				{Name: "monitor_namespace", Value: "team-a"},
+				{Name: "__name__", Value: "mysql_queries_total"},
+				{Name: "monitor_name", Value: "mysql"},
+			},
+			Samples: []prompb.Sample{{Value: 42, Timestamp: 1000}},
+		},
+	}
+
+	data := encodeOTLP(series, defaultResourceLabels, nil)
+	if len(data.ResourceMetrics) != 1 {
+		t.Fatalf("got %d resources, want the single one of the monitor", len(data.ResourceMetrics))
+	}
+	var keys []string
+	for _, kv := range data.ResourceMetrics[0].Resource.Attributes {
+		keys = append(keys, kv.Key)
+	}
+	if want := []string{"service.name", "monitor_namespace", "monitor_name"}; !reflect.DeepEqual(keys, want) {
+		t.Errorf("resource attributes = %v, want %v", keys, want)
+	}
+	if metrics := data.ResourceMetrics[0].ScopeMetrics[0].Metrics; len(metrics) != 2 {
+		t.Errorf("got %d metrics, want 2", len(metrics))
+	}
+}
+
+func TestOTLPNativeHistogram(t *testing.T) {
+	h := types.NewNativeHistogram(0)
+	for _, v := range []float64{1, 3, 3, 100} {
+		h.Observe(v)
+	}
+	series := types.NewSample("app", "latency_seconds", h).SetType(types.Histogram).ConvertTimeSeries("ms")
+	if len(series) != 1 || len(series[0].Histograms) != 1 {
+		t.Fatalf("series = %v, want a single native histogram", series)
+	}
+
+	data := encodeOTLP([]prompb.TimeSeries{*series[0]}, defaultResourceLabels, nil)
+	point := data.ResourceMetrics[0].ScopeMetrics[0].Metrics[0].GetExponentialHistogram().GetDataPoints()[0]
+	if point.Count != 4 || point.GetSum() != 107 || point.Scale != 0 {
+		t.Errorf("point = %v", point)
+	}
+	// 1 is in (0.5, 1], 3 in (2, 4] and 100 in (64, 128]
+	want := []uint64{1, 0, 2, 0, 0, 0, 0, 1}
+	if point.Positive.Offset != -1 || !reflect.DeepEqual(point.Positive.BucketCounts, want) {
+		t.Errorf("positive buckets = %v, want offset -1 and %v", point.Positive, want)
+	}
+}
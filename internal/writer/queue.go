@@ -0,0 +1,66 @@
+package writer
+
+import (
+	types2 "github.com/noovertime7/kubemonitor/pkg/types"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// Queue buffers the series between WriteSamples and the writers.
+// Series are read with Peek and only removed by Commit once they were written.
+type Queue interface {
+	// Push appends items, it returns false when the queue is full
+	Push(items []*prompb.TimeSeries) bool
+	// Peek returns up to n of the oldest series without removing them
+	Peek(n int) ([]*prompb.TimeSeries, error)
+	// Commit removes the n oldest series
+	Commit(n int) error
+	Len() int
+	Close() error
+}
+
+// removableQueue is a Queue kept on disk, Remove deletes it once closed.
+type removableQueue interface {
+	Remove() error
+}
+
+// memoryQueue is a Queue limited to maxSize series, its content is lost on restart.
+type memoryQueue struct {
+	list *types2.SafeListLimited[*prompb.TimeSeries]
+	// pending holds the series returned by Peek and not committed yet, only the reader touches it
+	pending []*prompb.TimeSeries
+}
+
+func NewMemoryQueue(maxSize int) Queue {
+	return &memoryQueue{list: types2.NewSafeListLimited[*prompb.TimeSeries](maxSize)}
+}
+
+func (q *memoryQueue) Push(items []*prompb.TimeSeries) bool {
+	return q.list.PushFrontN(items)
+}
+
+func (q *memoryQueue) Peek(n int) ([]*prompb.TimeSeries, error) {
+	if len(q.pending) < n {
+		q.pending = append(q.pending, q.list.PopBackN(n-len(q.pending))...)
+	}
+	if len(q.pending) < n {
+		n = len(q.pending)
+	}
+	return q.pending[:n], nil
+}
+
+func (q *memoryQueue) Commit(n int) error {
+	if n > len(q.pending) {
+		n = len(q.pending)
+	}
+	q.pending = q.pending[n:]
+	return nil
+}
+
+func (q *memoryQueue) Len() int {
+	return q.list.Len() + len(q.pending)
+}
+
+func (q *memoryQueue) Close() error {
+	return nil
+}
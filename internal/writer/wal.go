@@ -0,0 +1,542 @@
+package writer
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/go-logr/logr"
+	"github.com/golang/protobuf/proto"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+const (
+	walSegmentSize   = 16 << 20
+	walSegmentSuffix = ".seg"
+	walCheckpoint    = "checkpoint"
+	// walRecordHeader is the length and crc32 of a record
+	walRecordHeader = 8
+)
+
+var walCRCTable = crc32.MakeTable(crc32.Castagnoli)
+
+// walPosition is a position in the WAL, the checkpoint is the position of the oldest uncommitted series.
+type walPosition struct {
+	Segment int   `json:"segment"`
+	Offset  int64 `json:"offset"`
+}
+
+// walQueue is a Queue persisted in segment files under dir, so that queued series survive restarts.
+// Every series is a record of its length, crc32 and protobuf encoding.
+type walQueue struct {
+	lock        sync.Mutex
+	dir         string
+	maxSize     int64
+	segmentSize int64
+	logger      logr.Logger
+
+	// segments are the indexes of the segment files on disk in ascending order,
+	// the last one is written to
+	segments []int
+	size     int64
+	count    int
+
+	w       *os.File
+	wbuf    *bufio.Writer
+	wOffset int64
+
+	committed walPosition
+	readPos   walPosition
+	reader    *os.File
+	rbuf      *bufio.Reader
+	// pending are the series returned by Peek, pendingEnds the position right after each of them
+	pending     []*prompb.TimeSeries
+	pendingEnds []walPosition
+}
+
+// NewWALQueue opens the WAL in dir, replaying the series left uncommitted by a previous run.
+// Push fails once the segments take more than maxSize bytes.
+func NewWALQueue(dir string, maxSize int64, logger logr.Logger) (Queue, error) {
+	if maxSize <= 0 {
+		return nil, fmt.Errorf("wal max size must be positive")
+	}
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	segmentSize := int64(walSegmentSize)
+	if maxSize/4 < segmentSize {
+		segmentSize = maxSize / 4
+	}
+
+	q := &walQueue{
+		dir:         dir,
+		maxSize:     maxSize,
+		segmentSize: segmentSize,
+		logger:      logger.WithName("wal"),
+	}
+	if err := q.open(); err != nil {
+		return nil, err
+	}
+	return q, nil
+}
+
+func (q *walQueue) open() error {
+	segments, err := q.listSegments()
+	if err != nil {
+		return err
+	}
+
+	q.committed, err = q.readCheckpoint()
+	if err != nil {
+		return err
+	}
+
+	for _, segment := range segments {
+		if segment < q.committed.Segment {
+			if err := os.Remove(q.segmentPath(segment)); err != nil {
+				return err
+			}
+			continue
+		}
+		q.segments = append(q.segments, segment)
+	}
+
+	if len(q.segments) == 0 {
+		first := q.committed.Segment
+		if first == 0 {
+			first = 1
+		}
+		q.committed = walPosition{Segment: first}
+		q.segments = []int{first}
+	}
+	if q.committed.Segment < q.segments[0] {
+		q.committed = walPosition{Segment: q.segments[0]}
+	}
+
+	if err := q.replay(); err != nil {
+		return err
+	}
+
+	last := q.segments[len(q.segments)-1]
+	q.w, err = os.OpenFile(q.segmentPath(last), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	info, err := q.w.Stat()
+	if err != nil {
+		return err
+	}
+	q.wOffset = info.Size()
+	q.wbuf = bufio.NewWriter(q.w)
+
+	for _, segment := range q.segments {
+		info, err := os.Stat(q.segmentPath(segment))
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err == nil {
+			q.size += info.Size()
+		}
+	}
+
+	q.readPos = q.committed
+	q.logger.Info("wal opened", "dir", q.dir, "segments", len(q.segments), "series", q.count, "size", q.size)
+	return nil
+}
+
+// replay counts the uncommitted series and truncates a torn record at the end of the last segment.
+func (q *walQueue) replay() error {
+	for i, segment := range q.segments {
+		offset := int64(0)
+		if segment == q.committed.Segment {
+			offset = q.committed.Offset
+		}
+
+		count, end, err := q.scanSegment(segment, offset)
+		q.count += count
+		if err == nil {
+			continue
+		}
+
+		if i != len(q.segments)-1 {
+			q.logger.Error(err, "skip corrupted wal segment tail", "segment", segment, "offset", end)
+			continue
+		}
+		q.logger.Error(err, "truncate corrupted wal segment", "segment", segment, "offset", end)
+		if err := os.Truncate(q.segmentPath(segment), end); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// scanSegment counts the valid records of segment from offset and returns the end of the last one.
+func (q *walQueue) scanSegment(segment int, offset int64) (int, int64, error) {
+	f, err := os.Open(q.segmentPath(segment))
+	if err != nil {
+		if os.IsNotExist(err) {
+			return 0, offset, nil
+		}
+		return 0, offset, err
+	}
+	defer f.Close()
+
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, offset, err
+	}
+
+	r := bufio.NewReader(f)
+	count := 0
+	for {
+		data, err := readWALRecord(r)
+		if err == io.EOF {
+			return count, offset, nil
+		}
+		if err != nil {
+			return count, offset, err
+		}
+		count++
+		offset += walRecordHeader + int64(len(data))
+	}
+}
+
+func (q *walQueue) Push(items []*prompb.TimeSeries) bool {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	records := make([][]byte, 0, len(items))
+	total := int64(0)
+	for _, item := range items {
+		data, err := proto.Marshal(item)
+		if err != nil {
+			q.logger.Error(err, "marshal series error")
+			continue
+		}
+		records = append(records, data)
+		total += walRecordHeader + int64(len(data))
+	}
+
+	if q.size+total > q.maxSize {
+		return false
+	}
+
+	if q.wOffset >= q.segmentSize {
+		if err := q.rotate(); err != nil {
+			q.logger.Error(err, "rotate wal segment error")
+			return false
+		}
+	}
+
+	header := make([]byte, walRecordHeader)
+	for _, data := range records {
+		binary.BigEndian.PutUint32(header[:4], uint32(len(data)))
+		binary.BigEndian.PutUint32(header[4:], crc32.Checksum(data, walCRCTable))
+		if _, err := q.wbuf.Write(header); err != nil {
+			q.logger.Error(err, "write wal error")
+			return false
+		}
+		if _, err := q.wbuf.Write(data); err != nil {
+			q.logger.Error(err, "write wal error")
+			return false
+		}
+		q.wOffset += walRecordHeader + int64(len(data))
+		q.size += walRecordHeader + int64(len(data))
+		q.count++
+	}
+
+	if err := q.wbuf.Flush(); err != nil {
+		q.logger.Error(err, "flush wal error")
+		return false
+	}
+	// the series are only acknowledged once on disk, so that they survive a node crash
+	if err := q.w.Sync(); err != nil {
+		q.logger.Error(err, "sync wal error")
+		return false
+	}
+	return true
+}
+
+func (q *walQueue) rotate() error {
+	if err := q.wbuf.Flush(); err != nil {
+		return err
+	}
+	if err := q.w.Sync(); err != nil {
+		return err
+	}
+	if err := q.w.Close(); err != nil {
+		return err
+	}
+
+	next := q.segments[len(q.segments)-1] + 1
+	w, err := os.OpenFile(q.segmentPath(next), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+	q.segments = append(q.segments, next)
+	q.w = w
+	q.wbuf = bufio.NewWriter(w)
+	q.wOffset = 0
+	return nil
+}
+
+func (q *walQueue) Peek(n int) ([]*prompb.TimeSeries, error) {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	for len(q.pending) < n {
+		item, ok, err := q.next()
+		if err != nil {
+			return nil, err
+		}
+		if !ok {
+			break
+		}
+		q.pending = append(q.pending, item)
+		q.pendingEnds = append(q.pendingEnds, q.readPos)
+	}
+
+	if len(q.pending) < n {
+		n = len(q.pending)
+	}
+	return q.pending[:n], nil
+}
+
+// next reads the series at readPos, ok is false when all written series were read.
+func (q *walQueue) next() (*prompb.TimeSeries, bool, error) {
+	for {
+		if q.reader == nil {
+			f, err := os.Open(q.segmentPath(q.readPos.Segment))
+			if err != nil {
+				return nil, false, err
+			}
+			if _, err := f.Seek(q.readPos.Offset, io.SeekStart); err != nil {
+				f.Close()
+				return nil, false, err
+			}
+			q.reader = f
+			q.rbuf = bufio.NewReader(f)
+		}
+
+		data, err := readWALRecord(q.rbuf)
+		if err == nil {
+			item := &prompb.TimeSeries{}
+			q.readPos.Offset += walRecordHeader + int64(len(data))
+			if err := proto.Unmarshal(data, item); err != nil {
+				q.logger.Error(err, "skip undecodable wal record", "segment", q.readPos.Segment)
+				q.count--
+				continue
+			}
+			return item, true, nil
+		}
+
+		if err != io.EOF {
+			q.logger.Error(err, "skip corrupted wal segment tail", "segment", q.readPos.Segment, "offset", q.readPos.Offset)
+		}
+		if q.readPos.Segment == q.segments[len(q.segments)-1] {
+			// the reader caught up with the writer, reopen on the next read to see new records
+			q.closeReader()
+			return nil, false, nil
+		}
+
+		q.closeReader()
+		q.readPos = walPosition{Segment: q.nextSegment(q.readPos.Segment)}
+	}
+}
+
+func (q *walQueue) nextSegment(segment int) int {
+	i := sort.SearchInts(q.segments, segment+1)
+	return q.segments[i]
+}
+
+func (q *walQueue) closeReader() {
+	if q.reader != nil {
+		q.reader.Close()
+		q.reader = nil
+		q.rbuf = nil
+	}
+}
+
+func (q *walQueue) Commit(n int) error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	if n > len(q.pending) {
+		n = len(q.pending)
+	}
+	if n == 0 {
+		return nil
+	}
+
+	q.committed = q.pendingEnds[n-1]
+	q.pending = q.pending[n:]
+	q.pendingEnds = q.pendingEnds[n:]
+	q.count -= n
+
+	if err := q.writeCheckpoint(); err != nil {
+		return err
+	}
+	return q.truncate()
+}
+
+// truncate removes the segments before the committed one.
+func (q *walQueue) truncate() error {
+	for len(q.segments) > 1 && q.segments[0] < q.committed.Segment {
+		path := q.segmentPath(q.segments[0])
+		info, err := os.Stat(path)
+		if err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if err := os.Remove(path); err != nil && !os.IsNotExist(err) {
+			return err
+		}
+		if info != nil {
+			q.size -= info.Size()
+		}
+		q.segments = q.segments[1:]
+	}
+	return nil
+}
+
+func (q *walQueue) Len() int {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+	return q.count
+}
+
+func (q *walQueue) Close() error {
+	q.lock.Lock()
+	defer q.lock.Unlock()
+
+	q.closeReader()
+	if err := q.wbuf.Flush(); err != nil {
+		return err
+	}
+	if err := q.w.Sync(); err != nil {
+		return err
+	}
+	if err := q.w.Close(); err != nil {
+		return err
+	}
+	return q.writeCheckpoint()
+}
+
+// Remove deletes the segments and the checkpoint, the queue must be closed.
+func (q *walQueue) Remove() error {
+	return os.RemoveAll(q.dir)
+}
+
+func (q *walQueue) readCheckpoint() (walPosition, error) {
+	pos := walPosition{}
+	data, err := os.ReadFile(filepath.Join(q.dir, walCheckpoint))
+	if os.IsNotExist(err) {
+		return pos, nil
+	}
+	if err != nil {
+		return pos, err
+	}
+	if err := json.Unmarshal(data, &pos); err != nil {
+		return pos, fmt.Errorf("read wal checkpoint: %w", err)
+	}
+	return pos, nil
+}
+
+// writeCheckpoint atomically replaces the checkpoint file with the committed position, the file
+// and then the directory are synced so that the checkpoint survives a node crash.
+func (q *walQueue) writeCheckpoint() error {
+	data, err := json.Marshal(q.committed)
+	if err != nil {
+		return err
+	}
+	tmp := filepath.Join(q.dir, walCheckpoint+".tmp")
+	f, err := os.OpenFile(tmp, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0o644)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Write(data); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, filepath.Join(q.dir, walCheckpoint)); err != nil {
+		return err
+	}
+	return syncDir(q.dir)
+}
+
+// syncDir syncs the entries of dir, e.g. a renamed file.
+func syncDir(dir string) error {
+	d, err := os.Open(dir)
+	if err != nil {
+		return err
+	}
+	defer d.Close()
+	return d.Sync()
+}
+
+func (q *walQueue) listSegments() ([]int, error) {
+	entries, err := os.ReadDir(q.dir)
+	if err != nil {
+		return nil, err
+	}
+	var segments []int
+	for _, entry := range entries {
+		name := entry.Name()
+		if entry.IsDir() || !strings.HasSuffix(name, walSegmentSuffix) {
+			continue
+		}
+		segment, err := strconv.Atoi(strings.TrimSuffix(name, walSegmentSuffix))
+		if err != nil {
+			continue
+		}
+		segments = append(segments, segment)
+	}
+	sort.Ints(segments)
+	return segments, nil
+}
+
+func (q *walQueue) segmentPath(segment int) string {
+	return filepath.Join(q.dir, fmt.Sprintf("%08d%s", segment, walSegmentSuffix))
+}
+
+var errWALCorrupted = errors.New("wal record corrupted")
+
+// readWALRecord reads a record, it returns io.EOF when r ends on a record boundary.
+func readWALRecord(r io.Reader) ([]byte, error) {
+	header := make([]byte, walRecordHeader)
+	if _, err := io.ReadFull(r, header); err != nil {
+		if err == io.EOF {
+			return nil, io.EOF
+		}
+		return nil, errWALCorrupted
+	}
+
+	length := binary.BigEndian.Uint32(header[:4])
+	if length > walSegmentSize {
+		return nil, errWALCorrupted
+	}
+	data := make([]byte, length)
+	if _, err := io.ReadFull(r, data); err != nil {
+		return nil, errWALCorrupted
+	}
+	if crc32.Checksum(data, walCRCTable) != binary.BigEndian.Uint32(header[4:]) {
+		return nil, errWALCorrupted
+	}
+	return data, nil
+}
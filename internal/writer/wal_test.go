@@ -0,0 +1,200 @@
+package writer
+
+import (
+	"encoding/binary"
+	"fmt"
+	"hash/crc32"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/go-logr/logr"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+func walSeries(from, to int) []*prompb.TimeSeries {
+	items := make([]*prompb.TimeSeries, 0, to-from)
+	for i := from; i < to; i++ {
+		items = append(items, &prompb.TimeSeries{
+			Labels:  []prompb.Label{{Name: "__name__", Value: fmt.Sprintf("metric_%d", i)}},
+			Samples: []prompb.Sample{{Value: float64(i), Timestamp: int64(i)}},
+		})
+	}
+	return items
+}
+
+func peekNames(t *testing.T, q Queue, n int) []string {
+	t.Helper()
+	items, err := q.Peek(n)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, 0, len(items))
+	for _, item := range items {
+		names = append(names, item.Labels[0].Value)
+	}
+	return names
+}
+
+func TestWALQueueReplay(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := NewWALQueue(dir, 1<<20, logr.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !q.Push(walSeries(0, 10)) {
+		t.Fatal("Push() = false")
+	}
+	if got := peekNames(t, q, 3); fmt.Sprint(got) != "[metric_0 metric_1 metric_2]" {
+		t.Fatalf("Peek() = %v", got)
+	}
+	// an uncommitted peek is returned again
+	if got := peekNames(t, q, 3); fmt.Sprint(got) != "[metric_0 metric_1 metric_2]" {
+		t.Fatalf("Peek() = %v", got)
+	}
+	if err := q.Commit(3); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	q, err = NewWALQueue(dir, 1<<20, logr.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	if q.Len() != 7 {
+		t.Fatalf("Len() after replay = %d, want 7", q.Len())
+	}
+	if got := peekNames(t, q, 2); fmt.Sprint(got) != "[metric_3 metric_4]" {
+		t.Fatalf("Peek() after replay = %v", got)
+	}
+}
+
+func TestWALQueueTornWrite(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := NewWALQueue(dir, 1<<20, logr.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Push(walSeries(0, 2))
+	q.Close()
+
+	f, err := os.OpenFile(q.(*walQueue).segmentPath(1), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte{0, 0, 1})
+	f.Close()
+
+	q, err = NewWALQueue(dir, 1<<20, logr.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	q.Push(walSeries(2, 3))
+	if got := peekNames(t, q, 10); fmt.Sprint(got) != "[metric_0 metric_1 metric_2]" {
+		t.Fatalf("Peek() = %v", got)
+	}
+}
+
+func TestWALQueueSizeLimit(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := NewWALQueue(dir, 4096, logr.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	pushed := 0
+	for q.Push(walSeries(pushed, pushed+1)) {
+		pushed++
+	}
+	if pushed == 0 {
+		t.Fatal("Push() rejected the first series")
+	}
+
+	// committing everything frees rotated segments for new series
+	for q.Len() > 0 {
+		items, err := q.Peek(10)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := q.Commit(len(items)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if !q.Push(walSeries(0, 1)) {
+		t.Fatal("Push() after commit = false")
+	}
+}
+
+func TestWALQueueSkipsUndecodableRecord(t *testing.T) {
+	dir := t.TempDir()
+
+	q, err := NewWALQueue(dir, 1<<20, logr.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	q.Push(walSeries(0, 1))
+	q.Close()
+
+	// a record with a valid crc whose protobuf is truncated
+	data := []byte{0x0a, 0x05}
+	record := make([]byte, walRecordHeader, walRecordHeader+len(data))
+	binary.BigEndian.PutUint32(record[:4], uint32(len(data)))
+	binary.BigEndian.PutUint32(record[4:], crc32.Checksum(data, walCRCTable))
+	f, err := os.OpenFile(q.(*walQueue).segmentPath(1), os.O_WRONLY|os.O_APPEND, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write(append(record, data...))
+	f.Close()
+
+	q, err = NewWALQueue(dir, 1<<20, logr.Discard())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer q.Close()
+
+	q.Push(walSeries(1, 2))
+	if q.Len() != 3 {
+		t.Fatalf("Len() = %d, want the 3 records", q.Len())
+	}
+	if got := peekNames(t, q, 10); fmt.Sprint(got) != "[metric_0 metric_1]" {
+		t.Fatalf("Peek() = %v", got)
+	}
+	if err := q.Commit(2); err != nil {
+		t.Fatal(err)
+	}
+	if q.Len() != 0 {
+		t.Errorf("Len() = %d after committing every decodable series, want 0", q.Len())
+	}
+}
+
+func TestWritersDeRegisterRemovesWAL(t *testing.T) {
+	dir := t.TempDir()
+
+	ws := NewWriterWithQueues(WALQueues(dir, 1<<20, logr.Discard()), 10, logr.Discard())
+	defer ws.Close()
+	if err := ws.Register("default/remote", WriterOption{Url: "http://127.0.0.1:1"}); err != nil {
+		t.Fatal(err)
+	}
+	walDir := filepath.Join(dir, "default_remote")
+	if _, err := os.Stat(walDir); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := ws.DeRegister("default/remote"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(walDir); !os.IsNotExist(err) {
+		t.Errorf("wal directory of the deregistered destination still exists, stat error = %v", err)
+	}
+}
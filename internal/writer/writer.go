@@ -3,40 +3,170 @@ package writer
 import (
 	"bytes"
 	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
 	"fmt"
 	"github.com/golang/protobuf/proto"
 	"github.com/golang/snappy"
 	"github.com/prometheus/client_golang/api"
 	"github.com/prometheus/prometheus/prompb"
 	"github.com/sirupsen/logrus"
+	"io"
+	"k8s.io/apimachinery/pkg/labels"
+	"math/rand"
 	"net"
 	"net/http"
+	"strconv"
+	"strings"
 	"time"
 )
 
+// Writer pushes batches of series with the client of its type, retrying the recoverable failures.
 type Writer struct {
 	Opts   WriterOption
-	Client api.Client
+	client client
+	// metadata describes the metrics written, nil when unknown
+	metadata *metadataStore
 }
 
+// client sends a batch of series in the protocol of a writer type, along with the metadata
+// of their metrics the protocol has room for.
+type client interface {
+	send(ctx context.Context, items []prompb.TimeSeries, metadata []prompb.MetricMetadata) error
+}
+
+const (
+	// TypeRemoteWrite pushes with the Prometheus remote write protocol
+	TypeRemoteWrite = "remote_write"
+	// TypeInflux pushes with the InfluxDB line protocol
+	TypeInflux = "influx"
+	// TypeOTLP pushes with OTLP/HTTP in protobuf
+	TypeOTLP = "otlp"
+	// TypeKafka produces to a Kafka topic
+	TypeKafka = "kafka"
+)
+
 type WriterOption struct {
+	// Type selects the protocol, empty is TypeRemoteWrite
+	Type string `toml:"type"`
+	// Influx configures the writers of TypeInflux
+	Influx InfluxOption `toml:"influx"`
+	// OTLP configures the writers of TypeOTLP
+	OTLP OTLPOption `toml:"otlp"`
+	// Kafka configures the writers of TypeKafka
+	Kafka KafkaOption `toml:"kafka"`
+
+	// Url is the endpoint of the HTTP types
 	Url           string   `toml:"url"`
 	BasicAuthUser string   `toml:"basic_auth_user"`
 	BasicAuthPass string   `toml:"basic_auth_pass"`
 	Headers       []string `toml:"headers"`
+	BearerToken   string   `toml:"bearer_token"`
+
+	// TLSCA, TLSCert and TLSKey are PEM encoded
+	TLSCA                 string `toml:"tls_ca"`
+	TLSCert               string `toml:"tls_cert"`
+	TLSKey                string `toml:"tls_key"`
+	TLSServerName         string `toml:"tls_server_name"`
+	TLSInsecureSkipVerify bool   `toml:"tls_insecure_skip_verify"`
 
 	Timeout             int64 `toml:"timeout"`
 	DialTimeout         int64 `toml:"dial_timeout"`
 	MaxIdleConnsPerHost int   `toml:"max_idle_conns_per_host"`
+
+	// Batch is the max series of a push and Concurrency the pushes sent in parallel,
+	// 0 uses the defaults of the WritersManager
+	Batch       int `toml:"batch"`
+	Concurrency int `toml:"concurrency"`
+
+	// MonitorSelector and MonitorNamespaces restrict the sources written, nil and empty match all
+	MonitorSelector   labels.Selector `toml:"-"`
+	MonitorNamespaces []string        `toml:"monitor_namespaces"`
+
+	// MaxRetries bounds the retries of a failed push, a negative value disables retries
+	MaxRetries int           `toml:"max_retries"`
+	MinBackoff time.Duration `toml:"min_backoff"`
+	MaxBackoff time.Duration `toml:"max_backoff"`
 }
 
+const (
+	defaultMaxRetries = 5
+	defaultMinBackoff = 500 * time.Millisecond
+	defaultMaxBackoff = 30 * time.Second
+)
+
 // newWriter creates a new Writer from config.WriterOption
 func newWriter(opt WriterOption) (Writer, error) {
-	cli, err := api.NewClient(api.Config{
+	if opt.Type == TypeKafka {
+		kafka, err := newKafkaClient(opt)
+		if err != nil {
+			return Writer{}, err
+		}
+		return Writer{Opts: opt, client: kafka}, nil
+	}
+
+	if opt.Url == "" {
+		return Writer{}, fmt.Errorf("url is empty")
+	}
+	cli, err := opt.httpClient()
+	if err != nil {
+		return Writer{}, err
+	}
+
+	switch opt.Type {
+	case "", TypeRemoteWrite:
+		return Writer{Opts: opt, client: &remoteWriteClient{opts: opt, client: cli}}, nil
+	case TypeInflux:
+		influx, err := newInfluxClient(opt, cli)
+		if err != nil {
+			return Writer{}, err
+		}
+		return Writer{Opts: opt, client: influx}, nil
+	case TypeOTLP:
+		otlp, err := newOTLPClient(opt, cli)
+		if err != nil {
+			return Writer{}, err
+		}
+		return Writer{Opts: opt, client: otlp}, nil
+	default:
+		return Writer{}, fmt.Errorf("unknown writer type %q", opt.Type)
+	}
+}
+
+// deliveryCounter is implemented by the clients counting the messages and bytes acknowledged by their brokers.
+type deliveryCounter interface {
+	delivered() (messages, bytes uint64)
+}
+
+// delivered returns the messages and bytes acknowledged since the writer was created.
+func (w Writer) delivered() (messages, bytes uint64) {
+	if counter, ok := w.client.(deliveryCounter); ok {
+		return counter.delivered()
+	}
+	return 0, 0
+}
+
+// Close releases the connections the client keeps open between the pushes.
+func (w Writer) Close() error {
+	if closer, ok := w.client.(io.Closer); ok {
+		return closer.Close()
+	}
+	return nil
+}
+
+// httpClient creates the HTTP client of the writers pushing to Url.
+func (opt WriterOption) httpClient() (api.Client, error) {
+	tlsConfig, err := opt.tlsConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return api.NewClient(api.Config{
 		Address: opt.Url,
 		RoundTripper: &http.Transport{
-			// TLSClientConfig: tlsConfig,
-			Proxy: http.ProxyFromEnvironment,
+			TLSClientConfig: tlsConfig,
+			Proxy:           http.ProxyFromEnvironment,
 			DialContext: (&net.Dialer{
 				Timeout: time.Duration(opt.DialTimeout) * time.Second,
 			}).DialContext,
@@ -45,41 +175,203 @@ func newWriter(opt WriterOption) (Writer, error) {
 			MaxIdleConns:          100,
 		},
 	})
+}
 
-	if err != nil {
-		return Writer{}, err
+// Source is the Monitor samples come from, the zero Source is kubemonitor itself.
+type Source struct {
+	Namespace string
+	Name      string
+	Labels    map[string]string
+}
+
+// Matches reports whether samples from source are written by a writer with opt.
+func (opt WriterOption) Matches(source Source) bool {
+	if source.Namespace == "" && source.Name == "" {
+		return true
+	}
+	if len(opt.MonitorNamespaces) > 0 {
+		matched := false
+		for _, namespace := range opt.MonitorNamespaces {
+			if namespace == source.Namespace {
+				matched = true
+				break
+			}
+		}
+		if !matched {
+			return false
+		}
+	}
+	if opt.MonitorSelector != nil && !opt.MonitorSelector.Matches(labels.Set(source.Labels)) {
+		return false
+	}
+	return true
+}
+
+// tlsConfig builds the client TLS config, it returns nil when no TLS option is set
+func (opt WriterOption) tlsConfig() (*tls.Config, error) {
+	if opt.TLSCA == "" && opt.TLSCert == "" && opt.TLSKey == "" && opt.TLSServerName == "" && !opt.TLSInsecureSkipVerify {
+		return nil, nil
+	}
+
+	tlsConfig := &tls.Config{
+		ServerName:         opt.TLSServerName,
+		InsecureSkipVerify: opt.TLSInsecureSkipVerify,
+	}
+
+	if opt.TLSCA != "" {
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM([]byte(opt.TLSCA)) {
+			return nil, fmt.Errorf("no valid certificate found in tls ca")
+		}
+		tlsConfig.RootCAs = pool
 	}
 
-	return Writer{
-		Opts:   opt,
-		Client: cli,
-	}, nil
+	if opt.TLSCert != "" || opt.TLSKey != "" {
+		if opt.TLSCert == "" || opt.TLSKey == "" {
+			return nil, fmt.Errorf("tls cert and key must be set together")
+		}
+		cert, err := tls.X509KeyPair([]byte(opt.TLSCert), []byte(opt.TLSKey))
+		if err != nil {
+			return nil, fmt.Errorf("load tls client certificate: %w", err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{cert}
+	}
+
+	return tlsConfig, nil
 }
 
-func (w Writer) Write(items []prompb.TimeSeries) error {
+// Write pushes items to the endpoint, retrying recoverable failures
+// (network errors, 5xx and 429) with exponential backoff until MaxRetries is exhausted.
+// A Retry-After of the server replaces the backoff, up to MaxBackoff, and a push that partly
+// failed retries only the items left.
+func (w Writer) Write(ctx context.Context, items []prompb.TimeSeries) (retries int, err error) {
 	if len(items) == 0 {
-		return nil
+		return 0, nil
 	}
 
-	req := &prompb.WriteRequest{
-		Timeseries: items,
+	metadata := w.metadata.lookup(items)
+	maxRetries, minBackoff, maxBackoff := w.Opts.retryOptions()
+	for attempt := 0; ; attempt++ {
+		err = w.client.send(ctx, items, metadata)
+		if err == nil {
+			return attempt, nil
+		}
+
+		var recoverable *recoverableError
+		if !errors.As(err, &recoverable) || attempt >= maxRetries {
+			logrus.Error("W! post to ", w.Opts.target(), " got error after ", attempt, " retries: ", err)
+			logrus.Error("W! example timeseries:", items[0].String())
+			return attempt, err
+		}
+
+		delay := backoff(attempt, minBackoff, maxBackoff)
+		if recoverable.retryAfter > 0 {
+			// the server may ask for hours, the destination would stall as long
+			delay = recoverable.retryAfter
+			if delay > maxBackoff {
+				delay = maxBackoff
+			}
+		}
+		if recoverable.retry != nil {
+			items = recoverable.retry
+		}
+		logrus.Warn("W! post to ", w.Opts.target(), " got recoverable error, retry after ", delay, ": ", err)
+		select {
+		case <-time.After(delay):
+		case <-ctx.Done():
+			return attempt, ctx.Err()
+		}
 	}
+}
 
-	data, err := proto.Marshal(req)
-	if err != nil {
-		logrus.Error("W! marshal prom data to proto got error:", err, "data:", items)
-		return err
+// recoverableError is a failed push worth retrying.
+type recoverableError struct {
+	err error
+	// retryAfter is the delay requested by the server through Retry-After, if any
+	retryAfter time.Duration
+	// retry are the items left to push when the push partly failed, all of them when nil
+	retry []prompb.TimeSeries
+}
+
+func (e *recoverableError) Error() string {
+	return e.err.Error()
+}
+
+func (e *recoverableError) Unwrap() error {
+	return e.err
+}
+
+// isRecoverable reports whether err is a push failure worth retrying later.
+func isRecoverable(err error) bool {
+	var recoverable *recoverableError
+	return errors.As(err, &recoverable)
+}
+
+// target describes where the writer pushes to, in the logs.
+func (opt WriterOption) target() string {
+	if opt.Type == TypeKafka {
+		return fmt.Sprintf("kafka topic %s on %s", opt.Kafka.Topic, strings.Join(opt.Kafka.Brokers, ","))
 	}
+	return opt.Url
+}
 
-	if err := w.post(snappy.Encode(nil, data)); err != nil {
-		logrus.Error("W! post to", w.Opts.Url, "got error:", err)
-		logrus.Error("W! example timeseries:", items[0].String())
+func (opt WriterOption) retryOptions() (maxRetries int, minBackoff, maxBackoff time.Duration) {
+	maxRetries, minBackoff, maxBackoff = opt.MaxRetries, opt.MinBackoff, opt.MaxBackoff
+	if maxRetries == 0 {
+		maxRetries = defaultMaxRetries
 	}
-	return nil
+	if minBackoff <= 0 {
+		minBackoff = defaultMinBackoff
+	}
+	if maxBackoff <= 0 {
+		maxBackoff = defaultMaxBackoff
+	}
+	return
+}
+
+// backoff returns the delay before retry attempt+1, doubling from min up to max with jitter.
+func backoff(attempt int, min, max time.Duration) time.Duration {
+	delay := min
+	for i := 0; i < attempt && delay < max; i++ {
+		delay *= 2
+	}
+	if delay > max {
+		delay = max
+	}
+	// full jitter on the upper half so concurrent writers do not retry in lockstep
+	return delay/2 + time.Duration(rand.Int63n(int64(delay/2)+1))
+}
+
+// parseRetryAfter parses a Retry-After header given in seconds or as an HTTP date.
+func parseRetryAfter(value string) time.Duration {
+	if value == "" {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(value); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
+
+// remoteWriteClient sends the series as a snappy compressed remote write request.
+type remoteWriteClient struct {
+	opts   WriterOption
+	client api.Client
 }
 
-func (w Writer) post(req []byte) error {
-	httpReq, err := http.NewRequest("POST", w.Opts.Url, bytes.NewReader(req))
+func (c *remoteWriteClient) send(ctx context.Context, items []prompb.TimeSeries, metadata []prompb.MetricMetadata) error {
+	data, err := proto.Marshal(&prompb.WriteRequest{Timeseries: items, Metadata: metadata})
+	if err != nil {
+		logrus.Error("W! marshal prom data to proto got error:", err, "data:", items)
+		return err
+	}
+
+	httpReq, err := http.NewRequestWithContext(ctx, "POST", c.opts.Url, bytes.NewReader(snappy.Encode(nil, data)))
 	if err != nil {
 		logrus.Error("W! create remote write request got error:", err)
 		return err
@@ -90,25 +382,43 @@ func (w Writer) post(req []byte) error {
 	httpReq.Header.Set("User-Agent", "categraf")
 	httpReq.Header.Set("X-Prometheus-Remote-Write-Version", "0.1.0")
 
-	for i := 0; i < len(w.Opts.Headers); i += 2 {
-		httpReq.Header.Add(w.Opts.Headers[i], w.Opts.Headers[i+1])
-		if w.Opts.Headers[i] == "Host" {
-			httpReq.Host = w.Opts.Headers[i+1]
+	c.opts.setHeaders(httpReq)
+	return do(ctx, c.client, httpReq, "remote write")
+}
+
+// setHeaders sets the configured headers and credentials of req.
+func (opt WriterOption) setHeaders(req *http.Request) {
+	for i := 0; i+1 < len(opt.Headers); i += 2 {
+		req.Header.Add(opt.Headers[i], opt.Headers[i+1])
+		if opt.Headers[i] == "Host" {
+			req.Host = opt.Headers[i+1]
 		}
 	}
 
-	if w.Opts.BasicAuthUser != "" {
-		httpReq.SetBasicAuth(w.Opts.BasicAuthUser, w.Opts.BasicAuthPass)
+	if opt.BasicAuthUser != "" {
+		req.SetBasicAuth(opt.BasicAuthUser, opt.BasicAuthPass)
 	}
 
-	resp, body, err := w.Client.Do(context.Background(), httpReq)
+	if opt.BearerToken != "" {
+		req.Header.Set("Authorization", "Bearer "+opt.BearerToken)
+	}
+}
+
+// do sends req, the network errors, 5xx and 429 are recoverable.
+func do(ctx context.Context, cli api.Client, req *http.Request, protocol string) error {
+	resp, body, err := cli.Do(ctx, req)
 	if err != nil {
-		logrus.Error("W! push data with remote write request got error:", err, "response body:", string(body))
-		return err
+		if ctx.Err() != nil {
+			return ctx.Err()
+		}
+		return &recoverableError{err: fmt.Errorf("push data with %s request got error: %w", protocol, err)}
 	}
 
 	if resp.StatusCode >= 400 {
-		err = fmt.Errorf("push data with remote write request got status code: %v, response body: %s", resp.StatusCode, string(body))
+		err = fmt.Errorf("push data with %s request got status code: %v, response body: %s", protocol, resp.StatusCode, string(body))
+		if resp.StatusCode >= 500 || resp.StatusCode == http.StatusTooManyRequests {
+			return &recoverableError{err: err, retryAfter: parseRetryAfter(resp.Header.Get("Retry-After"))}
+		}
 		return err
 	}
 
@@ -0,0 +1,120 @@
+package writer
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+	"k8s.io/apimachinery/pkg/labels"
+)
+
+func TestWriterRetry(t *testing.T) {
+	series := []prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: time.Now().UnixMilli()}},
+	}}
+
+	tests := []struct {
+		name        string
+		statuses    []int
+		retryAfter  string
+		maxBackoff  time.Duration
+		wantWait    time.Duration
+		wantRetries int
+		wantErr     bool
+	}{
+		{name: "success", statuses: []int{200}, wantRetries: 0},
+		{name: "retry on 5xx", statuses: []int{503, 500, 204}, wantRetries: 2},
+		{name: "retry on 429 with retry-after", statuses: []int{429, 200}, retryAfter: "1", maxBackoff: 2 * time.Second, wantWait: time.Second, wantRetries: 1},
+		{name: "retry-after capped by max backoff", statuses: []int{429, 200}, retryAfter: "3600", maxBackoff: 10 * time.Millisecond, wantWait: 10 * time.Millisecond, wantRetries: 1},
+		{name: "no retry on 4xx", statuses: []int{400}, wantRetries: 0, wantErr: true},
+		{name: "give up after max retries", statuses: []int{503, 503, 503}, wantRetries: 2, wantErr: true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var calls int32
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				i := int(atomic.AddInt32(&calls, 1)) - 1
+				if i >= len(tt.statuses) {
+					i = len(tt.statuses) - 1
+				}
+				if tt.retryAfter != "" {
+					w.Header().Set("Retry-After", tt.retryAfter)
+				}
+				w.WriteHeader(tt.statuses[i])
+			}))
+			defer server.Close()
+
+			maxBackoff := tt.maxBackoff
+			if maxBackoff == 0 {
+				maxBackoff = 5 * time.Millisecond
+			}
+			w, err := newWriter(WriterOption{
+				Url:        server.URL,
+				MaxRetries: 2,
+				MinBackoff: time.Millisecond,
+				MaxBackoff: maxBackoff,
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			start := time.Now()
+			retries, err := w.Write(context.Background(), series)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Write() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if retries != tt.wantRetries {
+				t.Errorf("Write() retries = %d, want %d", retries, tt.wantRetries)
+			}
+			if waited := time.Since(start); waited < tt.wantWait || (tt.retryAfter != "" && waited > tt.wantWait+time.Second) {
+				t.Errorf("Write() waited %v, want %v", waited, tt.wantWait)
+			}
+		})
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	min, max := 100*time.Millisecond, time.Second
+	for attempt := 0; attempt < 10; attempt++ {
+		d := backoff(attempt, min, max)
+		if d < min/2 || d > max {
+			t.Errorf("backoff(%d) = %v, want within [%v, %v]", attempt, d, min/2, max)
+		}
+	}
+}
+
+func TestWriterOptionMatches(t *testing.T) {
+	selector, err := labels.Parse("team=a")
+	if err != nil {
+		t.Fatal(err)
+	}
+	teamA := Source{Namespace: "team-a", Name: "mysql", Labels: map[string]string{"team": "a"}}
+	teamB := Source{Namespace: "team-b", Name: "mysql", Labels: map[string]string{"team": "b"}}
+
+	tests := []struct {
+		name   string
+		opt    WriterOption
+		source Source
+		want   bool
+	}{
+		{name: "no restriction", opt: WriterOption{}, source: teamB, want: true},
+		{name: "namespace matches", opt: WriterOption{MonitorNamespaces: []string{"team-a"}}, source: teamA, want: true},
+		{name: "namespace does not match", opt: WriterOption{MonitorNamespaces: []string{"team-a"}}, source: teamB, want: false},
+		{name: "selector matches", opt: WriterOption{MonitorSelector: selector}, source: teamA, want: true},
+		{name: "selector does not match", opt: WriterOption{MonitorSelector: selector}, source: teamB, want: false},
+		{name: "self metrics always match", opt: WriterOption{MonitorSelector: selector, MonitorNamespaces: []string{"team-a"}}, source: Source{}, want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.opt.Matches(tt.source); got != tt.want {
+				t.Errorf("Matches() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -1,29 +1,28 @@
 package writer
 
 import (
+	"errors"
 	"fmt"
 	"github.com/go-logr/logr"
 	types2 "github.com/noovertime7/kubemonitor/pkg/types"
 	"log"
+	"path/filepath"
 	"sort"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/prometheus/prometheus/prompb"
 )
 
-// Writers manage all writers and metric queue
+// Writers manage all writers and their queues, every writer is a destination with its own queue
 type (
 	Writers struct {
-		writerMap map[string]Writer
-		queue     *types2.SafeListLimited[*prompb.TimeSeries]
-		logger    logr.Logger
-		batch     int
-		chanSize  int
+		destinations map[string]*destination
+		metadata     *metadataStore
+		newQueue     QueueFactory
+		logger       logr.Logger
+		batch        int
 		sync.Mutex
-
-		Snapshot
 	}
 
 	Snapshot struct {
@@ -32,76 +31,151 @@ type (
 		QueueTotalCount uint64
 		QueueSize       uint64
 
+		// WriteTotalCount and WriteFailTotal count series,
+		// WriteFailCount counts the failed pushes and WriteRetryTotal their retries
 		WriteTotalCount uint64
+		WriteFailCount  uint64
 		WriteFailTotal  uint64
+		WriteRetryTotal uint64
+
+		// DeliveredMessages and DeliveredBytes count the messages acknowledged by the brokers
+		// of the kafka destinations
+		DeliveredMessages uint64
+		DeliveredBytes    uint64
 	}
 )
 
+// addDelivered adds the deliveries of w to s.
+func (s *Snapshot) addDelivered(w Writer) {
+	messages, bytes := w.delivered()
+	s.DeliveredMessages += messages
+	s.DeliveredBytes += bytes
+}
+
 type WritersManager interface {
 	Register(name string, opt WriterOption) error
 	DeRegister(name string) error
-	WriteSamples(samples []*types2.Sample)
+	// WriteSamples queues the samples of source to the destinations matching it
+	WriteSamples(source Source, samples []*types2.Sample)
+	// Forget releases what is kept about source once its Monitor is stopped
+	Forget(source Source)
+	// QueueMetrics sums the metrics of all destinations
 	QueueMetrics() *Snapshot
+	// DestinationMetrics returns the metrics of every destination by name
+	DestinationMetrics() map[string]Snapshot
 	WriteTimeSeries(timeSeries []prompb.TimeSeries)
+	// Close stops all destinations and closes their queues
+	Close() error
 }
 
+// QueueFactory opens the queue of the destination name.
+type QueueFactory func(name string) (Queue, error)
+
+// MemoryQueues creates in-memory queues of up to maxSize series.
+func MemoryQueues(maxSize int) QueueFactory {
+	return func(name string) (Queue, error) {
+		return NewMemoryQueue(maxSize), nil
+	}
+}
+
+// WALQueues creates a WAL queue of up to maxSize bytes per destination under dir,
+// the queue of a destination is replayed when a destination of the same name is registered again,
+// e.g. after a restart, and deleted when the destination is deregistered.
+func WALQueues(dir string, maxSize int64, logger logr.Logger) QueueFactory {
+	return func(name string) (Queue, error) {
+		// namespaces and names cannot contain "_", so the directory is unique per namespaced name
+		return NewWALQueue(filepath.Join(dir, strings.ReplaceAll(name, "/", "_")), maxSize, logger.WithValues("destination", name))
+	}
+}
+
+const defaultConcurrency = 1
+
+// NewWriter creates a WritersManager buffering up to chanSize series in memory per destination.
 func NewWriter(chanSize, batch int, logger logr.Logger) WritersManager {
-	writers := &Writers{
-		chanSize:  chanSize,
-		batch:     batch,
-		logger:    logger,
-		writerMap: make(map[string]Writer),
-		queue:     types2.NewSafeListLimited[*prompb.TimeSeries](chanSize),
+	return NewWriterWithQueues(MemoryQueues(chanSize), batch, logger)
+}
+
+// NewWriterWithQueues creates a WritersManager opening the queue of every destination with newQueue,
+// batch is the default batch size of the destinations.
+func NewWriterWithQueues(newQueue QueueFactory, batch int, logger logr.Logger) WritersManager {
+	return &Writers{
+		batch:        batch,
+		logger:       logger,
+		newQueue:     newQueue,
+		metadata:     newMetadataStore(),
+		destinations: make(map[string]*destination),
 	}
-	go writers.loopRead()
-	return writers
 }
 
+// DeRegister stops the destination name and deletes its queue, the queued series are dropped.
 func (ws *Writers) DeRegister(name string) error {
 	ws.Lock()
-	defer ws.Unlock()
+	d, has := ws.destinations[name]
+	delete(ws.destinations, name)
+	ws.Unlock()
 
-	_, has := ws.writerMap[name]
-	if has {
-		delete(ws.writerMap, name)
+	if !has {
 		return nil
 	}
-	return fmt.Errorf("%s not register wirters", name)
+	err := d.stop()
+	if queue, ok := d.queue.(removableQueue); ok {
+		err = errors.Join(err, queue.Remove())
+	}
+	return err
 }
 
+// Register adds the destination name, or updates its writer keeping its queue when it exists.
 func (ws *Writers) Register(name string, opt WriterOption) error {
-	ws.Lock()
-	defer ws.Unlock()
+	if opt.Batch <= 0 {
+		opt.Batch = ws.batch
+	}
+	if opt.Concurrency <= 0 {
+		opt.Concurrency = defaultConcurrency
+	}
 
 	writer, err := newWriter(opt)
 	if err != nil {
 		return err
 	}
+	writer.metadata = ws.metadata
+
+	ws.Lock()
+	defer ws.Unlock()
+
+	if d, has := ws.destinations[name]; has {
+		d.setWriter(writer)
+		return nil
+	}
 
-	ws.writerMap[name] = writer
+	queue, err := ws.newQueue(name)
+	if err != nil {
+		return err
+	}
+	ws.destinations[name] = newDestination(name, writer, queue, ws.logger)
 
 	return nil
 }
 
-func (ws *Writers) loopRead() {
-	for {
-		series := ws.queue.PopBackN(ws.batch)
-		if len(series) == 0 {
-			time.Sleep(time.Millisecond * 400)
-			continue
-		}
-
-		items := make([]prompb.TimeSeries, len(series))
-		for i := 0; i < len(series); i++ {
-			items[i] = *series[i]
+func (ws *Writers) Close() error {
+	ws.Lock()
+	destinations := ws.destinations
+	ws.destinations = make(map[string]*destination)
+	ws.Unlock()
+
+	var errs []error
+	for _, d := range destinations {
+		if err := d.stop(); err != nil {
+			errs = append(errs, err)
 		}
-
-		ws.WriteTimeSeries(items)
 	}
+	return errors.Join(errs...)
 }
 
+// Forget is a no-op, the remote writers keep nothing per source.
+func (ws *Writers) Forget(source Source) {}
+
 // WriteSamples convert samples to []prompb.TimeSeries and batch write to queue
-func (ws *Writers) WriteSamples(samples []*types2.Sample) {
+func (ws *Writers) WriteSamples(source Source, samples []*types2.Sample) {
 	if len(samples) == 0 {
 		return
 	}
@@ -113,66 +187,69 @@ func (ws *Writers) WriteSamples(samples []*types2.Sample) {
 	//	printTestMetrics(samples)
 	//}
 
+	ws.metadata.update(samples)
+
 	items := make([]*prompb.TimeSeries, 0, len(samples))
 	for _, sample := range samples {
-		item := sample.ConvertTimeSeries("ms")
-		if item == nil || len(item.Labels) == 0 {
-			continue
-		}
-		items = append(items, item)
-	}
-	success := ws.queue.PushFrontN(items)
-	l := ws.queue.Len()
-	if !success {
-		log.Printf("E! write %d samples failed, please increase queue size(%d)", len(items), l)
+		items = append(items, sample.ConvertTimeSeries("ms")...)
 	}
-	go ws.snapshot(uint64(len(items)), uint64(l), success, "queue")
+	ws.enqueue(source, items)
 }
 
-func (ws *Writers) snapshot(count, size uint64, success bool, mode string) {
+// enqueue pushes items to the queue of every destination matching source.
+func (ws *Writers) enqueue(source Source, items []*prompb.TimeSeries) {
+	if len(items) == 0 {
+		return
+	}
+
 	ws.Lock()
 	defer ws.Unlock()
 
-	switch mode {
-	case "queue":
-		ws.QueueTotalCount += count
-		ws.QueueSize = size
-		if !success {
-			ws.QueueFailCount++
-			ws.QueueFailTotal += count
+	for name, d := range ws.destinations {
+		if !d.matches(source) {
+			continue
 		}
-	case "write":
-		ws.WriteTotalCount += count
-		if !success {
-			ws.WriteFailTotal++
+		if !d.enqueue(items) {
+			log.Printf("E! write %d samples to %s failed, please increase queue size(%d)", len(items), name, d.queue.Len())
 		}
 	}
-
 }
 
 func (ws *Writers) QueueMetrics() *Snapshot {
+	total := &Snapshot{}
+	for _, ss := range ws.DestinationMetrics() {
+		total.QueueFailCount += ss.QueueFailCount
+		total.QueueFailTotal += ss.QueueFailTotal
+		total.QueueTotalCount += ss.QueueTotalCount
+		total.QueueSize += ss.QueueSize
+		total.WriteTotalCount += ss.WriteTotalCount
+		total.WriteFailCount += ss.WriteFailCount
+		total.WriteFailTotal += ss.WriteFailTotal
+		total.WriteRetryTotal += ss.WriteRetryTotal
+		total.DeliveredMessages += ss.DeliveredMessages
+		total.DeliveredBytes += ss.DeliveredBytes
+	}
+	return total
+}
+
+func (ws *Writers) DestinationMetrics() map[string]Snapshot {
 	ws.Lock()
 	defer ws.Unlock()
-	ss := ws.Snapshot
-	return &ss
-}
 
-// WriteTimeSeries write prompb.TimeSeries to all writers
-func (ws *Writers) WriteTimeSeries(timeSeries []prompb.TimeSeries) {
-	if len(timeSeries) == 0 {
-		return
+	metrics := make(map[string]Snapshot, len(ws.destinations))
+	for name, d := range ws.destinations {
+		metrics[name] = d.metrics()
 	}
+	return metrics
+}
 
-	wg := sync.WaitGroup{}
-	for key := range ws.writerMap {
-		wg.Add(1)
-		go func(key string) {
-			defer wg.Done()
-			err := ws.writerMap[key].Write(timeSeries)
-			ws.snapshot(1, 0, err == nil, "write")
-		}(key)
+// WriteTimeSeries write prompb.TimeSeries of kubemonitor itself to the queue of all destinations
+func (ws *Writers) WriteTimeSeries(timeSeries []prompb.TimeSeries) {
+	items := make([]*prompb.TimeSeries, len(timeSeries))
+	for i := range timeSeries {
+		items[i] = &timeSeries[i]
 	}
-	wg.Wait()
+	ws.enqueue(Source{}, items)
 }
 
 func printTestMetrics(samples []*types2.Sample) {
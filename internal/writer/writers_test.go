@@ -0,0 +1,175 @@
+package writer
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/go-logr/logr"
+	"github.com/golang/protobuf/proto"
+	"github.com/golang/snappy"
+	"github.com/prometheus/prometheus/prompb"
+)
+
+func TestWritersIsolateDestinations(t *testing.T) {
+	received := make(chan struct{}, 10)
+	healthy := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		received <- struct{}{}
+	}))
+	defer healthy.Close()
+
+	block := make(chan struct{})
+	dead := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-block
+	}))
+	defer dead.Close()
+	defer close(block)
+
+	ws := NewWriter(100, 10, logr.Discard())
+	defer ws.Close()
+
+	if err := ws.Register("default/dead", WriterOption{Url: dead.URL}); err != nil {
+		t.Fatal(err)
+	}
+	if err := ws.Register("default/healthy", WriterOption{Url: healthy.URL}); err != nil {
+		t.Fatal(err)
+	}
+
+	ws.WriteTimeSeries([]prompb.TimeSeries{{
+		Labels:  []prompb.Label{{Name: "__name__", Value: "up"}},
+		Samples: []prompb.Sample{{Value: 1, Timestamp: time.Now().UnixMilli()}},
+	}})
+
+	select {
+	case <-received:
+	case <-time.After(5 * time.Second):
+		t.Fatal("the healthy destination was blocked by the dead one")
+	}
+
+	metrics := ws.DestinationMetrics()
+	if metrics["default/healthy"].QueueTotalCount != 1 || metrics["default/dead"].QueueTotalCount != 1 {
+		t.Errorf("DestinationMetrics() = %+v, want one queued series per destination", metrics)
+	}
+}
+
+func TestDestinationResendsFailedBatchesOnly(t *testing.T) {
+	var (
+		lock     sync.Mutex
+		received = map[string]int{}
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		data, err := snappy.Decode(nil, body)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		var req prompb.WriteRequest
+		if err := proto.Unmarshal(data, &req); err != nil {
+			t.Error(err)
+			return
+		}
+
+		lock.Lock()
+		defer lock.Unlock()
+		for _, ts := range req.Timeseries {
+			name := ts.Labels[0].Value
+			received[name]++
+			if name == "b" && received[name] == 1 {
+				w.WriteHeader(http.StatusServiceUnavailable)
+			}
+		}
+	}))
+	defer server.Close()
+
+	ws := NewWriter(100, 10, logr.Discard())
+	defer ws.Close()
+	if err := ws.Register("default/remote", WriterOption{Url: server.URL, Batch: 1, Concurrency: 2, MaxRetries: -1}); err != nil {
+		t.Fatal(err)
+	}
+
+	now := time.Now().UnixMilli()
+	ws.WriteTimeSeries([]prompb.TimeSeries{
+		{Labels: []prompb.Label{{Name: "__name__", Value: "a"}}, Samples: []prompb.Sample{{Value: 1, Timestamp: now}}},
+		{Labels: []prompb.Label{{Name: "__name__", Value: "b"}}, Samples: []prompb.Sample{{Value: 1, Timestamp: now}}},
+	})
+
+	deadline := time.Now().Add(5 * time.Second)
+	for ws.DestinationMetrics()["default/remote"].WriteTotalCount < 2 && time.Now().Before(deadline) {
+		time.Sleep(50 * time.Millisecond)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if received["a"] != 1 || received["b"] != 2 {
+		t.Errorf("received = %v, want the accepted batch once and the failed one retried", received)
+	}
+	if metrics := ws.DestinationMetrics()["default/remote"]; metrics.WriteTotalCount != 2 || metrics.WriteFailTotal != 1 {
+		t.Errorf("DestinationMetrics() = %+v, want 2 series written and 1 failed", metrics)
+	}
+}
+
+// blockingClient holds every send until release is closed, it fails the sends made once closed.
+type blockingClient struct {
+	sending chan struct{}
+	release chan struct{}
+	closed  atomic.Bool
+	failed  atomic.Bool
+}
+
+func (c *blockingClient) send(ctx context.Context, items []prompb.TimeSeries, metadata []prompb.MetricMetadata) error {
+	select {
+	case c.sending <- struct{}{}:
+	default:
+	}
+	<-c.release
+	if c.closed.Load() {
+		c.failed.Store(true)
+		return errors.New("send on closed client")
+	}
+	return nil
+}
+
+func (c *blockingClient) Close() error {
+	c.closed.Store(true)
+	return nil
+}
+
+func TestDestinationClosesReplacedWriterAfterSend(t *testing.T) {
+	old := &blockingClient{sending: make(chan struct{}, 1), release: make(chan struct{})}
+	replacement := &blockingClient{sending: make(chan struct{}, 1), release: make(chan struct{})}
+	close(replacement.release)
+	opts := WriterOption{Batch: 1, Concurrency: 1, MaxRetries: -1}
+
+	queue := NewMemoryQueue(10)
+	queue.Push([]*prompb.TimeSeries{{Labels: []prompb.Label{{Name: "__name__", Value: "a"}}}})
+	d := newDestination("default/remote", Writer{Opts: opts, client: old}, queue, logr.Discard())
+	defer d.stop()
+
+	<-old.sending
+	d.setWriter(Writer{Opts: opts, client: replacement})
+	if old.closed.Load() {
+		t.Error("replaced writer closed while sending")
+	}
+	close(old.release)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for !old.closed.Load() && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if !old.closed.Load() {
+		t.Error("replaced writer not closed after its send")
+	}
+	if old.failed.Load() {
+		t.Error("in-flight send failed on the closed writer")
+	}
+	if metrics := d.metrics(); metrics.WriteTotalCount != 1 {
+		t.Errorf("metrics() = %+v, want the in-flight series written", metrics)
+	}
+}
@@ -0,0 +1,51 @@
+package input
+
+import (
+	"context"
+	"sync"
+
+	"github.com/noovertime7/kubemonitor/pkg/types"
+)
+
+// Handler is a HandlerFactory instance owned by a single Monitor, together
+// with the sample buffer it gathers into.
+type Handler struct {
+	model   string
+	factory HandlerFactory
+	slist   *types.SampleList
+	lock    sync.Mutex
+}
+
+func newHandler(model string, factory HandlerFactory) *Handler {
+	return &Handler{
+		model:   model,
+		factory: factory,
+		slist:   types.NewSampleList(),
+	}
+}
+
+func (h *Handler) Model() string {
+	return h.model
+}
+
+// Gather runs the handler once and returns the samples collected by this run.
+// Samples pushed before a failure (e.g. up=0) are returned along with the error.
+// The run is abandoned once ctx is done, on the gather timeout or when the monitor is stopped.
+func (h *Handler) Gather(ctx context.Context) (*types.SampleList, error) {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	err := h.factory.Gather(ctx, h.slist)
+
+	list := types.NewSampleList()
+	list.PushFrontN(h.slist.PopBackAll())
+	return list, err
+}
+
+// Drop releases the connections held by the handler.
+func (h *Handler) Drop() {
+	h.lock.Lock()
+	defer h.lock.Unlock()
+
+	h.factory.Drop()
+}
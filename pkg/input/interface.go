@@ -1,9 +1,15 @@
 package input
 
-import "github.com/noovertime7/kubemonitor/pkg/types"
+import (
+	"context"
+
+	"github.com/noovertime7/kubemonitor/pkg/types"
+)
 
 type HandlerFactory interface {
 	Name() string
 	Init(config ConfigMap) error
-	Gather(slist *types.SampleList) error
+	// Gather pushes the samples of one run into slist, it must return once ctx is done
+	Gather(ctx context.Context, slist *types.SampleList) error
+	Drop()
 }
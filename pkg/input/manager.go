@@ -2,85 +2,70 @@ package input
 
 import (
 	"fmt"
-	"github.com/noovertime7/kubemonitor/pkg/types"
+	"sort"
 	"sync"
 )
 
-var Factory = NewHandlerFactory()
+var Factory = NewRegistry()
 
-type SharedHandlerFactory struct {
-	RootList     map[string]*types.SampleList
-	lock         *sync.Mutex
-	handlers     []HandlerFactory
-	supportModel map[string]HandlerFactory
-}
+// Creator returns a new, not yet initialized HandlerFactory for a model.
+type Creator func() HandlerFactory
 
-func NewHandlerFactory() *SharedHandlerFactory {
-	return &SharedHandlerFactory{
-		RootList:     make(map[string]*types.SampleList),
-		handlers:     []HandlerFactory{},
-		supportModel: make(map[string]HandlerFactory),
-		lock:         &sync.Mutex{},
-	}
+// Registry keeps one Creator per supported model. Handlers register their
+// constructor in init() and every Monitor gets its own instance from New, so
+// monitors of the same model never share config or sample buffers.
+type Registry struct {
+	lock     sync.RWMutex
+	creators map[string]Creator
 }
 
-func (m *SharedHandlerFactory) Gather(model string) error {
-	handler, ok := m.supportModel[model]
-	if !ok {
-		return fmt.Errorf("%s not supported", model)
-	}
-	list, ok := m.RootList[model]
-	if !ok {
-		return fmt.Errorf("%s data list not found", model)
+func NewRegistry() *Registry {
+	return &Registry{
+		creators: make(map[string]Creator),
 	}
-	return handler.Gather(list)
 }
 
-func (m *SharedHandlerFactory) GetHandler(model string) (HandlerFactory, error) {
-	handler, ok := m.supportModel[model]
-	if !ok {
-		return nil, fmt.Errorf("%s not register", model)
-	}
-	return handler, nil
-}
+func (r *Registry) Register(model string, creator Creator) {
+	r.lock.Lock()
+	defer r.lock.Unlock()
 
-func (m *SharedHandlerFactory) InitConfig(model string, cfg map[string]string) error {
-	handler, ok := m.supportModel[model]
-	if !ok {
-		return fmt.Errorf("%s not register", model)
-	}
-	return handler.Init(cfg)
+	r.creators[model] = creator
 }
 
-func (m *SharedHandlerFactory) InitConfigWithGather(model string, cfg map[string]string) error {
-	err := m.InitConfig(model, cfg)
-	if err != nil {
-		return err
-	}
-	return m.Gather(model)
+func (r *Registry) Supported(model string) bool {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
+
+	_, ok := r.creators[model]
+	return ok
 }
 
-func (m *SharedHandlerFactory) RegisterHandler(handler HandlerFactory) {
-	m.lock.Lock()
-	defer m.lock.Unlock()
+func (r *Registry) Models() []string {
+	r.lock.RLock()
+	defer r.lock.RUnlock()
 
-	m.handlers = append(m.handlers, handler)
-	m.supportModel[handler.Name()] = handler
-	m.RootList[handler.Name()] = types.NewSampleList()
+	models := make([]string, 0, len(r.creators))
+	for model := range r.creators {
+		models = append(models, model)
+	}
+	sort.Strings(models)
+	return models
 }
 
-func (m *SharedHandlerFactory) PopBackAll(model string) ([]*types.Sample, error) {
-	list, ok := m.RootList[model]
+// New creates a handler instance of model and initializes it with cfg.
+func (r *Registry) New(model string, cfg ConfigMap) (*Handler, error) {
+	r.lock.RLock()
+	creator, ok := r.creators[model]
+	r.lock.RUnlock()
 	if !ok {
-		return nil, fmt.Errorf("%s data list not found", model)
+		return nil, fmt.Errorf("%s not register", model)
 	}
-	return list.PopBackAll(), nil
-}
 
-func (m *SharedHandlerFactory) List(model string) (*types.SampleList, error) {
-	list, ok := m.RootList[model]
-	if !ok {
-		return nil, fmt.Errorf("%s data list not found", model)
+	factory := creator()
+	if err := factory.Init(cfg); err != nil {
+		factory.Drop()
+		return nil, err
 	}
-	return list, nil
+
+	return newHandler(model, factory), nil
 }
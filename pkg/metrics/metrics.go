@@ -5,6 +5,7 @@ import (
 	"github.com/noovertime7/kubemonitor/internal/writer"
 	"github.com/noovertime7/kubemonitor/pkg/process"
 	"github.com/noovertime7/kubemonitor/pkg/types"
+	"github.com/noovertime7/kubemonitor/pkg/worker"
 	"time"
 )
 
@@ -21,15 +22,28 @@ const (
 	metricQueueSize        = "current_queue_size"
 	metricsWriteTotal      = "write_total"
 	metricsWriteFailTotal  = "write_fail_total"
+	metricsWriteFailCount  = "write_fail_count"
+	metricsWriteRetryTotal = "write_retry_total"
+	metricDeliveredMsgs    = "delivered_messages_total"
+	metricDeliveredBytes   = "delivered_bytes_total"
+	metricDroppedSeries    = "series_limit_dropped_total"
+
+	metricSchedulerRuns    = "scheduler_runs_total"
+	metricSchedulerSkipped = "scheduler_skipped_total"
+	metricSchedulerLag     = "scheduler_lag_seconds"
+	metricSchedulerRunning = "scheduler_running"
+
+	metricDestinationPrefix = "destination_"
 )
 
 type KubeMonitor struct {
 	w      writer.WritersManager
+	wk     worker.Worker
 	logger logr.Logger
 }
 
-func NewKubeMonitor(w writer.WritersManager, logger logr.Logger) *KubeMonitor {
-	k := &KubeMonitor{w: w, logger: logger}
+func NewKubeMonitor(w writer.WritersManager, wk worker.Worker, logger logr.Logger) *KubeMonitor {
+	k := &KubeMonitor{w: w, wk: wk, logger: logger}
 	return k
 }
 
@@ -43,7 +57,7 @@ func (k *KubeMonitor) Run(stopCh <-chan struct{}) {
 				k.collectMetrics(sList)
 				processList := process.Process(sList, map[string]string{"source": "kubemonitor"})
 				arr := processList.PopBackAll()
-				k.w.WriteSamples(arr)
+				k.w.WriteSamples(writer.Source{}, arr)
 				k.logger.Info("kubeMonitor write samples success")
 			case <-stopCh:
 				k.logger.Info("kubemonitor metrics stop...")
@@ -62,4 +76,36 @@ func (k *KubeMonitor) collectMetrics(sList *types.SampleList) {
 	sList.PushSample(metricPrefix, metricQueueSize, ss.QueueSize)
 	sList.PushSample(metricPrefix, metricsWriteTotal, ss.WriteTotalCount)
 	sList.PushSample(metricPrefix, metricsWriteFailTotal, ss.WriteFailTotal)
+	sList.PushSample(metricPrefix, metricsWriteFailCount, ss.WriteFailCount)
+	sList.PushSample(metricPrefix, metricsWriteRetryTotal, ss.WriteRetryTotal)
+	sList.PushSample(metricPrefix, metricDeliveredMsgs, ss.DeliveredMessages)
+	sList.PushSample(metricPrefix, metricDeliveredBytes, ss.DeliveredBytes)
+
+	for name, ss := range k.w.DestinationMetrics() {
+		labels := map[string]string{"destination": name}
+		sList.PushSample(metricPrefix, metricDestinationPrefix+metricEnqueueSum, ss.QueueTotalCount, labels)
+		sList.PushSample(metricPrefix, metricDestinationPrefix+metricEnqueueFailedSum, ss.QueueFailTotal, labels)
+		sList.PushSample(metricPrefix, metricDestinationPrefix+metricQueueSize, ss.QueueSize, labels)
+		sList.PushSample(metricPrefix, metricDestinationPrefix+metricsWriteTotal, ss.WriteTotalCount, labels)
+		sList.PushSample(metricPrefix, metricDestinationPrefix+metricsWriteFailTotal, ss.WriteFailTotal, labels)
+		sList.PushSample(metricPrefix, metricDestinationPrefix+metricsWriteRetryTotal, ss.WriteRetryTotal, labels)
+		sList.PushSample(metricPrefix, metricDestinationPrefix+metricDeliveredMsgs, ss.DeliveredMessages, labels)
+		sList.PushSample(metricPrefix, metricDestinationPrefix+metricDeliveredBytes, ss.DeliveredBytes, labels)
+	}
+
+	for name, dropped := range process.DroppedSeries() {
+		sList.PushSample(metricPrefix, metricDroppedSeries, dropped, map[string]string{"monitor": name})
+	}
+
+	for name, stats := range k.wk.Stats() {
+		labels := map[string]string{"task": name, "model": stats.Model}
+		running := 0
+		if stats.Running {
+			running = 1
+		}
+		sList.PushSample(metricPrefix, metricSchedulerRuns, stats.Runs, labels)
+		sList.PushSample(metricPrefix, metricSchedulerSkipped, stats.Skipped, labels)
+		sList.PushSample(metricPrefix, metricSchedulerLag, stats.LastLag.Seconds(), labels)
+		sList.PushSample(metricPrefix, metricSchedulerRunning, running, labels)
+	}
 }
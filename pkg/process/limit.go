@@ -0,0 +1,213 @@
+package process
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/prometheus/common/model"
+	promlabels "github.com/prometheus/prometheus/model/labels"
+
+	"github.com/noovertime7/kubemonitor/pkg/types"
+)
+
+// droppedSeries holds the *atomic.Uint64 count of the series dropped over the limit, by processor name
+var droppedSeries sync.Map
+
+// DroppedSeries returns the count of the series dropped over the series limit, by processor name.
+func DroppedSeries() map[string]uint64 {
+	out := map[string]uint64{}
+	droppedSeries.Range(func(key, value any) bool {
+		out[key.(string)] = value.(*atomic.Uint64).Load()
+		return true
+	})
+	return out
+}
+
+// ForgetDroppedSeries removes the dropped series count of a processor that is gone.
+func ForgetDroppedSeries(name string) {
+	droppedSeries.Delete(name)
+}
+
+func addDroppedSeries(name string, n int) {
+	counter, _ := droppedSeries.LoadOrStore(name, &atomic.Uint64{})
+	counter.(*atomic.Uint64).Add(uint64(n))
+}
+
+// SeriesBudget caps the series written by the last gathers of all the processors sharing it.
+// The series the other processors already write are kept first, so that the processor growing
+// is the one limited, the way a seriesLimiter drops the newest series.
+type SeriesBudget struct {
+	limit int
+
+	lock sync.Mutex
+	// used is the count of series of the last gather of every processor, by name
+	used  map[string]int
+	total int
+}
+
+// NewSeriesBudget returns a budget of limit series, nil when limit is not positive.
+func NewSeriesBudget(limit int) *SeriesBudget {
+	if limit <= 0 {
+		return nil
+	}
+	return &SeriesBudget{limit: limit, used: map[string]int{}}
+}
+
+// take returns how many of the want series the processor name can write, and reserves them.
+func (b *SeriesBudget) take(name string, want int) int {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+
+	free := b.limit - (b.total - b.used[name])
+	if free < 0 {
+		free = 0
+	}
+	if want > free {
+		want = free
+	}
+	b.setLocked(name, want)
+	return want
+}
+
+// set records the series written by the last gather of the processor name.
+func (b *SeriesBudget) set(name string, n int) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.setLocked(name, n)
+}
+
+func (b *SeriesBudget) setLocked(name string, n int) {
+	b.total += n - b.used[name]
+	b.used[name] = n
+}
+
+// release returns the series of the processor name to the budget.
+func (b *SeriesBudget) release(name string) {
+	b.lock.Lock()
+	defer b.lock.Unlock()
+	b.total -= b.used[name]
+	delete(b.used, name)
+}
+
+// seriesLimiter keeps at most limit series per gather, and no more than its share of budget,
+// and drops the newest ones: the series kept by the previous gather are admitted first, so that
+// a burst of new series cannot push out the series already written. A histogram or a summary
+// sample counts as every series it is written as.
+type seriesLimiter struct {
+	// limit is 0 when only budget limits the series
+	limit  int
+	budget *SeriesBudget
+	name   string
+
+	lock     sync.Mutex
+	admitted map[uint64]struct{}
+	// limited is the count of series dropped by the last gather, applied the limit it was held to
+	limited int
+	applied int
+}
+
+func newSeriesLimiter(limit int, budget *SeriesBudget, name string) *seriesLimiter {
+	if limit <= 0 && budget == nil {
+		return nil
+	}
+	if limit < 0 {
+		limit = 0
+	}
+	return &seriesLimiter{limit: limit, budget: budget, name: name, admitted: map[uint64]struct{}{}}
+}
+
+// apply returns the samples of ss within the limit and the count of series dropped.
+func (l *seriesLimiter) apply(ss []*types.Sample) ([]*types.Sample, int) {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+
+	var (
+		hashes = make([]uint64, len(ss))
+		counts = make([]int, len(ss))
+		total  int
+	)
+	for i, s := range ss {
+		hashes[i] = seriesHash(s)
+		counts[i] = s.SeriesCount()
+		total += counts[i]
+	}
+
+	limit := l.limit
+	if l.budget != nil {
+		want := total
+		if limit > 0 && want > limit {
+			want = limit
+		}
+		limit = l.budget.take(l.name, want)
+	}
+
+	var (
+		admitted = make(map[uint64]struct{}, len(l.admitted))
+		used     int
+	)
+	admit := func(i int) bool {
+		if _, has := admitted[hashes[i]]; has {
+			return true
+		}
+		if used+counts[i] > limit {
+			return false
+		}
+		admitted[hashes[i]] = struct{}{}
+		used += counts[i]
+		return true
+	}
+	for i := range ss {
+		if _, has := l.admitted[hashes[i]]; has {
+			admit(i)
+		}
+	}
+
+	kept := ss[:0]
+	dropped := map[uint64]int{}
+	for i, s := range ss {
+		if !admit(i) {
+			dropped[hashes[i]] = counts[i]
+			continue
+		}
+		kept = append(kept, s)
+	}
+	if l.budget != nil {
+		l.budget.set(l.name, used)
+	}
+
+	l.admitted = admitted
+	l.limited = 0
+	for _, n := range dropped {
+		l.limited += n
+	}
+	l.applied = limit
+	return kept, l.limited
+}
+
+func (l *seriesLimiter) lastLimited() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	return l.limited
+}
+
+func (l *seriesLimiter) lastLimit() int {
+	l.lock.Lock()
+	defer l.lock.Unlock()
+	if l.applied == 0 && l.budget == nil {
+		return l.limit
+	}
+	return l.applied
+}
+
+// release returns the series of the limiter to its budget.
+func (l *seriesLimiter) release() {
+	if l.budget != nil {
+		l.budget.release(l.name)
+	}
+}
+
+func seriesHash(s *types.Sample) uint64 {
+	lb := promlabels.NewBuilder(promlabels.FromMap(s.Labels))
+	lb.Set(model.MetricNameLabel, s.Metric)
+	return lb.Labels().Hash()
+}
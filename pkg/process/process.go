@@ -1,48 +1,115 @@
 package process
 
 import (
+	"fmt"
 	"github.com/noovertime7/kubemonitor/internal/labels"
+	"github.com/noovertime7/kubemonitor/pkg/filter"
 	"github.com/noovertime7/kubemonitor/pkg/types"
+	"strings"
 	"time"
+
+	"github.com/prometheus/common/model"
+	promlabels "github.com/prometheus/prometheus/model/labels"
+	"github.com/prometheus/prometheus/model/relabel"
 )
 
+// Options configures the Processor of a monitor.
+type Options struct {
+	// AdditionalLabels are added to the samples not having them yet
+	AdditionalLabels map[string]string
+	// RelabelConfigs relabel AdditionalLabels once, as the target labels of the monitor
+	RelabelConfigs []*relabel.Config
+	// MetricRelabelConfigs relabel every sample, with the metric name as __name__
+	MetricRelabelConfigs []*relabel.Config
+	// MetricsFilter drops the samples whose metric name it does not match
+	MetricsFilter filter.Filter
+	// ValueMappings replace the values of the matching metrics, e.g. "green" by 0
+	ValueMappings []ValueMapping
+	// SeriesLimit is the max number of series written per gather, 0 is unlimited
+	SeriesLimit int
+	// SeriesBudget, when set, caps the series written along with the other processors sharing it
+	SeriesBudget *SeriesBudget
+	// Name names the processor in the dropped series self-metrics, e.g. the monitor namespace/name
+	Name string
+}
+
+// ValueMapping maps the values of the metrics Metrics matches, values not in Mappings are kept.
+type ValueMapping struct {
+	Metrics  filter.Filter
+	Mappings map[string]float64
+}
+
+// Processor turns the samples gathered by a monitor into the samples written,
+// it is built once per monitor so that the relabeling of the target labels is not repeated.
+type Processor struct {
+	additionalLabels     map[string]string
+	metricRelabelConfigs []*relabel.Config
+	metricsFilter        filter.Filter
+	valueMappings        []ValueMapping
+	limiter              *seriesLimiter
+	name                 string
+	// dropped is true when RelabelConfigs dropped the target, no sample is written then
+	dropped bool
+}
+
+func NewProcessor(opts Options) *Processor {
+	additionalLabels, keep := relabelTarget(opts.AdditionalLabels, opts.RelabelConfigs)
+	return &Processor{
+		additionalLabels:     additionalLabels,
+		metricRelabelConfigs: opts.MetricRelabelConfigs,
+		metricsFilter:        opts.MetricsFilter,
+		valueMappings:        opts.ValueMappings,
+		limiter:              newSeriesLimiter(opts.SeriesLimit, opts.SeriesBudget, opts.Name),
+		name:                 opts.Name,
+		dropped:              !keep,
+	}
+}
+
+// Process processes slist with the additional labels only.
 func Process(slist *types.SampleList, additionalLabels map[string]string) *types.SampleList {
+	return NewProcessor(Options{AdditionalLabels: additionalLabels}).Process(slist)
+}
+
+func (p *Processor) Process(slist *types.SampleList) *types.SampleList {
 	nlst := types.NewSampleList()
 	if slist.Len() == 0 {
 		return nlst
 	}
+	if p.dropped {
+		slist.PopBackAll()
+		return nlst
+	}
+	additionalLabels := p.additionalLabels
 
 	now := time.Now()
 	ss := slist.PopBackAll()
+	out := make([]*types.Sample, 0, len(ss))
 
 	for i := range ss {
 		if ss[i] == nil {
 			continue
 		}
-		//
-		//// drop metrics
-		//if ic.MetricsDropFilter != nil {
-		//	if ic.MetricsDropFilter.Match(ss[i].Metric) {
-		//		continue
-		//	}
-		//}
-		//
-		//// pass metrics
-		//if ic.MetricsPassFilter != nil {
-		//	if !ic.MetricsPassFilter.Match(ss[i].Metric) {
-		//		continue
-		//	}
-		//}
-		//
-		//// mapping values
-		//for j := 0; j < len(ic.ProcessorEnum); j++ {
-		//	if ic.ProcessorEnum[j].MetricsFilter.Match(ss[i].Metric) {
-		//		v, has := ic.ProcessorEnum[j].ValueMappings[fmt.Sprint(ss[i].Value)]
-		//		if has {
-		//			ss[i].Value = v
-		//		}
-		//	}
-		//}
+
+		// include and exclude metrics
+		if p.metricsFilter != nil && !p.metricsFilter.Match(ss[i].Metric) {
+			continue
+		}
+
+		// mapping values
+		for j := range p.valueMappings {
+			if p.valueMappings[j].Metrics.Match(ss[i].Metric) {
+				v, has := p.valueMappings[j].Mappings[fmt.Sprint(ss[i].Value)]
+				if has {
+					ss[i].Value = v
+				}
+			}
+		}
+
+		// a string value no mapping turned into a number is never written, it is dropped here so
+		// that it does not count toward the series limit
+		if !writable(ss[i].Value) {
+			continue
+		}
 
 		if ss[i].Timestamp.IsZero() {
 			ss[i].Timestamp = now
@@ -83,6 +150,10 @@ func Process(slist *types.SampleList, additionalLabels map[string]string) *types
 			ss[i].Labels["address"] = val
 		}
 
+		if len(p.metricRelabelConfigs) > 0 && !relabelSample(ss[i], p.metricRelabelConfigs) {
+			continue
+		}
+
 		//
 		//// add label: agent_hostname
 		//if _, has := ss[i].Labels[agentHostnameLabelKey]; !has {
@@ -91,8 +162,97 @@ func Process(slist *types.SampleList, additionalLabels map[string]string) *types
 		//	}
 		//}
 
-		nlst.PushFront(ss[i])
+		out = append(out, ss[i])
+	}
+
+	if p.limiter != nil {
+		var limited int
+		out, limited = p.limiter.apply(out)
+		if limited > 0 {
+			addDroppedSeries(p.name, limited)
+		}
+	}
+	for i := range out {
+		nlst.PushFront(out[i])
 	}
 
 	return nlst
 }
+
+// LimitedSeries returns the number of series the last Process dropped over the series limit.
+func (p *Processor) LimitedSeries() int {
+	if p.limiter == nil {
+		return 0
+	}
+	return p.limiter.lastLimited()
+}
+
+// SeriesLimit returns the series limit the last Process applied, its own or its share of the
+// series budget, 0 when unlimited.
+func (p *Processor) SeriesLimit() int {
+	if p.limiter == nil {
+		return 0
+	}
+	return p.limiter.lastLimit()
+}
+
+// Release returns the series of the processor to the series budget once it is no longer used.
+func (p *Processor) Release() {
+	if p.limiter != nil {
+		p.limiter.release()
+	}
+}
+
+// relabelTarget relabels the target labels, dropping the labels starting with "__" afterwards.
+func relabelTarget(target map[string]string, cfgs []*relabel.Config) (map[string]string, bool) {
+	if len(cfgs) == 0 {
+		return target, true
+	}
+
+	lbls, keep := relabel.Process(promlabels.FromMap(target), cfgs...)
+	if !keep {
+		return nil, false
+	}
+
+	relabeled := make(map[string]string, lbls.Len())
+	lbls.Range(func(l promlabels.Label) {
+		if !strings.HasPrefix(l.Name, model.ReservedLabelPrefix) {
+			relabeled[l.Name] = l.Value
+		}
+	})
+	return relabeled, true
+}
+
+// relabelSample relabels the labels and name of s, it returns false when s is dropped.
+func relabelSample(s *types.Sample, cfgs []*relabel.Config) bool {
+	lb := promlabels.NewBuilder(promlabels.FromMap(s.Labels))
+	lb.Set(model.MetricNameLabel, s.Metric)
+	if !relabel.ProcessBuilder(lb, cfgs...) {
+		return false
+	}
+
+	lbls := lb.Labels()
+	name := lbls.Get(model.MetricNameLabel)
+	if name == "" {
+		return false
+	}
+
+	s.Metric = name
+	s.Labels = make(map[string]string, lbls.Len())
+	lbls.Range(func(l promlabels.Label) {
+		if l.Name != model.MetricNameLabel {
+			s.Labels[l.Name] = l.Value
+		}
+	})
+	return true
+}
+
+// writable reports whether value is a distribution or converts to a number.
+func writable(value interface{}) bool {
+	switch value.(type) {
+	case *types.HistogramValue, *types.SummaryValue:
+		return true
+	}
+	_, err := types.ToFloat64(value)
+	return err == nil
+}
@@ -0,0 +1,204 @@
+package process
+
+import (
+	"math"
+	"testing"
+
+	"github.com/prometheus/common/model"
+	"github.com/prometheus/prometheus/model/relabel"
+
+	"github.com/noovertime7/kubemonitor/pkg/filter"
+	"github.com/noovertime7/kubemonitor/pkg/types"
+)
+
+func TestProcessorRelabel(t *testing.T) {
+	labelmap := relabel.DefaultRelabelConfig
+	labelmap.Action = relabel.LabelMap
+	labelmap.Regex = relabel.MustNewRegexp("__meta_(.+)")
+
+	dropMetric := relabel.DefaultRelabelConfig
+	dropMetric.Action = relabel.Drop
+	dropMetric.SourceLabels = []model.LabelName{model.MetricNameLabel}
+	dropMetric.Regex = relabel.MustNewRegexp("mysql_uptime")
+
+	rename := relabel.DefaultRelabelConfig
+	rename.SourceLabels = []model.LabelName{model.MetricNameLabel}
+	rename.Regex = relabel.MustNewRegexp("mysql_(.*)")
+	rename.TargetLabel = model.MetricNameLabel
+	rename.Replacement = "db_$1"
+
+	p := NewProcessor(Options{
+		AdditionalLabels:     map[string]string{"__meta_team": "a", "monitor_name": "mysql"},
+		RelabelConfigs:       []*relabel.Config{&labelmap},
+		MetricRelabelConfigs: []*relabel.Config{&dropMetric, &rename},
+	})
+
+	slist := types.NewSampleList()
+	slist.PushSample("mysql", "up", 1)
+	slist.PushSample("mysql", "uptime", 10)
+
+	out := p.Process(slist).PopBackAll()
+	if len(out) != 1 {
+		t.Fatalf("Process() returned %d samples, want 1", len(out))
+	}
+	s := out[0]
+	if s.Metric != "db_up" {
+		t.Errorf("Metric = %q, want db_up", s.Metric)
+	}
+	if s.Labels["team"] != "a" || s.Labels["monitor_name"] != "mysql" {
+		t.Errorf("Labels = %v, want team and monitor_name", s.Labels)
+	}
+	if _, has := s.Labels["__meta_team"]; has {
+		t.Errorf("Labels = %v, want __meta_team removed", s.Labels)
+	}
+}
+
+func TestProcessorDropTarget(t *testing.T) {
+	keep := relabel.DefaultRelabelConfig
+	keep.Action = relabel.Keep
+	keep.SourceLabels = []model.LabelName{"monitor_namespace"}
+	keep.Regex = relabel.MustNewRegexp("team-a")
+
+	p := NewProcessor(Options{
+		AdditionalLabels: map[string]string{"monitor_namespace": "team-b"},
+		RelabelConfigs:   []*relabel.Config{&keep},
+	})
+
+	slist := types.NewSampleList()
+	slist.PushSample("mysql", "up", 1)
+	if n := p.Process(slist).Len(); n != 0 {
+		t.Errorf("Process() returned %d samples for a dropped target, want 0", n)
+	}
+}
+
+func TestProcessorMetricsFilter(t *testing.T) {
+	metricsFilter, err := filter.NewIncludeExcludeFilter(nil, []string{"mysql_global_variables_*"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewProcessor(Options{MetricsFilter: metricsFilter})
+
+	slist := types.NewSampleList()
+	slist.PushSample("mysql", "up", 1)
+	slist.PushSample("mysql", "global_variables_max_connections", 151)
+
+	out := p.Process(slist).PopBackAll()
+	if len(out) != 1 || out[0].Metric != "mysql_up" {
+		t.Fatalf("Process() = %v, want only mysql_up", out)
+	}
+}
+
+func TestProcessorValueMappings(t *testing.T) {
+	metrics, err := filter.Compile([]string{"elasticsearch_cluster_health_status"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p := NewProcessor(Options{ValueMappings: []ValueMapping{{
+		Metrics:  metrics,
+		Mappings: map[string]float64{"green": 0, "yellow": 1, "red": 2},
+	}}})
+
+	slist := types.NewSampleList()
+	slist.PushSample("elasticsearch", "cluster_health_status", "yellow")
+	slist.PushSample("elasticsearch", "cluster_health_indices_status", "yellow")
+
+	slist.PushSample("elasticsearch", "cluster_health_number_of_nodes", "3")
+
+	out := p.Process(slist).PopBackAll()
+	if len(out) != 2 {
+		t.Fatalf("Process() returned %d samples, want the unmapped string dropped", len(out))
+	}
+	for _, s := range out {
+		switch s.Metric {
+		case "elasticsearch_cluster_health_status":
+			if s.Value != float64(1) {
+				t.Errorf("cluster_health_status = %v, want 1", s.Value)
+			}
+		case "elasticsearch_cluster_health_indices_status":
+			t.Errorf("cluster_health_indices_status = %v, want it dropped without mapping", s.Value)
+		}
+	}
+}
+
+func TestProcessorSeriesLimit(t *testing.T) {
+	p := NewProcessor(Options{SeriesLimit: 2, Name: "default/limited"})
+
+	slist := types.NewSampleList()
+	slist.PushSample("es", "docs", 1, map[string]string{"index": "a"})
+	slist.PushSample("es", "docs", 1, map[string]string{"index": "b"})
+	if n := p.Process(slist).Len(); n != 2 || p.LimitedSeries() != 0 {
+		t.Fatalf("Process() = %d samples, %d limited, want 2 and 0", n, p.LimitedSeries())
+	}
+
+	// the new series are dropped, the series of the previous gather are kept
+	slist = types.NewSampleList()
+	slist.PushSample("es", "docs", 1, map[string]string{"index": "c"})
+	slist.PushSample("es", "docs", 1, map[string]string{"index": "b"})
+	slist.PushSample("es", "docs", 1, map[string]string{"index": "a"})
+	out := p.Process(slist).PopBackAll()
+	if len(out) != 2 || p.LimitedSeries() != 1 {
+		t.Fatalf("Process() = %d samples, %d limited, want 2 and 1", len(out), p.LimitedSeries())
+	}
+	for _, s := range out {
+		if s.Labels["index"] == "c" {
+			t.Errorf("Process() kept the newest series %v", s.Labels)
+		}
+	}
+	if dropped := DroppedSeries()["default/limited"]; dropped != 1 {
+		t.Errorf("DroppedSeries() = %d, want 1", dropped)
+	}
+}
+
+func TestProcessorSeriesBudget(t *testing.T) {
+	budget := NewSeriesBudget(3)
+	first := NewProcessor(Options{SeriesBudget: budget, Name: "default/first"})
+	second := NewProcessor(Options{SeriesBudget: budget, Name: "default/second"})
+
+	gather := func(p *Processor, indices ...string) int {
+		slist := types.NewSampleList()
+		for _, index := range indices {
+			slist.PushSample("es", "docs", 1, map[string]string{"index": index})
+		}
+		return p.Process(slist).Len()
+	}
+
+	if n := gather(first, "a", "b"); n != 2 {
+		t.Fatalf("first Process() = %d samples, want 2", n)
+	}
+	// the series of the first processor are kept, the second one grows past the budget
+	if n := gather(second, "c", "d"); n != 1 || second.LimitedSeries() != 1 || second.SeriesLimit() != 1 {
+		t.Fatalf("second Process() = %d samples, %d limited over %d, want 1, 1 over 1", n, second.LimitedSeries(), second.SeriesLimit())
+	}
+	if dropped := DroppedSeries()["default/second"]; dropped != 1 {
+		t.Errorf("DroppedSeries() = %d, want the budget drops counted", dropped)
+	}
+
+	first.Release()
+	if n := gather(second, "c", "d"); n != 2 || second.LimitedSeries() != 0 {
+		t.Errorf("Process() after Release() = %d samples, %d limited, want 2 and 0", n, second.LimitedSeries())
+	}
+}
+
+func TestProcessorSeriesLimitCountsDistributions(t *testing.T) {
+	p := NewProcessor(Options{SeriesLimit: 5, Name: "default/distributions"})
+
+	slist := types.NewSampleList()
+	// 2 buckets, the +Inf bucket, _sum and _count
+	slist.PushHistogram("app", "latency_seconds", &types.HistogramValue{Buckets: []types.Bucket{{UpperBound: 0.1}, {UpperBound: 1}}})
+	slist.PushSample("app", "up", 1)
+	if out := p.Process(slist).PopBackAll(); len(out) != 1 || p.LimitedSeries() != 1 {
+		t.Fatalf("Process() = %d samples, %d limited, want the histogram kept and up limited", len(out), p.LimitedSeries())
+	}
+}
+
+func TestProcessorSeriesLimitCountsWrittenSeries(t *testing.T) {
+	p := NewProcessor(Options{SeriesLimit: 5, Name: "default/written"})
+
+	slist := types.NewSampleList()
+	// 2 buckets, the +Inf bucket and _count, the unknown _sum is not written
+	slist.PushHistogram("app", "latency_seconds", &types.HistogramValue{Sum: math.NaN(), Buckets: []types.Bucket{{UpperBound: 0.1}, {UpperBound: 1}}})
+	slist.PushSample("app", "up", 1)
+	if out := p.Process(slist).PopBackAll(); len(out) != 2 || p.LimitedSeries() != 0 {
+		t.Fatalf("Process() = %d samples, %d limited, want the 5 written series kept", len(out), p.LimitedSeries())
+	}
+}
@@ -0,0 +1,144 @@
+package types
+
+import (
+	"math"
+	"sort"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// Bucket is a bucket of a classic histogram, Count is the number of the observations less than
+// or equal to UpperBound.
+type Bucket struct {
+	UpperBound float64 `json:"upper_bound"`
+	Count      float64 `json:"count"`
+}
+
+// HistogramValue is the value of a histogram sample. It is written as the classic _bucket, _sum and
+// _count series, or as a native histogram when Native is set.
+type HistogramValue struct {
+	Count float64 `json:"count"`
+	// Sum is NaN when unknown, the _sum series is then left out
+	Sum float64 `json:"sum"`
+	// Buckets are sorted by UpperBound, the +Inf bucket is implied by Count
+	Buckets []Bucket `json:"buckets,omitempty"`
+
+	Native *NativeBuckets `json:"native,omitempty"`
+}
+
+// NativeBuckets are the exponential buckets of a native histogram, the positive bucket i holds
+// the observations in (2^((i-1)/2^Schema), 2^(i/2^Schema)], the negative ones are mirrored.
+type NativeBuckets struct {
+	Schema        int32           `json:"schema"`
+	ZeroThreshold float64         `json:"zero_threshold"`
+	ZeroCount     float64         `json:"zero_count"`
+	Positive      map[int]float64 `json:"positive,omitempty"`
+	Negative      map[int]float64 `json:"negative,omitempty"`
+}
+
+// NewNativeHistogram returns an empty native histogram of schema, from -4 to 8.
+func NewNativeHistogram(schema int32) *HistogramValue {
+	return &HistogramValue{Native: &NativeBuckets{
+		Schema:        schema,
+		ZeroThreshold: 1e-128,
+		Positive:      map[int]float64{},
+		Negative:      map[int]float64{},
+	}}
+}
+
+// Observe adds v to the count, the sum and the buckets of h.
+func (h *HistogramValue) Observe(v float64) {
+	h.Count++
+	h.Sum += v
+	for i := range h.Buckets {
+		if v <= h.Buckets[i].UpperBound {
+			h.Buckets[i].Count++
+		}
+	}
+
+	n := h.Native
+	if n == nil {
+		return
+	}
+	switch {
+	case math.Abs(v) <= n.ZeroThreshold:
+		n.ZeroCount++
+	case v > 0:
+		n.Positive[nativeIndex(v, n.Schema)]++
+	default:
+		n.Negative[nativeIndex(-v, n.Schema)]++
+	}
+}
+
+// nativeIndex returns the index of the bucket of schema holding v, the way Prometheus does.
+func nativeIndex(v float64, schema int32) int {
+	if schema > 0 {
+		return int(math.Ceil(math.Log2(v) * math.Exp2(float64(schema))))
+	}
+	frac, exp := math.Frexp(v)
+	if frac == 0.5 {
+		// v is a power of two, the upper bound of the previous bucket
+		exp--
+	}
+	offset := (1 << -schema) - 1
+	return (exp + offset) >> -schema
+}
+
+// Quantile is a quantile of a summary, e.g. the 0.9 one.
+type Quantile struct {
+	Quantile float64 `json:"quantile"`
+	Value    float64 `json:"value"`
+}
+
+// SummaryValue is the value of a summary sample, written as the quantile, _sum and _count series.
+type SummaryValue struct {
+	Count float64 `json:"count"`
+	// Sum is NaN when unknown, the _sum series is then left out
+	Sum       float64    `json:"sum"`
+	Quantiles []Quantile `json:"quantiles,omitempty"`
+}
+
+// convert returns h as a remote write native histogram with float counts.
+func (n *NativeBuckets) convert(h *HistogramValue, timestamp int64) prompb.Histogram {
+	ph := prompb.Histogram{
+		Count:         &prompb.Histogram_CountFloat{CountFloat: h.Count},
+		Sum:           h.Sum,
+		Schema:        n.Schema,
+		ZeroThreshold: n.ZeroThreshold,
+		ZeroCount:     &prompb.Histogram_ZeroCountFloat{ZeroCountFloat: n.ZeroCount},
+		Timestamp:     timestamp,
+	}
+	ph.PositiveSpans, ph.PositiveCounts = nativeSpans(n.Positive)
+	ph.NegativeSpans, ph.NegativeCounts = nativeSpans(n.Negative)
+	return ph
+}
+
+// nativeSpans encodes buckets as spans of consecutive buckets and their counts, the offset of
+// the first span is the index of its first bucket, the next ones the gap from the previous span.
+func nativeSpans(buckets map[int]float64) ([]prompb.BucketSpan, []float64) {
+	if len(buckets) == 0 {
+		return nil, nil
+	}
+	indexes := make([]int, 0, len(buckets))
+	for i := range buckets {
+		indexes = append(indexes, i)
+	}
+	sort.Ints(indexes)
+
+	var (
+		spans  []prompb.BucketSpan
+		counts = make([]float64, 0, len(indexes))
+	)
+	for j, i := range indexes {
+		switch {
+		case j == 0:
+			spans = append(spans, prompb.BucketSpan{Offset: int32(i), Length: 1})
+		case i == indexes[j-1]+1:
+			spans[len(spans)-1].Length++
+		default:
+			spans = append(spans, prompb.BucketSpan{Offset: int32(i - indexes[j-1] - 1), Length: 1})
+		}
+		counts = append(counts, buckets[i])
+	}
+	return spans, counts
+}
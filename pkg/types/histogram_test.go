@@ -0,0 +1,91 @@
+package types
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+func TestNativeIndex(t *testing.T) {
+	tests := []struct {
+		v      float64
+		schema int32
+		want   int
+	}{
+		// schema 0, buckets (2^(i-1), 2^i]
+		{v: 1, schema: 0, want: 0},
+		{v: 2, schema: 0, want: 1},
+		{v: 3, schema: 0, want: 2},
+		{v: 4, schema: 0, want: 2},
+		{v: 0.5, schema: 0, want: -1},
+		{v: 0.3, schema: 0, want: -1},
+		// schema -1, buckets (4^(i-1), 4^i]
+		{v: 1, schema: -1, want: 0},
+		{v: 2, schema: -1, want: 1},
+		{v: 4, schema: -1, want: 1},
+		{v: 5, schema: -1, want: 2},
+		{v: 16, schema: -1, want: 2},
+		{v: 0.25, schema: -1, want: -1},
+		// schema -2, buckets (16^(i-1), 16^i]
+		{v: 16, schema: -2, want: 1},
+		{v: 17, schema: -2, want: 2},
+		// schema 1, buckets (2^((i-1)/2), 2^(i/2)]
+		{v: 1, schema: 1, want: 0},
+		{v: 1.2, schema: 1, want: 1},
+		{v: 1.5, schema: 1, want: 2},
+		{v: 2, schema: 1, want: 2},
+		{v: 4, schema: 1, want: 4},
+		{v: 0.5, schema: 1, want: -2},
+	}
+	for _, tt := range tests {
+		if got := nativeIndex(tt.v, tt.schema); got != tt.want {
+			t.Errorf("nativeIndex(%v, %d) = %d, want %d", tt.v, tt.schema, got, tt.want)
+		}
+	}
+}
+
+func TestNativeSpans(t *testing.T) {
+	tests := []struct {
+		name       string
+		buckets    map[int]float64
+		wantSpans  []prompb.BucketSpan
+		wantCounts []float64
+	}{
+		{
+			name: "empty",
+		},
+		{
+			name:       "consecutive",
+			buckets:    map[int]float64{0: 1, 1: 2, 2: 3},
+			wantSpans:  []prompb.BucketSpan{{Offset: 0, Length: 3}},
+			wantCounts: []float64{1, 2, 3},
+		},
+		{
+			name:       "negative first index",
+			buckets:    map[int]float64{-5: 2},
+			wantSpans:  []prompb.BucketSpan{{Offset: -5, Length: 1}},
+			wantCounts: []float64{2},
+		},
+		{
+			name:       "gap of one bucket",
+			buckets:    map[int]float64{0: 1, 2: 1},
+			wantSpans:  []prompb.BucketSpan{{Offset: 0, Length: 1}, {Offset: 1, Length: 1}},
+			wantCounts: []float64{1, 1},
+		},
+		{
+			name:       "gaps between spans",
+			buckets:    map[int]float64{-2: 1, -1: 1, 3: 5, 4: 1, 10: 2},
+			wantSpans:  []prompb.BucketSpan{{Offset: -2, Length: 2}, {Offset: 3, Length: 2}, {Offset: 5, Length: 1}},
+			wantCounts: []float64{1, 1, 5, 1, 2},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spans, counts := nativeSpans(tt.buckets)
+			if !reflect.DeepEqual(spans, tt.wantSpans) || !reflect.DeepEqual(counts, tt.wantCounts) {
+				t.Errorf("nativeSpans() = %v, %v, want %v, %v", spans, counts, tt.wantSpans, tt.wantCounts)
+			}
+		})
+	}
+}
@@ -2,6 +2,8 @@ package types
 
 import (
 	"time"
+
+	"github.com/prometheus/prometheus/prompb"
 )
 
 // ValueType is an enumeration of metric types that represent a simple value.
@@ -17,6 +19,22 @@ const (
 	Histogram
 )
 
+// MetadataType returns the remote write metadata type of t.
+func (t ValueType) MetadataType() prompb.MetricMetadata_MetricType {
+	switch t {
+	case Counter:
+		return prompb.MetricMetadata_COUNTER
+	case Gauge:
+		return prompb.MetricMetadata_GAUGE
+	case Summary:
+		return prompb.MetricMetadata_SUMMARY
+	case Histogram:
+		return prompb.MetricMetadata_HISTOGRAM
+	default:
+		return prompb.MetricMetadata_UNKNOWN
+	}
+}
+
 // Tag represents a single tag key and value.
 type Tag struct {
 	Key   string
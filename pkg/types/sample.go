@@ -1,6 +1,8 @@
 package types
 
 import (
+	"math"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,6 +15,11 @@ type Sample struct {
 	Timestamp time.Time         `json:"timestamp"`
 	Value     interface{}       `json:"value"`
 	Labels    map[string]string `json:"labels"`
+
+	// Type, Help and Unit describe the metric, the zero Type is unknown
+	Type ValueType `json:"type,omitempty"`
+	Help string    `json:"help,omitempty"`
+	Unit string    `json:"unit,omitempty"`
 }
 
 var (
@@ -43,15 +50,10 @@ func NewSample(prefix, metric string, value interface{}, labels ...map[string]st
 	return s
 }
 
-func (item *Sample) ConvertTimeSeries(precision string) *prompb.TimeSeries {
-	value, err := ToFloat64(item.Value)
-	if err != nil {
-		// If the Labels is empty, it means it is abnormal data
-		return nil
-	}
-
-	pt := prompb.TimeSeries{}
-
+// ConvertTimeSeries returns the series of the sample: one for the numbers and the native
+// histograms, the classic series of the other histograms and of the summaries. It returns nil
+// when the value is none of them.
+func (item *Sample) ConvertTimeSeries(precision string) []*prompb.TimeSeries {
 	timestamp := item.Timestamp.UnixMilli()
 	switch precision {
 	case "s":
@@ -61,15 +63,95 @@ func (item *Sample) ConvertTimeSeries(precision string) *prompb.TimeSeries {
 		timestamp = ts - ts%60000
 	}
 
+	switch v := item.Value.(type) {
+	case *HistogramValue:
+		if v.Native != nil {
+			pt := item.series(item.Metric)
+			pt.Histograms = append(pt.Histograms, v.Native.convert(v, timestamp))
+			return []*prompb.TimeSeries{pt}
+		}
+		items := make([]*prompb.TimeSeries, 0, len(v.Buckets)+3)
+		for _, b := range v.Buckets {
+			if math.IsInf(b.UpperBound, 1) {
+				continue
+			}
+			items = append(items, item.point(item.Metric+"_bucket", b.Count, timestamp, prompb.Label{Name: model.BucketLabel, Value: formatFloat(b.UpperBound)}))
+		}
+		items = append(items, item.point(item.Metric+"_bucket", v.Count, timestamp, prompb.Label{Name: model.BucketLabel, Value: "+Inf"}))
+		return append(item.sum(items, v.Sum, timestamp), item.point(item.Metric+"_count", v.Count, timestamp))
+	case *SummaryValue:
+		items := make([]*prompb.TimeSeries, 0, len(v.Quantiles)+2)
+		for _, q := range v.Quantiles {
+			items = append(items, item.point(item.Metric, q.Value, timestamp, prompb.Label{Name: model.QuantileLabel, Value: formatFloat(q.Quantile)}))
+		}
+		return append(item.sum(items, v.Sum, timestamp), item.point(item.Metric+"_count", v.Count, timestamp))
+	}
+
+	value, err := ToFloat64(item.Value)
+	if err != nil {
+		// If the Labels is empty, it means it is abnormal data
+		return nil
+	}
+	return []*prompb.TimeSeries{item.point(item.Metric, value, timestamp)}
+}
+
+// SeriesCount returns the number of series ConvertTimeSeries writes the sample as, 0 when the
+// value converts to none.
+func (item *Sample) SeriesCount() int {
+	switch v := item.Value.(type) {
+	case *HistogramValue:
+		if v.Native != nil {
+			return 1
+		}
+		// the +Inf bucket, _sum and _count
+		n := 3
+		for _, b := range v.Buckets {
+			if !math.IsInf(b.UpperBound, 1) {
+				n++
+			}
+		}
+		if math.IsNaN(v.Sum) {
+			n--
+		}
+		return n
+	case *SummaryValue:
+		if math.IsNaN(v.Sum) {
+			return len(v.Quantiles) + 1
+		}
+		return len(v.Quantiles) + 2
+	}
+	if _, err := ToFloat64(item.Value); err != nil {
+		return 0
+	}
+	return 1
+}
+
+// sum appends the _sum series of the sample to items, unless sum is NaN, unknown.
+func (item *Sample) sum(items []*prompb.TimeSeries, sum float64, timestamp int64) []*prompb.TimeSeries {
+	if math.IsNaN(sum) {
+		return items
+	}
+	return append(items, item.point(item.Metric+"_sum", sum, timestamp))
+}
+
+// point returns the series name of the sample with a sample of value.
+func (item *Sample) point(name string, value float64, timestamp int64, extra ...prompb.Label) *prompb.TimeSeries {
+	pt := item.series(name, extra...)
 	pt.Samples = append(pt.Samples, prompb.Sample{
 		Timestamp: timestamp,
 		Value:     value,
 	})
+	return pt
+}
+
+// series returns the series name of the sample without any sample.
+func (item *Sample) series(name string, extra ...prompb.Label) *prompb.TimeSeries {
+	pt := prompb.TimeSeries{Labels: make([]prompb.Label, 0, len(item.Labels)+len(extra)+1)}
 
 	// add label: metric
 	pt.Labels = append(pt.Labels, prompb.Label{
 		Name:  model.MetricNameLabel,
-		Value: item.Metric,
+		Value: name,
 	})
 
 	// add other labels
@@ -79,10 +161,47 @@ func (item *Sample) ConvertTimeSeries(precision string) *prompb.TimeSeries {
 			Value: v,
 		})
 	}
+	pt.Labels = append(pt.Labels, extra...)
 
 	return &pt
 }
 
+// formatFloat formats the le and quantile labels the way the Prometheus clients do.
+func formatFloat(f float64) string {
+	return strconv.FormatFloat(f, 'g', -1, 64)
+}
+
+// ConvertMetadata returns the metadata of the metric, nil when the sample carries none.
+func (item *Sample) ConvertMetadata() *prompb.MetricMetadata {
+	if item.Type == 0 && item.Help == "" && item.Unit == "" {
+		return nil
+	}
+	return &prompb.MetricMetadata{
+		Type:             item.Type.MetadataType(),
+		MetricFamilyName: item.Metric,
+		Help:             item.Help,
+		Unit:             item.Unit,
+	}
+}
+
+// SetType sets the type of the metric.
+func (s *Sample) SetType(t ValueType) *Sample {
+	s.Type = t
+	return s
+}
+
+// SetHelp sets the help text of the metric.
+func (s *Sample) SetHelp(help string) *Sample {
+	s.Help = help
+	return s
+}
+
+// SetUnit sets the unit of the metric, e.g. seconds or bytes.
+func (s *Sample) SetUnit(unit string) *Sample {
+	s.Unit = unit
+	return s
+}
+
 func (s *Sample) SetTime(t time.Time) *Sample {
 	if t.IsZero() || zeroTime.Equal(t) {
 		return s
@@ -18,6 +18,21 @@ func (l *SampleList) PushSample(prefix, metric string, value interface{}, labels
 	return e
 }
 
+// PushTypedSample pushes a sample of the metric type t.
+func (l *SampleList) PushTypedSample(t ValueType, prefix, metric string, value interface{}, labels ...map[string]string) *list.Element {
+	return l.PushFront(NewSample(prefix, metric, value, labels...).SetType(t))
+}
+
+// PushHistogram pushes a histogram sample of h.
+func (l *SampleList) PushHistogram(prefix, metric string, h *HistogramValue, labels ...map[string]string) *list.Element {
+	return l.PushFront(NewSample(prefix, metric, h, labels...).SetType(Histogram))
+}
+
+// PushSummary pushes a summary sample of s.
+func (l *SampleList) PushSummary(prefix, metric string, s *SummaryValue, labels ...map[string]string) *list.Element {
+	return l.PushFront(NewSample(prefix, metric, s, labels...).SetType(Summary))
+}
+
 func (l *SampleList) PushSamples(prefix string, fields map[string]interface{}, labels ...map[string]string) {
 	vs := make([]*Sample, 0, len(fields))
 	for metric, value := range fields {
@@ -0,0 +1,155 @@
+package types
+
+import (
+	"math"
+	"reflect"
+	"strconv"
+	"testing"
+	"time"
+
+	"github.com/prometheus/prometheus/prompb"
+)
+
+// formatSeries formats ts as name{label="value"} value, the labels after the metric name in order.
+func formatSeries(ts *prompb.TimeSeries) string {
+	s := ts.Labels[0].Value
+	if len(ts.Labels) > 1 {
+		s += "{"
+		for i, l := range ts.Labels[1:] {
+			if i > 0 {
+				s += ","
+			}
+			s += l.Name + "=" + strconv.Quote(l.Value)
+		}
+		s += "}"
+	}
+	return s + " " + strconv.FormatFloat(ts.Samples[0].Value, 'g', -1, 64)
+}
+
+func TestConvertTimeSeries(t *testing.T) {
+	tests := []struct {
+		name  string
+		value interface{}
+		want  []string
+	}{
+		{
+			name:  "number",
+			value: 3,
+			want:  []string{"app_latency 3"},
+		},
+		{
+			name:  "string",
+			value: "yellow",
+			want:  nil,
+		},
+		{
+			name: "classic histogram",
+			value: &HistogramValue{Count: 4, Sum: 2.5, Buckets: []Bucket{
+				{UpperBound: 0.1, Count: 1},
+				{UpperBound: 1, Count: 3},
+			}},
+			want: []string{
+				`app_latency_bucket{le="0.1"} 1`,
+				`app_latency_bucket{le="1"} 3`,
+				`app_latency_bucket{le="+Inf"} 4`,
+				"app_latency_sum 2.5",
+				"app_latency_count 4",
+			},
+		},
+		{
+			name: "histogram with an explicit +Inf bucket",
+			value: &HistogramValue{Count: 4, Sum: 2.5, Buckets: []Bucket{
+				{UpperBound: 0.1, Count: 1},
+				{UpperBound: math.Inf(1), Count: 4},
+			}},
+			want: []string{
+				`app_latency_bucket{le="0.1"} 1`,
+				`app_latency_bucket{le="+Inf"} 4`,
+				"app_latency_sum 2.5",
+				"app_latency_count 4",
+			},
+		},
+		{
+			name:  "histogram without buckets",
+			value: &HistogramValue{Count: 2, Sum: 1},
+			want: []string{
+				`app_latency_bucket{le="+Inf"} 2`,
+				"app_latency_sum 1",
+				"app_latency_count 2",
+			},
+		},
+		{
+			name:  "histogram with an unknown sum",
+			value: &HistogramValue{Count: 2, Sum: math.NaN(), Buckets: []Bucket{{UpperBound: 0.005, Count: 1}}},
+			want: []string{
+				`app_latency_bucket{le="0.005"} 1`,
+				`app_latency_bucket{le="+Inf"} 2`,
+				"app_latency_count 2",
+			},
+		},
+		{
+			name: "summary",
+			value: &SummaryValue{Count: 10, Sum: 4, Quantiles: []Quantile{
+				{Quantile: 0.5, Value: 0.25},
+				{Quantile: 0.99, Value: 1.5},
+			}},
+			want: []string{
+				`app_latency{quantile="0.5"} 0.25`,
+				`app_latency{quantile="0.99"} 1.5`,
+				"app_latency_sum 4",
+				"app_latency_count 10",
+			},
+		},
+		{
+			name:  "summary without quantiles and an unknown sum",
+			value: &SummaryValue{Count: 10, Sum: math.NaN()},
+			want:  []string{"app_latency_count 10"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			s := NewSample("app", "latency", tt.value)
+			s.Timestamp = time.UnixMilli(1000)
+
+			series := s.ConvertTimeSeries("ms")
+			var got []string
+			for _, ts := range series {
+				got = append(got, formatSeries(ts))
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ConvertTimeSeries() = %q, want %q", got, tt.want)
+			}
+			if s.SeriesCount() != len(tt.want) {
+				t.Errorf("SeriesCount() = %d, want %d", s.SeriesCount(), len(tt.want))
+			}
+		})
+	}
+}
+
+func TestConvertTimeSeriesNativeHistogram(t *testing.T) {
+	h := NewNativeHistogram(0)
+	for _, v := range []float64{-3, 0, 1, 3, 4} {
+		h.Observe(v)
+	}
+	s := NewSample("app", "latency", h)
+	s.Timestamp = time.UnixMilli(1000)
+
+	series := s.ConvertTimeSeries("ms")
+	if len(series) != 1 || len(series[0].Histograms) != 1 || s.SeriesCount() != 1 {
+		t.Fatalf("ConvertTimeSeries() = %v, want a single native histogram", series)
+	}
+	got := series[0].Histograms[0]
+	if got.GetCountFloat() != 5 || got.Sum != 5 || got.GetZeroCountFloat() != 1 || got.Timestamp != 1000 {
+		t.Errorf("histogram count = %v, sum = %v, zero count = %v, timestamp = %v, want 5, 5, 1 and 1000",
+			got.GetCountFloat(), got.Sum, got.GetZeroCountFloat(), got.Timestamp)
+	}
+	// 1 is in the bucket 0, 3 and 4 in (2, 4], the bucket 2
+	wantPositive := []prompb.BucketSpan{{Offset: 0, Length: 1}, {Offset: 1, Length: 1}}
+	if !reflect.DeepEqual(got.PositiveSpans, wantPositive) || !reflect.DeepEqual(got.PositiveCounts, []float64{1, 2}) {
+		t.Errorf("positive spans = %v counts = %v, want %v and [1 2]", got.PositiveSpans, got.PositiveCounts, wantPositive)
+	}
+	wantNegative := []prompb.BucketSpan{{Offset: 2, Length: 1}}
+	if !reflect.DeepEqual(got.NegativeSpans, wantNegative) || !reflect.DeepEqual(got.NegativeCounts, []float64{1}) {
+		t.Errorf("negative spans = %v counts = %v, want %v and [1]", got.NegativeSpans, got.NegativeCounts, wantNegative)
+	}
+}
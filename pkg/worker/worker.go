@@ -1,33 +1,93 @@
 package worker
 
 import (
+	"context"
 	"fmt"
 	"github.com/sirupsen/logrus"
-	"k8s.io/apimachinery/pkg/util/wait"
+	"math/rand"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 type Worker interface {
 	AddWorkerTask(name string)
-	Run(name string, period time.Duration, f func()) error
+	// Run calls f every period until name is stopped, the ctx passed to f is cancelled on Stop.
+	// A tick is skipped while the previous run of name is still active.
+	Run(name, model string, period time.Duration, f func(ctx context.Context)) error
 	Exist(name string) bool
 	Stop(name string)
 	Range()
 	StopAll()
+	// Stats returns the scheduling stats of every running task
+	Stats() map[string]TaskStats
 }
+
+// Options configures the scheduling of the tasks.
+type Options struct {
+	// Jitter spreads the first run of a task over Jitter * period, between 0 and 1,
+	// so that the tasks created together do not run together
+	Jitter float64
+	// MaxConcurrent caps the runs active at once, 0 is unlimited
+	MaxConcurrent int
+	// MaxConcurrentPerModel caps the runs active at once per model, a model missing is unlimited
+	MaxConcurrentPerModel map[string]int
+}
+
+// TaskStats are the scheduling stats of a task.
+type TaskStats struct {
+	Model string
+	// Runs is the count of runs started
+	Runs uint64
+	// Skipped is the count of ticks skipped because the previous run was still active
+	Skipped uint64
+	// LastLag is the time the last run waited between its tick and its start, for a concurrency slot
+	LastLag time.Duration
+	// Running is true while a run is active
+	Running bool
+}
+
 type workers struct {
 	Tasks sync.Map
+
+	opts     Options
+	global   chan struct{}
+	perModel map[string]chan struct{}
 }
 
 type workerTask struct {
-	stopCh chan struct{}
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	name    string
+	model   atomic.Value
+	running atomic.Bool
+	runs    atomic.Uint64
+	skipped atomic.Uint64
+	lastLag atomic.Int64
 }
 
+// NewWorker returns a scheduler without jitter nor concurrency limits.
 func NewWorker() Worker {
-	return &workers{
-		Tasks: sync.Map{},
+	return NewScheduler(Options{})
+}
+
+// NewScheduler returns a Worker scheduling the tasks with opts.
+func NewScheduler(opts Options) Worker {
+	w := &workers{
+		Tasks:    sync.Map{},
+		opts:     opts,
+		perModel: map[string]chan struct{}{},
+	}
+	if opts.MaxConcurrent > 0 {
+		w.global = make(chan struct{}, opts.MaxConcurrent)
 	}
+	for model, limit := range opts.MaxConcurrentPerModel {
+		if limit > 0 {
+			w.perModel[model] = make(chan struct{}, limit)
+		}
+	}
+	return w
 }
 
 func (w *workers) Exist(name string) bool {
@@ -38,24 +98,100 @@ func (w *workers) Exist(name string) bool {
 func (w *workers) AddWorkerTask(name string) {
 	_, ok := w.Tasks.Load(name)
 	if !ok {
+		ctx, cancel := context.WithCancel(context.Background())
 		task := &workerTask{
-			stopCh: make(chan struct{}),
+			name:   name,
+			ctx:    ctx,
+			cancel: cancel,
 		}
+		task.model.Store("")
 		w.Tasks.Store(name, task)
 	}
 }
 
-func (w *workers) Run(name string, period time.Duration, f func()) error {
+func (w *workers) Run(name, model string, period time.Duration, f func(ctx context.Context)) error {
 	task, ok := w.Tasks.Load(name)
 	if !ok {
 		return fmt.Errorf("%s not registered", name)
 	}
+	if period <= 0 {
+		return fmt.Errorf("%s period must be positive", name)
+	}
 
 	taskObj := task.(*workerTask)
-	go wait.Until(f, period, taskObj.stopCh)
+	taskObj.model.Store(model)
+	go w.schedule(taskObj, period, f)
 	return nil
 }
 
+// schedule ticks every period after the jitter offset, starting a run on every tick
+// unless the previous one is still active.
+func (w *workers) schedule(task *workerTask, period time.Duration, f func(ctx context.Context)) {
+	if w.opts.Jitter > 0 {
+		offset := time.Duration(rand.Float64() * w.opts.Jitter * float64(period))
+		if !sleep(task.ctx, offset) {
+			return
+		}
+	}
+
+	ticker := time.NewTicker(period)
+	defer ticker.Stop()
+
+	scheduled := time.Now()
+	for {
+		if task.running.CompareAndSwap(false, true) {
+			go w.execute(task, scheduled, f)
+		} else {
+			task.skipped.Add(1)
+			logrus.Warnf("W! %s is still running, skip the tick", task.name)
+		}
+
+		select {
+		case <-task.ctx.Done():
+			return
+		case scheduled = <-ticker.C:
+		}
+	}
+}
+
+func (w *workers) execute(task *workerTask, scheduled time.Time, f func(ctx context.Context)) {
+	defer task.running.Store(false)
+
+	release, ok := w.acquire(task.ctx, task.model.Load().(string))
+	if !ok {
+		return
+	}
+	defer release()
+
+	task.lastLag.Store(int64(time.Since(scheduled)))
+	task.runs.Add(1)
+	f(task.ctx)
+}
+
+// acquire waits for a global and a model concurrency slot, it returns false when ctx is done first.
+func (w *workers) acquire(ctx context.Context, model string) (func(), bool) {
+	var acquired []chan struct{}
+	release := func() {
+		for _, sem := range acquired {
+			<-sem
+		}
+	}
+
+	for _, sem := range []chan struct{}{w.global, w.perModel[model]} {
+		if sem == nil {
+			continue
+		}
+		select {
+		case sem <- struct{}{}:
+			acquired = append(acquired, sem)
+		case <-ctx.Done():
+			release()
+			return nil, false
+		}
+	}
+	return release, true
+}
+
 func (w *workers) Stop(name string) {
 	task, ok := w.Tasks.Load(name)
 	if !ok {
@@ -64,7 +200,7 @@ func (w *workers) Stop(name string) {
 	}
 
 	taskObj := task.(*workerTask)
-	close(taskObj.stopCh)
+	taskObj.cancel()
 	w.Tasks.Delete(name)
 
 	logrus.Info(name, " stop")
@@ -82,8 +218,36 @@ func walk(key, value interface{}) bool {
 func (w *workers) StopAll() {
 	w.Tasks.Range(func(key, value interface{}) bool {
 		taskObj := value.(*workerTask)
-		close(taskObj.stopCh)
+		taskObj.cancel()
 		w.Tasks.Delete(key)
 		return true
 	})
 }
+
+func (w *workers) Stats() map[string]TaskStats {
+	stats := map[string]TaskStats{}
+	w.Tasks.Range(func(key, value interface{}) bool {
+		taskObj := value.(*workerTask)
+		stats[key.(string)] = TaskStats{
+			Model:   taskObj.model.Load().(string),
+			Runs:    taskObj.runs.Load(),
+			Skipped: taskObj.skipped.Load(),
+			LastLag: time.Duration(taskObj.lastLag.Load()),
+			Running: taskObj.running.Load(),
+		}
+		return true
+	})
+	return stats
+}
+
+// sleep waits for duration, it returns false when ctx is done first.
+func sleep(ctx context.Context, duration time.Duration) bool {
+	timer := time.NewTimer(duration)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
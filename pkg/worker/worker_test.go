@@ -0,0 +1,60 @@
+package worker
+
+import (
+	"context"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestSchedulerSkipsOverrunTicks(t *testing.T) {
+	w := NewWorker()
+	defer w.StopAll()
+
+	release := make(chan struct{})
+	w.AddWorkerTask("default/slow")
+	if err := w.Run("default/slow", "mysql", 10*time.Millisecond, func(ctx context.Context) {
+		select {
+		case <-release:
+		case <-ctx.Done():
+		}
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	stats := w.Stats()["default/slow"]
+	close(release)
+
+	if stats.Runs != 1 || stats.Skipped == 0 || !stats.Running {
+		t.Errorf("Stats() = %+v, want a single active run and skipped ticks", stats)
+	}
+}
+
+func TestSchedulerLimitsConcurrency(t *testing.T) {
+	w := NewScheduler(Options{MaxConcurrentPerModel: map[string]int{"mysql": 1}})
+	defer w.StopAll()
+
+	var active, maxActive atomic.Int32
+	for _, name := range []string{"default/a", "default/b", "default/c"} {
+		w.AddWorkerTask(name)
+		if err := w.Run(name, "mysql", 10*time.Millisecond, func(ctx context.Context) {
+			n := active.Add(1)
+			for {
+				m := maxActive.Load()
+				if n <= m || maxActive.CompareAndSwap(m, n) {
+					break
+				}
+			}
+			time.Sleep(5 * time.Millisecond)
+			active.Add(-1)
+		}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	time.Sleep(100 * time.Millisecond)
+	if n := maxActive.Load(); n != 1 {
+		t.Errorf("max active runs = %d, want 1", n)
+	}
+}